@@ -1,17 +1,28 @@
 package api
 
 import (
+	"crypto/tls"
+	"io"
 	"net"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/lomik/go-carbon/cache"
 	"github.com/lomik/go-carbon/helper"
 	"github.com/lomik/go-carbon/helper/carbonpb"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/receiver/parse"
 	"github.com/lomik/stop"
 )
 
@@ -23,17 +34,43 @@ type Api struct {
 		cacheRequestMetrics  uint32 // atomic
 		cacheResponseMetrics uint32 // atomic
 		cacheResponsePoints  uint32 // atomic
+		storeRequests        uint32 // atomic
+		storeErrors          uint32 // atomic
+		storeMetrics         uint32 // atomic
+		storePoints          uint32 // atomic
+		storeRateLimited     uint32 // atomic
+		tenantAuthErrors     uint32 // atomic
 	}
-	cache    *cache.Cache
-	listener *net.TCPListener
+	cache     *cache.Cache
+	store     func(*points.Points) bool
+	listener  *net.TCPListener
+	tlsConfig *tls.Config
+	tenants   *tenant.Tenants // if set requests without valid token are rejected
 }
 
 func New(c *cache.Cache) *Api {
 	return &Api{
 		cache: c,
+		store: c.Admit,
 	}
 }
 
+// SetStore sets func used by Store and StorePayload instead of Cache.Admit. store returns false if points are dropped
+func (api *Api) SetStore(store func(*points.Points) bool) {
+	api.store = store
+}
+
+// SetTenants enables auth of all methods by "authorization: Bearer <token>" metadata. Metrics are stored and read
+// under "<tenant>." prefix
+func (api *Api) SetTenants(tenants *tenant.Tenants) {
+	api.tenants = tenants
+}
+
+// SetTLSConfig enables TLS on listener. nil disables TLS
+func (api *Api) SetTLSConfig(config *tls.Config) {
+	api.tlsConfig = config
+}
+
 // Addr returns binded socket address. For bind port 0 in tests
 func (api *Api) Addr() net.Addr {
 	if api.listener == nil {
@@ -48,6 +85,12 @@ func (api *Api) Stat(send helper.StatCallback) {
 	helper.SendAndSubstractUint32("cacheRequestMetrics", &api.stat.cacheRequestMetrics, send)
 	helper.SendAndSubstractUint32("cacheResponseMetrics", &api.stat.cacheResponseMetrics, send)
 	helper.SendAndSubstractUint32("cacheResponsePoints", &api.stat.cacheResponsePoints, send)
+	helper.SendAndSubstractUint32("storeRequests", &api.stat.storeRequests, send)
+	helper.SendAndSubstractUint32("storeErrors", &api.stat.storeErrors, send)
+	helper.SendAndSubstractUint32("storeMetrics", &api.stat.storeMetrics, send)
+	helper.SendAndSubstractUint32("storePoints", &api.stat.storePoints, send)
+	helper.SendAndSubstractUint32("storeRateLimited", &api.stat.storeRateLimited, send)
+	helper.SendAndSubstractUint32("tenantAuthErrors", &api.stat.tenantAuthErrors, send)
 }
 
 // Listen bind port. Receive messages and send to out channel
@@ -59,7 +102,12 @@ func (api *Api) Listen(addr *net.TCPAddr) error {
 			return err
 		}
 
-		s := grpc.NewServer()
+		var opts []grpc.ServerOption
+		if api.tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(api.tlsConfig)))
+		}
+
+		s := grpc.NewServer(opts...)
 		carbonpb.RegisterCarbonServer(s, api)
 		// Register reflection service on gRPC server.
 		reflection.Register(s)
@@ -85,7 +133,13 @@ func (api *Api) Listen(addr *net.TCPAddr) error {
 	})
 }
 
+// CacheQuery returns points of metrics from cache. With tenants metrics are relative to tenant root
 func (api *Api) CacheQuery(ctx context.Context, req *carbonpb.CacheRequest) (*carbonpb.Payload, error) {
+	tenantName, err := api.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	res := &carbonpb.Payload{
 		Metrics: make([]*carbonpb.Metric, 0),
 	}
@@ -94,14 +148,25 @@ func (api *Api) CacheQuery(ctx context.Context, req *carbonpb.CacheRequest) (*ca
 	resPoints := 0
 
 	for i := 0; i < len(req.Metrics); i++ {
-		data := api.cache.Get(req.Metrics[i])
+		metric := req.Metrics[i]
+		if tenantName != "" {
+			metric = tenant.Prefix(tenantName, metric)
+		}
+
+		data := api.cache.Get(metric)
 
 		if len(data) > 0 {
 			resMetrics++
 			resPoints += len(data)
 
+			name := metric
+			if tenantName != "" {
+				// names of response are relative to tenant root
+				name, _ = tenant.Strip(tenantName, metric)
+			}
+
 			m := &carbonpb.Metric{
-				Metric: req.Metrics[i],
+				Metric: name,
 				Points: make([]carbonpb.Point, len(data)),
 			}
 			for j := 0; j < len(data); j++ {
@@ -120,3 +185,139 @@ func (api *Api) CacheQuery(ctx context.Context, req *carbonpb.CacheRequest) (*ca
 
 	return res, nil
 }
+
+// tenant authenticates request by "authorization: Bearer <token>" metadata. Empty string is returned if tenants are
+// disabled
+func (api *Api) tenant(ctx context.Context) (string, error) {
+	if api.tenants == nil {
+		return "", nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if auth := md["authorization"]; len(auth) > 0 {
+			token = tenant.AuthorizationToken(auth[0])
+		}
+	}
+
+	tenantName, ok := api.tenants.Lookup(token)
+	if !ok {
+		atomic.AddUint32(&api.stat.tenantAuthErrors, 1)
+		return "", grpc.Errorf(codes.Unauthenticated, "unauthorized")
+	}
+	return tenantName, nil
+}
+
+// peerIP returns client IP used as key of rate limit
+func peerIP(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return ratelimit.HostIP(p.Addr.String())
+	}
+	return ""
+}
+
+// storePayload stores points of payload and adds counts of points stored to cache to res. Nothing is stored if
+// payload is broken. Points over rate limit are dropped, or error is returned if limiter rejects clients
+func (api *Api) storePayload(tenantName string, ip string, payload *carbonpb.Payload, res *carbonpb.StoreResponse) error {
+	atomic.AddUint32(&api.stat.storeRequests, 1)
+
+	data, err := parse.ProtobufPayload(payload)
+	if err != nil {
+		atomic.AddUint32(&api.stat.storeErrors, 1)
+		return grpc.Errorf(codes.InvalidArgument, "%s", err.Error())
+	}
+
+	metrics := 0
+	cnt := 0
+	defer func() {
+		res.Metrics += uint32(metrics)
+		res.Points += uint32(cnt)
+
+		atomic.AddUint32(&api.stat.storeMetrics, uint32(metrics))
+		atomic.AddUint32(&api.stat.storePoints, uint32(cnt))
+	}()
+
+	for i := 0; i < len(data); i++ {
+		if tenantName != "" {
+			data[i].Metric = tenant.Prefix(tenantName, data[i].Metric)
+		}
+		if !ratelimit.Allow(ip, data[i].Metric, len(data[i].Data)) {
+			atomic.AddUint32(&api.stat.storeRateLimited, uint32(len(data[i].Data)))
+			if ratelimit.Reject() {
+				// points before data[i] are already stored
+				return grpc.Errorf(codes.ResourceExhausted, "rate limit exceeded")
+			}
+			continue
+		}
+		// points are owned by cache after store
+		n := len(data[i].Data)
+		if api.store(data[i]) {
+			metrics++
+			cnt += n
+		}
+	}
+
+	return nil
+}
+
+// waitCache blocks while cache is full. Stream is not read meanwhile, so client is blocked by gRPC flow control
+func (api *Api) waitCache(ctx context.Context) error {
+	for api.cache.Backpressure() {
+		select {
+		case <-ctx.Done():
+			atomic.AddUint32(&api.stat.storeErrors, 1)
+			return grpc.Errorf(codes.ResourceExhausted, "cache is full")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// Store receives stream of payloads. Counts of metrics and points stored to cache are sent after end of stream.
+// Stream is aborted on first broken or rejected payload, points of previous payloads are stored
+func (api *Api) Store(stream carbonpb.Carbon_StoreServer) error {
+	res := &carbonpb.StoreResponse{}
+
+	tenantName, err := api.tenant(stream.Context())
+	if err != nil {
+		return err
+	}
+	ip := peerIP(stream.Context())
+
+	for {
+		if err := api.waitCache(stream.Context()); err != nil {
+			return err
+		}
+
+		payload, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(res)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = api.storePayload(tenantName, ip, payload, res); err != nil {
+			return err
+		}
+	}
+}
+
+// StorePayload stores single payload. ResourceExhausted is returned if cache is full, client should retry later
+func (api *Api) StorePayload(ctx context.Context, payload *carbonpb.Payload) (*carbonpb.StoreResponse, error) {
+	tenantName, err := api.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if api.cache.Backpressure() {
+		atomic.AddUint32(&api.stat.storeErrors, 1)
+		return nil, grpc.Errorf(codes.ResourceExhausted, "cache is full")
+	}
+
+	res := &carbonpb.StoreResponse{}
+	if err = api.storePayload(tenantName, peerIP(ctx), payload, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/lomik/go-carbon/cache"
+	"github.com/lomik/go-carbon/helper/carbonpb"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/points"
+)
+
+func newTestApi(t *testing.T) (*Api, carbonpb.CarbonClient, func()) {
+	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := New(cache.New())
+	if err = api.Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.Dial(api.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		api.Stop()
+		t.Fatal(err)
+	}
+
+	return api, carbonpb.NewCarbonClient(conn), func() {
+		conn.Close()
+		api.Stop()
+	}
+}
+
+func payload(metric string, values ...float64) *carbonpb.Payload {
+	m := &carbonpb.Metric{Metric: metric}
+	for i, v := range values {
+		m.Points = append(m.Points, carbonpb.Point{Timestamp: uint32(1422698155 + 60*i), Value: v})
+	}
+	return &carbonpb.Payload{Metrics: []*carbonpb.Metric{m}}
+}
+
+func TestStore(t *testing.T) {
+	api, client, stop := newTestApi(t)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Store(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = stream.Send(payload("hello.world", 42, 43)); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(payload("metric.name", -72)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Metrics != 2 || res.Points != 3 {
+		t.Fatalf("unexpected response: %#v", res)
+	}
+
+	if len(api.cache.Get("hello.world")) != 2 || len(api.cache.Get("metric.name")) != 1 {
+		t.Fatal("points not found in cache")
+	}
+}
+
+func TestStorePayload(t *testing.T) {
+	api, client, stop := newTestApi(t)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.StorePayload(ctx, payload("hello.world", 42, 43))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Metrics != 1 || res.Points != 2 {
+		t.Fatalf("unexpected response: %#v", res)
+	}
+
+	// metric without points
+	_, err = client.StorePayload(ctx, payload("broken"))
+	if grpc.Code(err) != codes.InvalidArgument {
+		t.Fatalf("InvalidArgument expected, got %#v", err)
+	}
+
+	// cache is full
+	api.cache.SetMaxSize(1)
+	api.cache.SetBackpressure(true)
+
+	_, err = client.StorePayload(ctx, payload("metric.name", -72))
+	if grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("ResourceExhausted expected, got %#v", err)
+	}
+
+	if len(api.cache.Get("metric.name")) != 0 {
+		t.Fatal("point stored to full cache")
+	}
+}
+
+func TestStoreDropped(t *testing.T) {
+	api, client, stop := newTestApi(t)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	api.SetStore(func(p *points.Points) bool {
+		if p.Metric == "dropped" {
+			return false
+		}
+		return api.cache.Admit(p)
+	})
+
+	res, err := client.StorePayload(ctx, &carbonpb.Payload{Metrics: []*carbonpb.Metric{
+		payload("hello.world", 42, 43).Metrics[0],
+		payload("dropped", 1).Metrics[0],
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Metrics != 1 || res.Points != 2 {
+		t.Fatalf("unexpected response: %#v", res)
+	}
+
+	// cache is full without backpressure, points are dropped
+	api.cache.SetMaxSize(1)
+
+	res, err = client.StorePayload(ctx, payload("metric.name", -72))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Metrics != 0 || res.Points != 0 {
+		t.Fatalf("unexpected response: %#v", res)
+	}
+}
+
+func TestStoreTenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "tenants")
+	if err = ioutil.WriteFile(filename, []byte("secret team\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := tenant.Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api, client, stop := newTestApi(t)
+	defer stop()
+	api.SetTenants(tenants)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = client.StorePayload(ctx, payload("hello.world", 42))
+	if grpc.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Unauthenticated expected, got %#v", err)
+	}
+
+	stream, err := client.Store(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(payload("hello.world", 42))
+	if _, err = stream.CloseAndRecv(); grpc.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Unauthenticated expected, got %#v", err)
+	}
+
+	authCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer secret"))
+
+	if _, err = client.StorePayload(authCtx, payload("hello.world", 42)); err != nil {
+		t.Fatal(err)
+	}
+
+	if stream, err = client.Store(authCtx); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(payload("metric.name", -72)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.cache.Get("team.hello.world")) != 1 || len(api.cache.Get("team.metric.name")) != 1 {
+		t.Fatal("points not found under tenant prefix")
+	}
+	if len(api.cache.Get("hello.world")) != 0 {
+		t.Fatal("point stored without tenant prefix")
+	}
+
+	// cache of other tenants can't be read
+	api.cache.Add(points.OnePoint("other.hello.world", 42, 1422698155))
+
+	_, err = client.CacheQuery(ctx, &carbonpb.CacheRequest{Metrics: []string{"team.hello.world"}})
+	if grpc.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Unauthenticated expected, got %#v", err)
+	}
+
+	res, err := client.CacheQuery(authCtx, &carbonpb.CacheRequest{Metrics: []string{"hello.world", "other.hello.world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Metrics) != 1 || res.Metrics[0].Metric != "hello.world" || len(res.Metrics[0].Points) != 1 {
+		t.Fatalf("unexpected response: %#v", res)
+	}
+}
+
+func TestStoreRateLimit(t *testing.T) {
+	defer ratelimit.Configure(ratelimit.NewOptions())
+
+	for _, action := range []string{ratelimit.ActionDrop, ratelimit.ActionReject} {
+		options := ratelimit.NewOptions()
+		options.Enabled = true
+		options.PerIP = 1
+		options.PerIPBurst = 2
+		options.Action = action
+		// buckets of unchanged limits are kept by Configure
+		ratelimit.Configure(ratelimit.NewOptions())
+		if err := ratelimit.Configure(options); err != nil {
+			t.Fatal(err)
+		}
+
+		func() {
+			api, client, stop := newTestApi(t)
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			res, err := client.StorePayload(ctx, &carbonpb.Payload{Metrics: []*carbonpb.Metric{
+				payload("m1", 1, 2).Metrics[0],
+				payload("m2", 3).Metrics[0],
+				payload("m3", 4).Metrics[0],
+			}})
+
+			if action == ratelimit.ActionDrop {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Metrics != 1 || res.Points != 2 {
+					t.Fatalf("unexpected response: %#v", res)
+				}
+			} else if grpc.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("ResourceExhausted expected, got %#v", err)
+			}
+
+			if len(api.cache.Get("m1")) != 2 || len(api.cache.Get("m2")) != 0 || len(api.cache.Get("m3")) != 0 {
+				t.Fatalf("%s: unexpected points in cache", action)
+			}
+
+			expected := uint32(2)
+			if action == ratelimit.ActionReject {
+				expected = 1
+			}
+			if v := atomic.LoadUint32(&api.stat.storeRateLimited); v != expected {
+				t.Fatalf("%s: storeRateLimited %d != %d", action, v, expected)
+			}
+		}()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+// Usage: ./store <metric> <value> [<timestamp>]
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/lomik/go-carbon/helper/carbonpb"
+)
+
+func main() {
+	server := flag.String("server", "127.0.0.1:7003", "go-carbon GRPC <host:port>")
+	timeout := flag.Duration("timeout", time.Second, "connect and write timeout")
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		log.Fatal("metric and value are required")
+	}
+
+	value, err := strconv.ParseFloat(flag.Arg(1), 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	timestamp := time.Now().Unix()
+	if flag.NArg() > 2 {
+		if timestamp, err = strconv.ParseInt(flag.Arg(2), 10, 64); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	conn, err := grpc.Dial(*server, grpc.WithInsecure(), grpc.WithTimeout(*timeout))
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	c := carbonpb.NewCarbonClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	res, err := c.StorePayload(ctx, &carbonpb.Payload{
+		Metrics: []*carbonpb.Metric{
+			{
+				Metric: flag.Arg(0),
+				Points: []carbonpb.Point{{Timestamp: uint32(timestamp), Value: value}},
+			},
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("accepted metrics: %d, points: %d\n", res.Metrics, res.Points)
+}
@@ -27,11 +27,16 @@ const (
 const shardCount = 1024
 
 type cacheSettings struct {
-	maxSize     int32
-	xlog        io.Writer
-	tagsEnabled bool
+	maxSize      int32
+	xlog         io.Writer
+	tagsEnabled  bool
+	wal          *WAL
+	backpressure bool // Add waits for free space instead of drop of points
 }
 
+// interval of checks of free space by blocked Add
+const backpressureInterval = 10 * time.Millisecond
+
 // A "thread" safe map of type string:Anything.
 // To avoid lock bottlenecks this map is dived to several (shardCount) map shards.
 type Cache struct {
@@ -45,6 +50,7 @@ type Cache struct {
 	writeoutQueue *WriteoutQueue
 
 	settings atomic.Value // cacheSettings
+	stopped  int32        // atomic, releases blocked Add after Stop
 
 	stat struct {
 		size                int32  // changing via atomic
@@ -52,6 +58,7 @@ type Cache struct {
 		queueBuildTimeMs    uint32 // time spent building writeout queue in milliseconds
 		queueWriteoutTime   uint32 // in milliseconds
 		overflowCnt         uint32 // drop packages if cache full
+		blockedCnt          uint32 // number of Add calls waited for free space
 		queryCnt            uint32 // number of queries
 		tagsNormalizeErrors uint32 // tags normalize errors count
 	}
@@ -63,6 +70,14 @@ type Shard struct {
 	items            map[string]*points.Points
 	notConfirmed     []*points.Points // linear search for value/slot
 	notConfirmedUsed int              // search value in notConfirmed[:notConfirmedUsed]
+
+	// wal segments referenced by items and notConfirmed. Used only if wal is enabled
+	itemsSegment        map[string]uint64
+	notConfirmedSegment []uint64
+
+	// callbacks of AddWithConfirm referenced by items and notConfirmed
+	itemsCallbacks        map[string][]func()
+	notConfirmedCallbacks [][]func()
 }
 
 // Creates a new cache instance
@@ -74,8 +89,12 @@ func New() *Cache {
 
 	for i := 0; i < shardCount; i++ {
 		c.data[i] = &Shard{
-			items:        make(map[string]*points.Points),
-			notConfirmed: make([]*points.Points, 4),
+			items:                 make(map[string]*points.Points),
+			notConfirmed:          make([]*points.Points, 4),
+			itemsSegment:          make(map[string]uint64),
+			notConfirmedSegment:   make([]uint64, 4),
+			itemsCallbacks:        make(map[string][]func()),
+			notConfirmedCallbacks: make([][]func(), 4),
 		}
 	}
 
@@ -124,7 +143,41 @@ func (c *Cache) SetTagsEnabled(value bool) {
 	c.settings.Store(&newSettings)
 }
 
-func (c *Cache) Stop() {}
+// SetBackpressure enables waiting of Add for free space if cache is full
+func (c *Cache) SetBackpressure(value bool) {
+	s := c.settings.Load().(*cacheSettings)
+	newSettings := *s
+	newSettings.backpressure = value
+	c.settings.Store(&newSettings)
+}
+
+// Backpressure returns true if cache is full and writers should wait. Always false if backpressure is disabled
+func (c *Cache) Backpressure() bool {
+	s := c.settings.Load().(*cacheSettings)
+	return s.backpressure && s.xlog == nil && s.maxSize > 0 && c.Size() > s.maxSize && atomic.LoadInt32(&c.stopped) == 0
+}
+
+// SetWAL enables write-ahead log of all added points. Should be called before first Add
+func (c *Cache) SetWAL(wal *WAL) {
+	s := c.settings.Load().(*cacheSettings)
+	newSettings := *s
+	newSettings.wal = wal
+	c.settings.Store(&newSettings)
+}
+
+// WAL returns write-ahead log or nil if disabled
+func (c *Cache) WAL() *WAL {
+	return c.settings.Load().(*cacheSettings).wal
+}
+
+func (c *Cache) Stop() {
+	atomic.StoreInt32(&c.stopped, 1)
+
+	s := c.settings.Load().(*cacheSettings)
+	if s.wal != nil {
+		s.wal.Close()
+	}
+}
 
 // Collect cache metrics
 func (c *Cache) Stat(send helper.StatCallback) {
@@ -137,10 +190,24 @@ func (c *Cache) Stat(send helper.StatCallback) {
 	helper.SendAndSubstractUint32("queries", &c.stat.queryCnt, send)
 	helper.SendAndSubstractUint32("tagsNormalizeErrors", &c.stat.tagsNormalizeErrors, send)
 	helper.SendAndSubstractUint32("overflow", &c.stat.overflowCnt, send)
+	helper.SendAndSubstractUint32("blocked", &c.stat.blockedCnt, send)
 
 	helper.SendAndSubstractUint32("queueBuildCount", &c.stat.queueBuildCnt, send)
 	helper.SendAndSubstractUint32("queueBuildTimeMs", &c.stat.queueBuildTimeMs, send)
 	helper.SendUint32("queueWriteoutTime", &c.stat.queueWriteoutTime, send)
+
+	if s.wal != nil {
+		s.wal.Stat(send)
+	}
+}
+
+// StatType returns type of stat sent by Stat
+func (c *Cache) StatType(metric string) helper.StatType {
+	switch metric {
+	case "size", "metrics", "maxSize", "queueWriteoutTime", "walSegments":
+		return helper.StatGauge
+	}
+	return helper.StatCounter
 }
 
 // hash function
@@ -191,21 +258,45 @@ func (c *Cache) Get(key string) []points.Point {
 
 func (c *Cache) Confirm(p *points.Points) {
 	var i, j int
+	var segments []uint64
+	var callbacks []func()
 	shard := c.GetShard(p.Metric)
+	wal := c.WAL()
 
 	shard.Lock()
 	for i = 0; i < shard.notConfirmedUsed; i++ {
 		if shard.notConfirmed[i] == p {
 			shard.notConfirmed[i] = nil
+			if wal != nil {
+				segments = append(segments, shard.notConfirmedSegment[i])
+			}
+			callbacks = append(callbacks, shard.notConfirmedCallbacks[i]...)
+			shard.notConfirmedCallbacks[i] = nil
 
 			for j = i + 1; j < shard.notConfirmedUsed; j++ {
 				shard.notConfirmed[j-1] = shard.notConfirmed[j]
+				shard.notConfirmedSegment[j-1] = shard.notConfirmedSegment[j]
+				shard.notConfirmedCallbacks[j-1] = shard.notConfirmedCallbacks[j]
 			}
+			shard.notConfirmedCallbacks[shard.notConfirmedUsed-1] = nil
 
 			shard.notConfirmedUsed--
 		}
 	}
 	shard.Unlock()
+
+	for _, segment := range segments {
+		wal.Release(segment)
+	}
+
+	runCallbacks(callbacks)
+}
+
+// runCallbacks calls confirm callbacks of points which left the cache
+func runCallbacks(callbacks []func()) {
+	for _, cb := range callbacks {
+		cb()
+	}
 }
 
 func (c *Cache) Len() int32 {
@@ -232,11 +323,55 @@ func (c *Cache) DivertToXlog(w io.Writer) {
 
 // Sets the given value under the specified key.
 func (c *Cache) Add(p *points.Points) {
+	c.add(p, nil, true, 0)
+}
+
+// TryAdd is Add which never waits for free space. Points are dropped if cache is full even with enabled backpressure.
+// Used by internal writers which must not be blocked by receivers
+func (c *Cache) TryAdd(p *points.Points) {
+	c.add(p, nil, false, 0)
+}
+
+// Admit is Add which reports if points are stored. False is returned if points are dropped because cache is full
+// or metric name is invalid. Points handed over to xlog are reported as stored
+func (c *Cache) Admit(p *points.Points) bool {
+	stored, _ := c.add(p, nil, true, 0)
+	return stored
+}
+
+// AddWithConfirm adds points to cache. confirm is called once points are written by persister (see Confirm),
+// handed over to xlog or dropped as invalid. Points dropped because cache is full are never confirmed and false is
+// returned, caller should deliver them again. confirm is called from persister or receiver goroutine and should not
+// block
+func (c *Cache) AddWithConfirm(p *points.Points, confirm func()) bool {
+	_, overflow := c.add(p, confirm, true, 0)
+	return !overflow
+}
+
+// Replay adds points read from wal segment by WAL.Replay. Points are not written to wal again, cache entry holds
+// reference to replayed segment taken by WAL.Replay instead
+func (c *Cache) Replay(p *points.Points, segment uint64) {
+	if stored, _ := c.add(p, nil, true, segment); !stored {
+		c.WAL().Release(segment)
+	}
+}
+
+// add stores points to cache. stored is false if points are dropped, overflow is true if points are dropped because
+// cache is full. Non zero segment is wal segment which already holds points (see Replay), otherwise points are
+// written to wal
+func (c *Cache) add(p *points.Points, confirm func(), wait bool, segment uint64) (stored bool, overflow bool) {
 	s := c.settings.Load().(*cacheSettings)
 
 	if s.xlog != nil {
 		p.WriteTo(s.xlog)
-		return
+		if segment != 0 && s.wal != nil {
+			s.wal.Release(segment)
+		}
+		// points are handed over to other process
+		if confirm != nil {
+			confirm()
+		}
+		return true, false
 	}
 
 	if s.tagsEnabled {
@@ -244,7 +379,10 @@ func (c *Cache) Add(p *points.Points) {
 		p.Metric, err = tags.Normalize(p.Metric)
 		if err != nil {
 			atomic.AddUint32(&c.stat.tagsNormalizeErrors, 1)
-			return
+			if confirm != nil {
+				confirm()
+			}
+			return false, false
 		}
 	}
 
@@ -252,21 +390,51 @@ func (c *Cache) Add(p *points.Points) {
 	count := len(p.Data)
 
 	if s.maxSize > 0 && c.Size() > s.maxSize {
-		atomic.AddUint32(&c.stat.overflowCnt, uint32(count))
-		return
+		if !s.backpressure || !wait {
+			// not confirmed, points are not written
+			atomic.AddUint32(&c.stat.overflowCnt, uint32(count))
+			return false, true
+		}
+
+		// caller (receiver) is blocked until persister frees space
+		atomic.AddUint32(&c.stat.blockedCnt, 1)
+		for c.Backpressure() {
+			time.Sleep(backpressureInterval)
+		}
+		// settings can be changed by reload or grace stop while waiting
+		return c.add(p, confirm, wait, segment)
+	}
+
+	if s.wal != nil && segment == 0 {
+		// points are kept in cache even if wal write failed. Error is counted by wal
+		segment, _ = s.wal.Write(p)
 	}
 
 	shard := c.GetShard(p.Metric)
 
+	exists := false
 	shard.Lock()
-	if values, exists := shard.items[p.Metric]; exists {
+	if values, ok := shard.items[p.Metric]; ok {
 		values.Data = append(values.Data, p.Data...)
+		exists = true
 	} else {
 		shard.items[p.Metric] = p
+		if s.wal != nil {
+			shard.itemsSegment[p.Metric] = segment
+		}
+	}
+	if confirm != nil {
+		shard.itemsCallbacks[p.Metric] = append(shard.itemsCallbacks[p.Metric], confirm)
 	}
 	shard.Unlock()
 
+	// entry already holds reference to older segment
+	if exists && s.wal != nil {
+		s.wal.Release(segment)
+	}
+
 	atomic.AddInt32(&c.stat.size, int32(count))
+	return true, false
 }
 
 // Removes an element from the map and returns it
@@ -276,12 +444,23 @@ func (c *Cache) Pop(key string) (p *points.Points, exists bool) {
 	shard.Lock()
 	p, exists = shard.items[key]
 	delete(shard.items, key)
+	segment, hasSegment := shard.itemsSegment[key]
+	delete(shard.itemsSegment, key)
+	callbacks := shard.itemsCallbacks[key]
+	delete(shard.itemsCallbacks, key)
 	shard.Unlock()
 
 	if exists {
 		atomic.AddInt32(&c.stat.size, -int32(len(p.Data)))
 	}
 
+	if hasSegment {
+		c.WAL().Release(segment)
+	}
+
+	// points are removed without persister, nothing to wait for
+	runCallbacks(callbacks)
+
 	return p, exists
 }
 
@@ -292,12 +471,30 @@ func (c *Cache) PopNotConfirmed(key string) (p *points.Points, exists bool) {
 	p, exists = shard.items[key]
 	delete(shard.items, key)
 
+	segment := shard.itemsSegment[key]
+	delete(shard.itemsSegment, key)
+
+	callbacks := shard.itemsCallbacks[key]
+	delete(shard.itemsCallbacks, key)
+
 	if exists {
 		if shard.notConfirmedUsed < len(shard.notConfirmed) {
 			shard.notConfirmed[shard.notConfirmedUsed] = p
 		} else {
 			shard.notConfirmed = append(shard.notConfirmed, p)
 		}
+		// segment is released on Confirm
+		if shard.notConfirmedUsed < len(shard.notConfirmedSegment) {
+			shard.notConfirmedSegment[shard.notConfirmedUsed] = segment
+		} else {
+			shard.notConfirmedSegment = append(shard.notConfirmedSegment, segment)
+		}
+		// callbacks are called on Confirm
+		if shard.notConfirmedUsed < len(shard.notConfirmedCallbacks) {
+			shard.notConfirmedCallbacks[shard.notConfirmedUsed] = callbacks
+		} else {
+			shard.notConfirmedCallbacks = append(shard.notConfirmedCallbacks, callbacks)
+		}
 		shard.notConfirmedUsed++
 	}
 	shard.Unlock()
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/lomik/go-carbon/points"
 )
@@ -40,6 +41,70 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestCacheBackpressure(t *testing.T) {
+	c := New()
+	c.SetMaxSize(1)
+	c.SetBackpressure(true)
+
+	c.Add(points.OnePoint("hello.world", 42, 10))
+	c.Add(points.OnePoint("hello.world", 15, 12))
+
+	if !c.Backpressure() {
+		t.Fatal("cache should be full")
+	}
+
+	added := make(chan bool)
+	go func() {
+		c.Add(points.OnePoint("hello.world", 16, 13))
+		close(added)
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("Add should wait for free space")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Pop("hello.world")
+
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Add should be finished after Pop")
+	}
+
+	if c.Size() != 1 {
+		t.Fatalf("size %d != 1", c.Size())
+	}
+
+	// TryAdd doesn't wait for free space, overflow points are dropped
+	c.Add(points.OnePoint("hello.world", 17, 14))
+	tried := make(chan bool)
+	go func() {
+		c.TryAdd(points.OnePoint("hello.world", 17, 14))
+		close(tried)
+	}()
+
+	select {
+	case <-tried:
+	case <-time.After(time.Second):
+		t.Fatal("TryAdd should not wait for free space")
+	}
+
+	if c.Size() != 2 {
+		t.Fatalf("size %d != 2", c.Size())
+	}
+	c.Pop("hello.world")
+
+	// overflow points are dropped without backpressure
+	c.Add(points.OnePoint("hello.world", 17, 14))
+	c.SetBackpressure(false)
+	c.Add(points.OnePoint("hello.world", 18, 15))
+	if c.Size() != 2 {
+		t.Fatalf("size %d != 2", c.Size())
+	}
+}
+
 var cache *Cache
 
 func createCacheAndPopulate(metricsCount int, maxPointsPerMetric int) *Cache {
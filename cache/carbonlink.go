@@ -2,6 +2,7 @@ package cache
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"fmt"
 	"math"
@@ -12,6 +13,8 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/helper/socket"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/graphite-pickle/framing"
 	"github.com/lomik/zapwriter"
@@ -143,7 +146,8 @@ type CarbonlinkListener struct {
 	helper.Stoppable
 	cache       *Cache
 	readTimeout time.Duration
-	tcpListener *net.TCPListener
+	tcpListener net.Listener
+	tlsConfig   *tls.Config
 }
 
 // NewCarbonlinkListener create new instance of CarbonlinkListener
@@ -159,6 +163,18 @@ func (listener *CarbonlinkListener) SetReadTimeout(timeout time.Duration) {
 	listener.readTimeout = timeout
 }
 
+// SetTLSConfig enables TLS on listener. nil disables TLS
+func (listener *CarbonlinkListener) SetTLSConfig(config *tls.Config) {
+	listener.tlsConfig = config
+}
+
+// resetConnection closes connection with RST instead of FIN
+func resetConnection(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+}
+
 func pickleWriteMemo(b *bytes.Buffer, memo *uint32) {
 	if *memo < 256 {
 		b.WriteByte('q')
@@ -224,7 +240,7 @@ func (listener *CarbonlinkListener) HandleConnection(conn framing.Conn) {
 		reqData, err := conn.ReadFrame()
 
 		if err != nil {
-			conn.Conn.(*net.TCPConn).SetLinger(0)
+			resetConnection(conn.Conn)
 			logger.Debug("request read failed", zap.Error(err))
 			break
 		}
@@ -232,7 +248,7 @@ func (listener *CarbonlinkListener) HandleConnection(conn framing.Conn) {
 		req, err := ParseCarbonlinkRequest(reqData)
 
 		if err != nil {
-			conn.Conn.(*net.TCPConn).SetLinger(0)
+			resetConnection(conn.Conn)
 			logger.Warn("request parse failed", zap.Error(err))
 			break
 		}
@@ -269,8 +285,21 @@ func (listener *CarbonlinkListener) Addr() net.Addr {
 
 // Listen bind port. Receive messages and send to out channel
 func (listener *CarbonlinkListener) Listen(addr *net.TCPAddr) error {
+	return listener.listen(func() (net.Listener, error) {
+		return net.ListenTCP("tcp", addr)
+	})
+}
+
+// ListenSocket binds tcp address or unix socket "unix://<path>"
+func (listener *CarbonlinkListener) ListenSocket(listen string, permissions *socket.Permissions) error {
+	return listener.listen(func() (net.Listener, error) {
+		return socket.Listen(listen, permissions)
+	})
+}
+
+func (listener *CarbonlinkListener) listen(open func() (net.Listener, error)) error {
 	return listener.StartFunc(func() error {
-		tcpListener, err := net.ListenTCP("tcp", addr)
+		tcpListener, err := open()
 		if err != nil {
 			return err
 		}
@@ -284,11 +313,13 @@ func (listener *CarbonlinkListener) Listen(addr *net.TCPAddr) error {
 			}
 		})
 
+		l := tlsconfig.Listener(tcpListener, listener.tlsConfig)
+
 		listener.Go(func(exit chan bool) {
 			defer tcpListener.Close()
 
 			for {
-				conn, err := tcpListener.Accept()
+				conn, err := l.Accept()
 				if err != nil {
 					if strings.Contains(err.Error(), "use of closed network connection") {
 						break
@@ -57,6 +57,52 @@ func TestInFlight(t *testing.T) {
 	}
 }
 
+func TestAddWithConfirm(t *testing.T) {
+	var confirmed int
+
+	c := New()
+
+	c.AddWithConfirm(points.OnePoint("hello.world", 42, 10), func() { confirmed++ })
+	c.AddWithConfirm(points.OnePoint("hello.world", 43, 10), func() { confirmed++ })
+
+	p1 := c.WriteoutQueue().GetNotConfirmed(nil)
+	if len(p1.Data) != 2 {
+		t.FailNow()
+	}
+
+	// in flight, not written yet
+	c.AddWithConfirm(points.OnePoint("hello.world", 44, 10), func() { confirmed++ })
+	if confirmed != 0 {
+		t.FailNow()
+	}
+
+	c.Confirm(p1)
+	if confirmed != 2 {
+		t.FailNow()
+	}
+
+	p2 := c.WriteoutQueue().GetNotConfirmed(nil)
+	c.Confirm(p2)
+	if confirmed != 3 {
+		t.FailNow()
+	}
+
+	// points dropped by overflow are never confirmed
+	c.SetMaxSize(1)
+	c.Add(points.OnePoint("hello.world", 45, 10))
+	c.Add(points.OnePoint("hello.world", 46, 10))
+	c.AddWithConfirm(points.OnePoint("hello.world", 47, 10), func() { confirmed++ })
+	if confirmed != 3 {
+		t.FailNow()
+	}
+
+	p3 := c.WriteoutQueue().GetNotConfirmed(nil)
+	c.Confirm(p3)
+	if confirmed != 3 {
+		t.FailNow()
+	}
+}
+
 func BenchmarkPopNotConfirmed(b *testing.B) {
 	c := New()
 	p1 := points.OnePoint("hello.world", 42, 10)
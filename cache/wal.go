@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/zapwriter"
+)
+
+const walFilePrefix = "wal."
+const walFileSuffix = ".bin"
+
+// WAL is write-ahead log of all points added to cache. Log is split into segments.
+// Every cache entry holds reference to the oldest segment with its points.
+// Segment is removed when there are no references to it and to all previous segments
+type WAL struct {
+	sync.Mutex
+	dir           string
+	segmentSize   int64
+	flushInterval time.Duration
+	fsync         bool
+
+	current uint64        // id of segment opened for writing
+	file    *os.File      // current segment
+	writer  *bufio.Writer // current segment writer
+	written int64         // bytes written to current segment
+
+	closed []uint64       // closed segments not removed yet, sorted
+	refs   map[uint64]int // references from cache entries
+
+	replay []uint64 // segments left by previous run and not replayed yet, sorted. They are referenced until replay
+
+	exit   chan struct{}
+	done   chan struct{}
+	logger *zap.Logger
+
+	stat struct {
+		errors       uint32 // write and remove errors
+		writtenBytes uint32
+		removed      uint32 // removed segments count
+	}
+}
+
+func walSegmentFilename(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", walFilePrefix, id, walFileSuffix))
+}
+
+// NewWAL opens write-ahead log in dir. Segments found in dir should be replayed with Replay. Segment is flushed every
+// flushInterval, with fsync it is also synced to disk, so points survive crash of OS
+func NewWAL(dir string, segmentSize int64, flushInterval time.Duration, fsync bool) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAL{
+		dir:           dir,
+		segmentSize:   segmentSize,
+		flushInterval: flushInterval,
+		fsync:         fsync,
+		closed:        make([]uint64, 0),
+		refs:          make(map[uint64]int),
+		replay:        make([]uint64, 0),
+		exit:          make(chan struct{}),
+		done:          make(chan struct{}),
+		logger:        zapwriter.Logger("wal"),
+	}
+
+	var last uint64
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, walFilePrefix) || !strings.HasSuffix(name, walFileSuffix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walFilePrefix), walFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if id > last {
+			last = id
+		}
+
+		// segment is removed by truncate after its points are written by persister
+		w.replay = append(w.replay, id)
+		w.closed = append(w.closed, id)
+		w.refs[id]++
+	}
+
+	sort.Slice(w.replay, func(i, j int) bool { return w.replay[i] < w.replay[j] })
+	sort.Slice(w.closed, func(i, j int) bool { return w.closed[i] < w.closed[j] })
+
+	if err = w.open(last + 1); err != nil {
+		return nil, err
+	}
+
+	go w.flusher()
+
+	return w, nil
+}
+
+func (w *WAL) open(id uint64) error {
+	file, err := os.OpenFile(walSegmentFilename(w.dir, id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w.current = id
+	w.file = file
+	w.writer = bufio.NewWriterSize(file, 1048576) // 1Mb
+	w.written = 0
+	return nil
+}
+
+func (w *WAL) closeCurrent() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	w.writer = nil
+
+	return err
+}
+
+// sync flushes current segment and syncs it to disk if fsync is enabled. Called with locked mutex
+func (w *WAL) sync() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if w.fsync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *WAL) flusher() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.exit:
+			return
+		case <-ticker.C:
+			w.Lock()
+			if w.writer != nil {
+				if err := w.sync(); err != nil {
+					atomic.AddUint32(&w.stat.errors, 1)
+					w.logger.Error("flush failed", zap.Error(err))
+				}
+			}
+			w.Unlock()
+		}
+	}
+}
+
+// Write appends points to current segment and takes reference to it.
+// Reference is taken even if write failed
+func (w *WAL) Write(p *points.Points) (uint64, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	segment := w.current
+	w.refs[segment]++
+
+	if w.writer == nil {
+		atomic.AddUint32(&w.stat.errors, 1)
+		return segment, fmt.Errorf("wal is closed")
+	}
+
+	n, err := p.WriteBinaryTo(w.writer)
+	w.written += int64(n)
+	atomic.AddUint32(&w.stat.writtenBytes, uint32(n))
+
+	if err != nil {
+		atomic.AddUint32(&w.stat.errors, 1)
+		return segment, err
+	}
+
+	if w.written >= w.segmentSize {
+		w.rotate()
+	}
+
+	return segment, nil
+}
+
+// rotate closes current segment and opens next one. Called with locked mutex
+func (w *WAL) rotate() {
+	if err := w.closeCurrent(); err != nil {
+		atomic.AddUint32(&w.stat.errors, 1)
+		w.logger.Error("segment close failed", zap.Error(err))
+	}
+
+	w.closed = append(w.closed, w.current)
+
+	if err := w.open(w.current + 1); err != nil {
+		atomic.AddUint32(&w.stat.errors, 1)
+		w.logger.Error("segment create failed", zap.Error(err))
+	}
+
+	w.truncate()
+}
+
+// Release drops reference to segment taken by Write and removes unused segments
+func (w *WAL) Release(segment uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.refs[segment]--
+	if w.refs[segment] <= 0 {
+		delete(w.refs, segment)
+		w.truncate()
+	}
+}
+
+// truncate removes closed segments older than the oldest referenced one. Called with locked mutex
+func (w *WAL) truncate() {
+	min := w.current
+	for segment := range w.refs {
+		if segment < min {
+			min = segment
+		}
+	}
+
+	i := 0
+	for ; i < len(w.closed) && w.closed[i] < min; i++ {
+		filename := walSegmentFilename(w.dir, w.closed[i])
+		if err := os.Remove(filename); err != nil {
+			atomic.AddUint32(&w.stat.errors, 1)
+			w.logger.Error("remove failed", zap.String("filename", filename), zap.Error(err))
+			continue
+		}
+		atomic.AddUint32(&w.stat.removed, 1)
+	}
+
+	w.closed = w.closed[i:]
+}
+
+// Replay reads segments left by previous run. Points are passed to storeFunc with reference to their segment
+// (see Cache.Replay), storeFunc should release it once points are written or dropped. Segments are not written
+// again and are removed when all their points are released
+func (w *WAL) Replay(storeFunc func(p *points.Points, segment uint64)) {
+	for {
+		w.Lock()
+		if len(w.replay) == 0 {
+			w.Unlock()
+			return
+		}
+		segment := w.replay[0]
+		w.Unlock()
+
+		var pointsCount int
+		startTime := time.Now()
+		filename := walSegmentFilename(w.dir, segment)
+
+		err := points.ReadFromFile(filename, func(p *points.Points) {
+			pointsCount += len(p.Data)
+			w.Lock()
+			w.refs[segment]++
+			w.Unlock()
+			storeFunc(p, segment)
+		})
+
+		w.logger.Info("segment replayed",
+			zap.String("filename", filename),
+			zap.Int("points", pointsCount),
+			zap.Duration("runtime", time.Since(startTime)),
+			zap.Error(err),
+		)
+
+		w.Lock()
+		w.replay = w.replay[1:]
+		w.Unlock()
+		w.Release(segment)
+	}
+}
+
+// Discard closes wal and removes all segments except not replayed ones. Called after dump of cache, which holds all
+// points of segments, so they are not restored twice
+func (w *WAL) Discard() error {
+	err := w.Close()
+
+	w.Lock()
+	defer w.Unlock()
+
+	replay := make(map[uint64]bool)
+	for _, segment := range w.replay {
+		replay[segment] = true
+	}
+
+	segments := append(w.closed, w.current)
+	w.closed = make([]uint64, 0)
+	for _, segment := range segments {
+		if replay[segment] {
+			w.closed = append(w.closed, segment)
+			continue
+		}
+		filename := walSegmentFilename(w.dir, segment)
+		if rerr := os.Remove(filename); rerr != nil {
+			atomic.AddUint32(&w.stat.errors, 1)
+			w.logger.Error("remove failed", zap.String("filename", filename), zap.Error(rerr))
+			if err == nil {
+				err = rerr
+			}
+			continue
+		}
+		atomic.AddUint32(&w.stat.removed, 1)
+	}
+
+	return err
+}
+
+// Close flushes and closes current segment. Not removed segments will be replayed on next start
+func (w *WAL) Close() error {
+	w.Lock()
+	select {
+	case <-w.exit:
+		w.Unlock()
+		return nil
+	default:
+		close(w.exit)
+	}
+	err := w.closeCurrent()
+	w.Unlock()
+
+	<-w.done
+	return err
+}
+
+// Stat sends wal metrics to callback
+func (w *WAL) Stat(send helper.StatCallback) {
+	w.Lock()
+	segments := len(w.closed) + 1
+	w.Unlock()
+
+	send("walSegments", float64(segments))
+	helper.SendAndSubstractUint32("walErrors", &w.stat.errors, send)
+	helper.SendAndSubstractUint32("walWrittenBytes", &w.stat.writtenBytes, send)
+	helper.SendAndSubstractUint32("walRemovedSegments", &w.stat.removed, send)
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/lomik/go-carbon/helper/qa"
+	"github.com/lomik/go-carbon/points"
+	"github.com/stretchr/testify/assert"
+)
+
+func walFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+func TestWAL(t *testing.T) {
+	assert := assert.New(t)
+
+	qa.Root(t, func(root string) {
+		// rotate segment after every write
+		wal, err := NewWAL(root, 1, time.Second, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := New()
+		c.SetWAL(wal)
+
+		c.Add(points.OnePoint("m1", 1, 10))
+		c.Add(points.OnePoint("m2", 2, 10))
+		c.Add(points.OnePoint("m1", 3, 11))
+
+		assert.Equal([]string{
+			"wal.00000000000000000001.bin",
+			"wal.00000000000000000002.bin",
+			"wal.00000000000000000003.bin",
+			"wal.00000000000000000004.bin",
+		}, walFiles(t, root))
+
+		// not confirmed points keep segment
+		p, exists := c.PopNotConfirmed("m1")
+		assert.True(exists)
+		assert.Equal(4, len(walFiles(t, root)))
+
+		c.Confirm(p)
+		assert.Equal([]string{
+			"wal.00000000000000000002.bin",
+			"wal.00000000000000000003.bin",
+			"wal.00000000000000000004.bin",
+		}, walFiles(t, root))
+
+		_, exists = c.Pop("m2")
+		assert.True(exists)
+		assert.Equal([]string{
+			"wal.00000000000000000004.bin",
+		}, walFiles(t, root))
+
+		c.Add(points.OnePoint("m3", 4, 12))
+		c.Stop()
+
+		// restart
+		wal, err = NewWAL(root, 1024*1024, time.Second, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer wal.Close()
+
+		c = New()
+		c.SetWAL(wal)
+		wal.Replay(c.Replay)
+
+		// replayed points are not written to wal again, replayed segments are kept until points are persisted
+		assert.Equal([]string{
+			"wal.00000000000000000004.bin",
+			"wal.00000000000000000005.bin",
+			"wal.00000000000000000006.bin",
+		}, walFiles(t, root))
+
+		p, exists = c.Pop("m3")
+		assert.True(exists)
+		assert.Equal(points.OnePoint("m3", 4, 12), p)
+		assert.Equal([]string{
+			"wal.00000000000000000006.bin",
+		}, walFiles(t, root))
+
+		// cache is dumped, segments are not replayed on next start
+		c.Add(points.OnePoint("m4", 5, 13))
+		assert.NoError(wal.Discard())
+		assert.Equal([]string{}, walFiles(t, root))
+	})
+}
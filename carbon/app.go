@@ -1,6 +1,7 @@
 package carbon
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/url"
@@ -14,14 +15,22 @@ import (
 	"github.com/lomik/go-carbon/api"
 	"github.com/lomik/go-carbon/cache"
 	"github.com/lomik/go-carbon/carbonserver"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/socket"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
 	"github.com/lomik/go-carbon/persister"
+	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
+	"github.com/lomik/go-carbon/rules"
 	"github.com/lomik/go-carbon/tags"
 	"github.com/lomik/zapwriter"
 
 	// register receivers
 	_ "github.com/lomik/go-carbon/receiver/http"
 	_ "github.com/lomik/go-carbon/receiver/kafka"
+	_ "github.com/lomik/go-carbon/receiver/nats"
+	_ "github.com/lomik/go-carbon/receiver/prometheus"
 	_ "github.com/lomik/go-carbon/receiver/pubsub"
 	_ "github.com/lomik/go-carbon/receiver/tcp"
 	_ "github.com/lomik/go-carbon/receiver/udp"
@@ -43,6 +52,8 @@ type App struct {
 	Persister      *persister.Whisper
 	Carbonserver   *carbonserver.CarbonserverListener
 	Tags           *tags.Tags
+	Rules          *rules.Rules
+	Prometheus     *PrometheusExporter
 	Collector      *Collector // (!!!) Should be re-created on every change config/modules
 	exit           chan bool
 }
@@ -89,17 +100,72 @@ func (app *App) configure() error {
 			cfg.Whisper.Aggregation = persister.NewWhisperAggregation()
 		}
 	}
+	if cfg.Whisper.CreateOverflow != "drop" && cfg.Whisper.CreateOverflow != "keep" {
+		return fmt.Errorf("go-carbon support only \"drop\" or \"keep\" whisper.create-overflow")
+	}
+	if cfg.Whisper.CreateOverflow == "keep" && cfg.Whisper.CreateKeepMaxPoints <= 0 {
+		return fmt.Errorf("whisper.create-keep-max-points should be positive with create-overflow = \"keep\"")
+	}
+
 	if !(cfg.Cache.WriteStrategy == "max" ||
 		cfg.Cache.WriteStrategy == "sorted" ||
 		cfg.Cache.WriteStrategy == "noop") {
 		return fmt.Errorf("go-carbon support only \"max\", \"sorted\"  or \"noop\" write-strategy")
 	}
 
+	if cfg.Cache.Backpressure && !cfg.Whisper.Enabled {
+		return fmt.Errorf("cache.backpressure requires enabled whisper persister, otherwise receivers are blocked forever")
+	}
+
+	if cfg.Wal.Enabled {
+		if !cfg.Whisper.Enabled {
+			return fmt.Errorf("wal requires enabled whisper persister, otherwise wal segments are never removed")
+		}
+		if cfg.Wal.SegmentSizeMB <= 0 {
+			return fmt.Errorf("wal.segment-size-mb should be positive")
+		}
+		if cfg.Wal.FlushInterval.Value() <= 0 {
+			return fmt.Errorf("wal.flush-interval should be positive")
+		}
+	}
+
+	if cfg.Carbonserver.MaxFetchWorkers < 0 {
+		return fmt.Errorf("carbonserver.max-fetch-workers should not be negative")
+	}
+
+	if cfg.Carbonserver.FetchWorkersPerRequest <= 0 {
+		return fmt.Errorf("carbonserver.fetch-workers-per-request should be positive")
+	}
+
+	if cfg.Tags.TagDBType != tags.TagDBTypeHTTP && cfg.Tags.TagDBType != tags.TagDBTypeLocal {
+		return fmt.Errorf("go-carbon support only \"http\" or \"local\" tags.tagdb-type")
+	}
+
+	if _, err := rules.New(cfg.Rules); err != nil {
+		return err
+	}
+
+	if _, err := ratelimit.New(cfg.Limits); err != nil {
+		return err
+	}
+
+	for _, p := range []*socket.Permissions{
+		&cfg.Udp.Permissions,
+		&cfg.Tcp.Permissions,
+		&cfg.Pickle.Permissions,
+		&cfg.Carbonlink.Permissions,
+		&cfg.Carbonserver.Permissions,
+	} {
+		if err := p.Check(); err != nil {
+			return err
+		}
+	}
+
 	if cfg.Common.MetricEndpoint == "" {
 		cfg.Common.MetricEndpoint = MetricEndpointLocal
 	}
 
-	if cfg.Common.MetricEndpoint != MetricEndpointLocal {
+	if cfg.Common.MetricEndpoint != MetricEndpointLocal && cfg.Common.MetricEndpoint != MetricEndpointNone {
 		u, err := url.Parse(cfg.Common.MetricEndpoint)
 
 		if err != nil {
@@ -136,12 +202,34 @@ func (app *App) ReloadConfig() error {
 
 	runtime.GOMAXPROCS(app.Config.Common.MaxCPU)
 
+	// listeners are not restarted on reload, only certificates, tenant tokens, rules and rate limits are updated
+	if err = tlsconfig.Reload(); err != nil {
+		return err
+	}
+	if err = tenant.Reload(); err != nil {
+		return err
+	}
+
+	if app.Rules != nil {
+		if err = app.Rules.Update(app.Config.Rules); err != nil {
+			return err
+		}
+	}
+
+	if err = ratelimit.Configure(app.Config.Limits); err != nil {
+		return err
+	}
+
 	app.Cache.SetMaxSize(app.Config.Cache.MaxSize)
 	app.Cache.SetWriteStrategy(app.Config.Cache.WriteStrategy)
 	app.Cache.SetTagsEnabled(app.Config.Tags.Enabled)
+	app.Cache.SetBackpressure(app.Config.Cache.Backpressure)
 
+	// points parked over create budget are handed over to new persister
+	var parked []*points.Points
 	if app.Persister != nil {
 		app.Persister.Stop()
+		parked = app.Persister.Parked()
 		app.Persister = nil
 	}
 
@@ -150,7 +238,9 @@ func (app *App) ReloadConfig() error {
 		app.Tags = nil
 	}
 
-	app.startPersister()
+	if err = app.startPersister(parked); err != nil {
+		return err
+	}
 
 	if app.Collector != nil {
 		app.Collector.Stop()
@@ -197,6 +287,11 @@ func (app *App) stopListeners() {
 }
 
 func (app *App) stopAll() {
+	if app.Cache != nil {
+		// release receivers blocked by full cache
+		app.Cache.SetBackpressure(false)
+	}
+
 	app.stopListeners()
 
 	logger := zapwriter.Logger("app")
@@ -225,6 +320,12 @@ func (app *App) stopAll() {
 		logger.Debug("collector stopped")
 	}
 
+	if app.Prometheus != nil {
+		app.Prometheus.Stop()
+		app.Prometheus = nil
+		logger.Debug("prometheus exporter stopped")
+	}
+
 	if app.exit != nil {
 		close(app.exit)
 		app.exit = nil
@@ -239,14 +340,23 @@ func (app *App) Stop() {
 	app.stopAll()
 }
 
-func (app *App) startPersister() {
-	if app.Config.Tags.Enabled {
-		app.Tags = tags.New(&tags.Options{
-			LocalPath:      app.Config.Tags.LocalDir,
-			TagDB:          app.Config.Tags.TagDB,
-			TagDBTimeout:   app.Config.Tags.TagDBTimeout.Value(),
-			TagDBChunkSize: app.Config.Tags.TagDBChunkSize,
+// startPersister starts persister. parked are points held by previous persister over create budget, they are
+// confirmed without store if whisper is disabled
+func (app *App) startPersister(parked []*points.Points) error {
+	if app.Config.Tags.Enabled && (app.Config.Tags.TagDB != "" || app.Config.Tags.TagDBType == tags.TagDBTypeLocal) {
+		var err error
+		app.Tags, err = tags.New(&tags.Options{
+			LocalPath:       app.Config.Tags.LocalDir,
+			TagDBType:       app.Config.Tags.TagDBType,
+			TagDB:           app.Config.Tags.TagDB,
+			TagDBTimeout:    app.Config.Tags.TagDBTimeout.Value(),
+			TagDBChunkSize:  app.Config.Tags.TagDBChunkSize,
+			TagDBListen:     app.Config.Tags.TagDBListen,
+			TagDBWriteToken: app.Config.Tags.TagDBWriteToken,
 		})
+		if err != nil {
+			return err
+		}
 	}
 
 	if app.Config.Whisper.Enabled {
@@ -261,15 +371,38 @@ func (app *App) startPersister() {
 		p.SetSparse(app.Config.Whisper.Sparse)
 		p.SetFLock(app.Config.Whisper.FLock)
 		p.SetWorkers(app.Config.Whisper.Workers)
+		p.SetMaxCreatesPerMinute(app.Config.Whisper.MaxCreatesPerMinute, app.Config.Whisper.MaxCreatesPerPrefix)
+		if app.Config.Whisper.CreateOverflow == "keep" {
+			p.SetCreateKeep(app.Config.Whisper.CreateKeepMaxPoints)
+		}
+		p.Adopt(parked)
 
-		if app.Tags != nil {
+		if app.Config.Tags.Enabled {
 			p.SetTagsEnabled(true)
-			p.SetOnCreateTagged(app.Tags.Add)
+			p.SetOnCreateTagged(onCreateTagged(app.Tags, app.Carbonserver))
 		}
 
 		p.Start()
 
 		app.Persister = p
+	} else {
+		for _, values := range parked {
+			app.Cache.Confirm(values)
+		}
+	}
+
+	return nil
+}
+
+// onCreateTagged returns callback for new tagged whisper files. Series are sent to TagDB and to local tag index of carbonserver
+func onCreateTagged(t *tags.Tags, c *carbonserver.CarbonserverListener) func(string) {
+	return func(series string) {
+		if t != nil {
+			t.Add(series)
+		}
+		if c != nil {
+			c.AddTagged(series)
+		}
 	}
 }
 
@@ -292,9 +425,37 @@ func (app *App) Start() (err error) {
 	core.SetMaxSize(conf.Cache.MaxSize)
 	core.SetWriteStrategy(conf.Cache.WriteStrategy)
 	core.SetTagsEnabled(conf.Tags.Enabled)
+	core.SetBackpressure(conf.Cache.Backpressure)
+
+	if conf.Wal.Enabled {
+		var wal *cache.WAL
+		wal, err = cache.NewWAL(conf.Wal.Path, int64(conf.Wal.SegmentSizeMB)*1024*1024, conf.Wal.FlushInterval.Value(), conf.Wal.Fsync)
+		if err != nil {
+			return
+		}
+		core.SetWAL(wal)
+	}
 
 	app.Cache = core
 
+	// receivers store metrics through rules, restore from dump and WAL stores to cache directly
+	if app.Rules, err = rules.New(conf.Rules); err != nil {
+		return
+	}
+	store := app.Rules.Store(core.Add)
+	receiver.SetOverloaded(core.Backpressure)
+	if conf.Whisper.Enabled {
+		// kafka commits offsets of points written by persister
+		receiver.SetConfirmedStore(app.Rules.StoreWithConfirm(core.AddWithConfirm))
+	} else {
+		receiver.SetConfirmedStore(nil)
+	}
+
+	// limits of tcp, udp and http receivers
+	if err = ratelimit.Configure(conf.Limits); err != nil {
+		return
+	}
+
 	/* API start */
 	if conf.Grpc.Enabled {
 		var grpcAddr *net.TCPAddr
@@ -304,6 +465,21 @@ func (app *App) Start() (err error) {
 		}
 
 		grpcApi := api.New(core)
+		grpcApi.SetStore(app.Rules.Admit(core.Admit))
+
+		if conf.Grpc.TenantsFile != "" {
+			var tenants *tenant.Tenants
+			if tenants, err = tenant.Load(conf.Grpc.TenantsFile); err != nil {
+				return
+			}
+			grpcApi.SetTenants(tenants)
+		}
+
+		var tlsConfig *tls.Config
+		if tlsConfig, err = tlsconfig.New(&conf.Grpc.Options); err != nil {
+			return
+		}
+		grpcApi.SetTLSConfig(tlsConfig)
 
 		if err = grpcApi.Listen(grpcAddr); err != nil {
 			return
@@ -313,10 +489,6 @@ func (app *App) Start() (err error) {
 	}
 	/* API end */
 
-	/* WHISPER and TAGS start */
-	app.startPersister()
-	/* WHISPER and TAGS end */
-
 	app.Receivers = make([]*NamedReceiver, 0)
 	var rcv receiver.Receiver
 	var rcvOptions map[string]interface{}
@@ -327,7 +499,7 @@ func (app *App) Start() (err error) {
 			return
 		}
 
-		if rcv, err = receiver.New("udp", rcvOptions, core.Add); err != nil {
+		if rcv, err = receiver.New("udp", rcvOptions, store); err != nil {
 			return
 		}
 
@@ -344,7 +516,7 @@ func (app *App) Start() (err error) {
 			return
 		}
 
-		if rcv, err = receiver.New("tcp", rcvOptions, core.Add); err != nil {
+		if rcv, err = receiver.New("tcp", rcvOptions, store); err != nil {
 			return
 		}
 
@@ -361,7 +533,7 @@ func (app *App) Start() (err error) {
 			return
 		}
 
-		if rcv, err = receiver.New("pickle", rcvOptions, core.Add); err != nil {
+		if rcv, err = receiver.New("pickle", rcvOptions, store); err != nil {
 			return
 		}
 
@@ -374,7 +546,7 @@ func (app *App) Start() (err error) {
 
 	/* CUSTOM RECEIVERS start */
 	for receiverName, receiverOptions := range conf.Receiver {
-		if rcv, err = receiver.New(receiverName, receiverOptions, core.Add); err != nil {
+		if rcv, err = receiver.New(receiverName, receiverOptions, store); err != nil {
 			return
 		}
 
@@ -409,29 +581,62 @@ func (app *App) Start() (err error) {
 		carbonserver.SetGraphiteWeb10(conf.Carbonserver.GraphiteWeb10StrictMode)
 		carbonserver.SetInternalStatsDir(conf.Carbonserver.InternalStatsDir)
 		carbonserver.SetPercentiles(conf.Carbonserver.Percentiles)
+		carbonserver.SetDeleteToken(conf.Carbonserver.DeleteToken)
+		carbonserver.SetMaxFetchWorkers(conf.Carbonserver.MaxFetchWorkers)
+		carbonserver.SetFetchWorkersPerRequest(conf.Carbonserver.FetchWorkersPerRequest)
+		carbonserver.SetCacheDelete(func(key string) { core.Pop(key) })
+
+		var tlsConfig *tls.Config
+		if tlsConfig, err = tlsconfig.New(&conf.Carbonserver.Options); err != nil {
+			return
+		}
+		carbonserver.SetTLSConfig(tlsConfig)
+
+		if conf.Carbonserver.TenantsFile != "" {
+			var tenants *tenant.Tenants
+			if tenants, err = tenant.Load(conf.Carbonserver.TenantsFile); err != nil {
+				return
+			}
+			carbonserver.SetTenants(tenants)
+		}
 		// carbonserver.SetQueryTimeout(conf.Carbonserver.QueryTimeout.Value())
 
+		carbonserver.SetSocketPermissions(&conf.Carbonserver.Permissions)
+
 		if err = carbonserver.Listen(conf.Carbonserver.Listen); err != nil {
 			return
 		}
 
+		if conf.Carbonserver.GRPCListen != "" {
+			if err = carbonserver.ListenGRPC(conf.Carbonserver.GRPCListen); err != nil {
+				return
+			}
+		}
+
 		app.Carbonserver = carbonserver
 	}
 	/* CARBONSERVER end */
 
+	/* WHISPER and TAGS start */
+	// after carbonserver for feed its tag index
+	if err = app.startPersister(nil); err != nil {
+		return
+	}
+	/* WHISPER and TAGS end */
+
 	/* CARBONLINK start */
 	if conf.Carbonlink.Enabled {
-		var linkAddr *net.TCPAddr
-		linkAddr, err = net.ResolveTCPAddr("tcp", conf.Carbonlink.Listen)
-		if err != nil {
-			return
-		}
-
 		carbonlink := cache.NewCarbonlinkListener(core)
 		carbonlink.SetReadTimeout(conf.Carbonlink.ReadTimeout.Value())
+
+		var tlsConfig *tls.Config
+		if tlsConfig, err = tlsconfig.New(&conf.Carbonlink.Options); err != nil {
+			return
+		}
+		carbonlink.SetTLSConfig(tlsConfig)
 		// carbonlink.SetQueryTimeout(conf.Carbonlink.QueryTimeout.Value())
 
-		if err = carbonlink.Listen(linkAddr); err != nil {
+		if err = carbonlink.ListenSocket(conf.Carbonlink.Listen, &conf.Carbonlink.Permissions); err != nil {
 			return
 		}
 
@@ -440,11 +645,27 @@ func (app *App) Start() (err error) {
 	/* CARBONLINK end */
 
 	/* RESTORE start */
-	if conf.Dump.Enabled {
-		go app.Restore(core.Add, conf.Dump.Path, conf.Dump.RestorePerSecond)
+	if conf.Dump.Enabled || conf.Wal.Enabled {
+		dumpPath := ""
+		if conf.Dump.Enabled {
+			dumpPath = conf.Dump.Path
+		}
+		go app.Restore(core, dumpPath, conf.Dump.RestorePerSecond)
 	}
 	/* RESTORE end */
 
+	/* PROMETHEUS start */
+	if conf.Prometheus.Enabled {
+		prometheus := NewPrometheusExporter()
+
+		if err = prometheus.Listen(conf.Prometheus.Listen); err != nil {
+			return
+		}
+
+		app.Prometheus = prometheus
+	}
+	/* PROMETHEUS end */
+
 	/* COLLECTOR start */
 	app.Collector = NewCollector(app)
 	/* COLLECTOR end */
@@ -35,6 +35,14 @@ func RuntimeStat(send helper.StatCallback) {
 	send("NumGoroutine", float64(runtime.NumGoroutine()))
 }
 
+// runtimeStat declares type of RuntimeStat stats
+type runtimeStat struct{}
+
+// StatType returns type of stat sent by RuntimeStat
+func (runtimeStat) StatType(metric string) helper.StatType {
+	return helper.StatGauge
+}
+
 func NewCollector(app *App) *Collector {
 	// app locked by caller
 
@@ -58,9 +66,11 @@ func NewCollector(app *App) *Collector {
 
 	logger = logger.With(zap.String("endpoint", c.endpoint))
 
-	if c.endpoint == MetricEndpointLocal {
-		// sender worker
-		storeFunc := app.Cache.Add
+	if c.endpoint == MetricEndpointNone {
+		// stats are exposed only by prometheus exporter
+	} else if c.endpoint == MetricEndpointLocal {
+		// sender worker. Stats are dropped if cache is full, collector is not blocked by backpressure
+		storeFunc := app.Cache.TryAdd
 
 		c.Go(func(exit chan bool) {
 			for {
@@ -136,8 +146,16 @@ func NewCollector(app *App) *Collector {
 
 	}
 
-	sendCallback := func(moduleName string) func(metric string, value float64) {
+	sendCallback := func(moduleName string, promSend helper.StatCallback) func(metric string, value float64) {
 		return func(metric string, value float64) {
+			if promSend != nil {
+				promSend(metric, value)
+			}
+
+			if c.endpoint == MetricEndpointNone {
+				return
+			}
+
 			key := fmt.Sprintf("%s.%s.%s", c.graphPrefix, moduleName, metric)
 			logger.Info("collect", zap.String("metric", key), zap.Float64("value", value))
 			select {
@@ -150,40 +168,53 @@ func NewCollector(app *App) *Collector {
 		}
 	}
 
-	moduleCallback := func(moduleName string, moduleObj statModule) statFunc {
+	promCallback := func(moduleName string, receiverName string, moduleObj interface{}) helper.StatCallback {
+		if app.Prometheus == nil {
+			return nil
+		}
+		return app.Prometheus.Callback(moduleName, receiverName, statTypeOf(moduleObj))
+	}
+
+	moduleCallback := func(moduleName string, moduleObj statModule, promSend helper.StatCallback) statFunc {
 		return func() {
-			moduleObj.Stat(sendCallback(moduleName))
+			moduleObj.Stat(sendCallback(moduleName, promSend))
 		}
 	}
 
 	c.stats = append(c.stats, func() {
-		RuntimeStat(sendCallback("runtime"))
+		RuntimeStat(sendCallback("runtime", promCallback("runtime", "", runtimeStat{})))
 	})
 
 	if app.Cache != nil {
-		c.stats = append(c.stats, moduleCallback("cache", app.Cache))
+		c.stats = append(c.stats, moduleCallback("cache", app.Cache, promCallback("cache", "", app.Cache)))
 	}
 
 	if app.Carbonserver != nil {
-		c.stats = append(c.stats, moduleCallback("carbonserver", app.Carbonserver))
+		c.stats = append(c.stats, moduleCallback("carbonserver", app.Carbonserver,
+			promCallback("carbonserver", "", app.Carbonserver)))
 	}
 
 	if app.Receivers != nil {
 		for i := 0; i < len(app.Receivers); i++ {
-			c.stats = append(c.stats, moduleCallback(app.Receivers[i].Name, app.Receivers[i]))
+			c.stats = append(c.stats, moduleCallback(app.Receivers[i].Name, app.Receivers[i],
+				promCallback("receiver", app.Receivers[i].Name, app.Receivers[i].Receiver)))
 		}
 	}
 
 	if app.Persister != nil {
-		c.stats = append(c.stats, moduleCallback("persister", app.Persister))
+		c.stats = append(c.stats, moduleCallback("persister", app.Persister, promCallback("persister", "", app.Persister)))
 	}
 
 	if app.Api != nil {
-		c.stats = append(c.stats, moduleCallback("grpc", app.Api))
+		c.stats = append(c.stats, moduleCallback("grpc", app.Api, promCallback("grpc", "", app.Api)))
 	}
 
 	if app.Tags != nil {
-		c.stats = append(c.stats, moduleCallback("tags", app.Tags))
+		c.stats = append(c.stats, moduleCallback("tags", app.Tags, promCallback("tags", "", app.Tags)))
+	}
+
+	if app.Rules != nil {
+		c.stats = append(c.stats, moduleCallback("rules", app.Rules, promCallback("rules", "", app.Rules)))
 	}
 
 	// collector worker
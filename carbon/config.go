@@ -10,13 +10,18 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/socket"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
 	"github.com/lomik/go-carbon/persister"
 	"github.com/lomik/go-carbon/receiver/tcp"
 	"github.com/lomik/go-carbon/receiver/udp"
+	"github.com/lomik/go-carbon/rules"
 	"github.com/lomik/zapwriter"
 )
 
 const MetricEndpointLocal = "local"
+const MetricEndpointNone = "none"
 
 // Duration wrapper time.Duration for TOML
 type Duration struct {
@@ -60,6 +65,10 @@ type whisperConfig struct {
 	MaxUpdatesPerSecond int    `toml:"max-updates-per-second"`
 	Sparse              bool   `toml:"sparse-create"`
 	FLock               bool   `toml:"flock"`
+	MaxCreatesPerMinute int    `toml:"max-creates-per-minute"`
+	MaxCreatesPerPrefix int    `toml:"max-creates-per-minute-per-prefix"`
+	CreateOverflow      string `toml:"create-overflow"`
+	CreateKeepMaxPoints int    `toml:"create-keep-max-points"`
 	Enabled             bool   `toml:"enabled"`
 	Schemas             persister.WhisperSchemas
 	Aggregation         *persister.WhisperAggregation
@@ -68,17 +77,22 @@ type whisperConfig struct {
 type cacheConfig struct {
 	MaxSize       uint32 `toml:"max-size"`
 	WriteStrategy string `toml:"write-strategy"`
+	Backpressure  bool   `toml:"backpressure"`
 }
 
 type carbonlinkConfig struct {
 	Listen      string    `toml:"listen"`
 	Enabled     bool      `toml:"enabled"`
 	ReadTimeout *Duration `toml:"read-timeout"`
+	tlsconfig.Options
+	socket.Permissions
 }
 
 type grpcConfig struct {
-	Listen  string `toml:"listen"`
-	Enabled bool   `toml:"enabled"`
+	Listen      string `toml:"listen"`
+	Enabled     bool   `toml:"enabled"`
+	TenantsFile string `toml:"tenants-file"`
+	tlsconfig.Options
 }
 
 type receiverConfig struct {
@@ -86,15 +100,19 @@ type receiverConfig struct {
 }
 
 type tagsConfig struct {
-	Enabled        bool      `toml:"enabled"`
-	TagDB          string    `toml:"tagdb-url"`
-	TagDBTimeout   *Duration `toml:"tagdb-timeout"`
-	TagDBChunkSize int       `toml:"tagdb-chunk-size"`
-	LocalDir       string    `toml:"local-dir"`
+	Enabled         bool      `toml:"enabled"`
+	TagDBType       string    `toml:"tagdb-type"`
+	TagDB           string    `toml:"tagdb-url"`
+	TagDBTimeout    *Duration `toml:"tagdb-timeout"`
+	TagDBChunkSize  int       `toml:"tagdb-chunk-size"`
+	TagDBListen     string    `toml:"tagdb-listen"`
+	TagDBWriteToken string    `toml:"tagdb-write-token"`
+	LocalDir        string    `toml:"local-dir"`
 }
 
 type carbonserverConfig struct {
 	Listen                  string    `toml:"listen"`
+	GRPCListen              string    `toml:"grpc-listen"`
 	Enabled                 bool      `toml:"enabled"`
 	ReadTimeout             *Duration `toml:"read-timeout"`
 	IdleTimeout             *Duration `toml:"idle-timeout"`
@@ -111,6 +129,12 @@ type carbonserverConfig struct {
 	GraphiteWeb10StrictMode bool      `toml:"graphite-web-10-strict-mode"`
 	InternalStatsDir        string    `toml:"internal-stats-dir"`
 	Percentiles             []int     `toml:"stats-percentiles"`
+	DeleteToken             string    `toml:"delete-token"`
+	TenantsFile             string    `toml:"tenants-file"`
+	MaxFetchWorkers         int       `toml:"max-fetch-workers"`
+	FetchWorkersPerRequest  int       `toml:"fetch-workers-per-request"`
+	tlsconfig.Options
+	socket.Permissions
 }
 
 type pprofConfig struct {
@@ -118,6 +142,19 @@ type pprofConfig struct {
 	Enabled bool   `toml:"enabled"`
 }
 
+type prometheusConfig struct {
+	Listen  string `toml:"listen"`
+	Enabled bool   `toml:"enabled"`
+}
+
+type walConfig struct {
+	Enabled       bool      `toml:"enabled"`
+	Path          string    `toml:"path"`
+	SegmentSizeMB int       `toml:"segment-size-mb"`
+	FlushInterval *Duration `toml:"flush-interval"`
+	Fsync         bool      `toml:"fsync"`
+}
+
 type dumpConfig struct {
 	Enabled          bool   `toml:"enabled"`
 	Path             string `toml:"path"`
@@ -133,12 +170,16 @@ type Config struct {
 	Tcp          *tcp.Options                        `toml:"tcp"`
 	Pickle       *tcp.FramingOptions                 `toml:"pickle"`
 	Receiver     map[string](map[string]interface{}) `toml:"receiver"`
+	Limits       *ratelimit.Options                  `toml:"limits"`
 	Carbonlink   carbonlinkConfig                    `toml:"carbonlink"`
 	Grpc         grpcConfig                          `toml:"grpc"`
 	Tags         tagsConfig                          `toml:"tags"`
 	Carbonserver carbonserverConfig                  `toml:"carbonserver"`
+	Wal          walConfig                           `toml:"wal"`
 	Dump         dumpConfig                          `toml:"dump"`
 	Pprof        pprofConfig                         `toml:"pprof"`
+	Prometheus   prometheusConfig                    `toml:"prometheus"`
+	Rules        []rules.Rule                        `toml:"rules"`
 	Logging      []zapwriter.Config                  `toml:"logging"`
 }
 
@@ -169,6 +210,8 @@ func NewConfig() *Config {
 			Workers:             1,
 			Sparse:              false,
 			FLock:               false,
+			CreateOverflow:      "drop",
+			CreateKeepMaxPoints: 100000,
 		},
 		Cache: cacheConfig{
 			MaxSize:       1000000,
@@ -177,6 +220,7 @@ func NewConfig() *Config {
 		Udp:    udp.NewOptions(),
 		Tcp:    tcp.NewOptions(),
 		Pickle: tcp.NewFramingOptions(),
+		Limits: ratelimit.NewOptions(),
 		Carbonserver: carbonserverConfig{
 			Listen:            "127.0.0.1:8080",
 			Enabled:           false,
@@ -201,6 +245,8 @@ func NewConfig() *Config {
 			FindCacheEnabled:        true,
 			TrigramIndex:            true,
 			GraphiteWeb10StrictMode: true,
+			MaxFetchWorkers:         32,
+			FetchWorkersPerRequest:  8,
 		},
 		Carbonlink: carbonlinkConfig{
 			Listen:  "127.0.0.1:7002",
@@ -214,18 +260,32 @@ func NewConfig() *Config {
 			Enabled: true,
 		},
 		Tags: tagsConfig{
-			Enabled: false,
-			TagDB:   "http://127.0.0.1:8000",
+			Enabled:   false,
+			TagDBType: "http",
+			TagDB:     "http://127.0.0.1:8000",
 			TagDBTimeout: &Duration{
 				Duration: time.Second,
 			},
 			TagDBChunkSize: 32,
+			TagDBListen:    "127.0.0.1:7009",
 			LocalDir:       "/var/lib/graphite/tagging/",
 		},
 		Pprof: pprofConfig{
 			Listen:  "127.0.0.1:7007",
 			Enabled: false,
 		},
+		Prometheus: prometheusConfig{
+			Listen:  "127.0.0.1:7008",
+			Enabled: false,
+		},
+		Wal: walConfig{
+			Enabled:       false,
+			Path:          "/var/lib/graphite/wal/",
+			SegmentSizeMB: 64,
+			FlushInterval: &Duration{
+				Duration: time.Second,
+			},
+		},
 		Dump: dumpConfig{
 			Path: "/var/lib/graphite/dump/",
 		},
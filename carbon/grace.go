@@ -13,6 +13,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/lomik/go-carbon/cache"
 	"github.com/lomik/go-carbon/persister"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/zapwriter"
@@ -108,6 +109,13 @@ func (app *App) DumpStop() error {
 		return err
 	}
 
+	// points of wal segments are in dump now, otherwise they are restored twice
+	if wal := app.Cache.WAL(); wal != nil {
+		if err = wal.Discard(); err != nil {
+			logger.Info("wal discard failed", zap.Error(err))
+		}
+	}
+
 	// cache dump finished
 
 	logger.Info("dump finished")
@@ -238,21 +246,33 @@ FilesLoop:
 	}
 }
 
-// Restore from dump.path
-func (app *App) Restore(storeFunc func(*points.Points), path string, rps int) {
+// Restore replays wal segments of cache left by previous run (if wal is enabled) and then dump.path (if path is not
+// empty). Replayed points are not written to wal again, cache entries hold references to replayed segments
+func (app *App) Restore(c *cache.Cache, path string, rps int) {
+	throttle := func(p *points.Points) {}
+
 	if rps > 0 {
 		ticker := persister.NewThrottleTicker(rps)
 		defer ticker.Stop()
 
-		throttledStoreFunc := func(p *points.Points) {
+		throttle = func(p *points.Points) {
 			for i := 0; i < len(p.Data); i++ {
 				<-ticker.C
 			}
-			storeFunc(p)
 		}
+	}
+
+	if wal := c.WAL(); wal != nil {
+		wal.Replay(func(p *points.Points, segment uint64) {
+			throttle(p)
+			c.Replay(p, segment)
+		})
+	}
 
-		app.RestoreFromDir(path, throttledStoreFunc)
-	} else {
-		app.RestoreFromDir(path, storeFunc)
+	if path != "" {
+		app.RestoreFromDir(path, func(p *points.Points) {
+			throttle(p)
+			c.Add(p)
+		})
 	}
 }
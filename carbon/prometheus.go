@@ -0,0 +1,200 @@
+package carbon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lomik/go-carbon/helper"
+)
+
+// statTypeOf returns StatType of module. Stats of modules without declared types are counters
+func statTypeOf(module interface{}) func(metric string) helper.StatType {
+	if t, ok := module.(helper.StatTyper); ok {
+		return t.StatType
+	}
+	return func(metric string) helper.StatType {
+		return helper.StatCounter
+	}
+}
+
+// promName converts stat name to prometheus snake_case name: "queueBuildTimeMs" -> "queue_build_time_ms"
+func promName(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+			if i > 0 && ((s[i-1] >= 'a' && s[i-1] <= 'z') || (s[i-1] >= '0' && s[i-1] <= '9')) {
+				b.WriteByte('_')
+			}
+			b.WriteByte(c - 'A' + 'a')
+		case (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func promLabelValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return strings.Replace(s, `"`, `\"`, -1)
+}
+
+type promMetric struct {
+	name   string
+	labels string
+	typ    helper.StatType
+	value  float64
+}
+
+// PrometheusExporter keeps stats collected by Collector and serves them in Prometheus text format.
+// It lives for the whole application lifetime, so counters are not reset on config reload
+type PrometheusExporter struct {
+	sync.Mutex
+	metrics  map[string]*promMetric
+	listener *net.TCPListener
+	server   *http.Server
+	closed   chan struct{}
+}
+
+// NewPrometheusExporter create new instance of PrometheusExporter
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{
+		metrics: make(map[string]*promMetric),
+	}
+}
+
+// Callback returns StatCallback which stores stats of module.
+// Stats of receivers are exposed as carbon_receiver_* with "receiver" label.
+// statType returns type of stat declared by module, see statTypeOf
+func (e *PrometheusExporter) Callback(module string, receiverName string, statType func(metric string) helper.StatType) helper.StatCallback {
+	prefix := "carbon_" + promName(module) + "_"
+	labels := ""
+	if receiverName != "" {
+		prefix = "carbon_receiver_"
+		labels = fmt.Sprintf("{receiver=\"%s\"}", promLabelValue(receiverName))
+	}
+
+	return func(metric string, value float64) {
+		typ := statType(metric)
+		name := prefix + promName(metric)
+		if typ != helper.StatGauge {
+			name += "_total"
+		}
+		key := name + labels
+
+		e.Lock()
+		m, ok := e.metrics[key]
+		if !ok || m.typ != typ {
+			m = &promMetric{name: name, labels: labels, typ: typ}
+			e.metrics[key] = m
+		}
+		if typ == helper.StatCounter {
+			m.value += value
+		} else {
+			m.value = value
+		}
+		e.Unlock()
+	}
+}
+
+// writeText writes all stats in Prometheus text format
+func (e *PrometheusExporter) writeText(w io.Writer) {
+	e.Lock()
+	list := make([]promMetric, 0, len(e.metrics))
+	for _, m := range e.metrics {
+		list = append(list, *m)
+	}
+	e.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].name != list[j].name {
+			return list[i].name < list[j].name
+		}
+		return list[i].labels < list[j].labels
+	})
+
+	for i := 0; i < len(list); i++ {
+		if i == 0 || list[i].name != list[i-1].name {
+			typ := "counter"
+			if list[i].typ == helper.StatGauge {
+				typ = "gauge"
+			}
+			fmt.Fprintf(w, "# TYPE %s %s\n", list[i].name, typ)
+		}
+		fmt.Fprintf(w, "%s%s %s\n", list[i].name, list[i].labels, strconv.FormatFloat(list[i].value, 'g', -1, 64))
+	}
+}
+
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	e.writeText(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// Listen starts HTTP server with /metrics endpoint
+func (e *PrometheusExporter) Listen(listen string) error {
+	addr, err := net.ResolveTCPAddr("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	tcpListener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+
+	s := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	closed := make(chan struct{})
+
+	e.listener = tcpListener
+	e.server = s
+	e.closed = closed
+
+	go func() {
+		s.Serve(tcpListener)
+		close(closed)
+	}()
+
+	return nil
+}
+
+// Addr returns binded socket address. For bind port 0 in tests
+func (e *PrometheusExporter) Addr() net.Addr {
+	if e.listener == nil {
+		return nil
+	}
+	return e.listener.Addr()
+}
+
+// Stop HTTP server
+func (e *PrometheusExporter) Stop() {
+	if e.server == nil {
+		return
+	}
+	e.server.Close()
+	<-e.closed
+	e.server = nil
+	e.listener = nil
+}
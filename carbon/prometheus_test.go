@@ -0,0 +1,96 @@
+package carbon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/cache"
+	"github.com/lomik/go-carbon/carbonserver"
+	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/receiver/kafka"
+	"github.com/lomik/go-carbon/receiver/tcp"
+)
+
+func TestPromName(t *testing.T) {
+	table := map[string]string{
+		"metricsReceived":          "metrics_received",
+		"queueBuildTimeMs":         "queue_build_time_ms",
+		"GOMAXPROCS":               "gomaxprocs",
+		"NumGoroutine":             "num_goroutine",
+		"request_codes.render.2xx": "request_codes_render_2xx",
+		"tagdbSendFail":            "tagdb_send_fail",
+	}
+
+	for in, expected := range table {
+		assert.Equal(t, expected, promName(in), in)
+	}
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	assert := assert.New(t)
+
+	e := NewPrometheusExporter()
+	assert.NoError(e.Listen("localhost:0"))
+	defer e.Stop()
+
+	// gauge sent without reset of value
+	queueWriteoutTime := uint32(7)
+
+	// types of stats are declared by modules
+	cacheStat := statTypeOf(cache.New())
+	tcpStat := statTypeOf(&tcp.TCP{})
+	kafkaStat := statTypeOf(&kafka.Kafka{})
+	listener := carbonserver.NewCarbonserverListener(nil)
+	listener.SetMetricsAsCounters(true)
+	carbonserverStat := statTypeOf(listener)
+
+	for i := 0; i < 2; i++ {
+		cache := e.Callback("cache", "", cacheStat)
+		cache("size", float64(100+i))
+		cache("overflow", 2)
+		helper.SendUint32("queueWriteoutTime", &queueWriteoutTime, cache)
+
+		tcp := e.Callback("receiver", "tcp", tcpStat)
+		tcp("metricsReceived", 10)
+		tcp("active", 1)
+
+		kafka := e.Callback("receiver", "kafka\"2", kafkaStat)
+		kafka("metricsReceived", 5)
+
+		carbonserver := e.Callback("carbonserver", "", carbonserverStat)
+		carbonserver("render_requests", float64(3+i))
+		carbonserver("request_time_99th_percentile_ns", 42)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", e.Addr()))
+	if !assert.NoError(err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	expected := `# TYPE carbon_cache_overflow_total counter
+carbon_cache_overflow_total 4
+# TYPE carbon_cache_queue_writeout_time gauge
+carbon_cache_queue_writeout_time 7
+# TYPE carbon_cache_size gauge
+carbon_cache_size 101
+# TYPE carbon_carbonserver_render_requests_total counter
+carbon_carbonserver_render_requests_total 4
+# TYPE carbon_carbonserver_request_time_99th_percentile_ns gauge
+carbon_carbonserver_request_time_99th_percentile_ns 42
+# TYPE carbon_receiver_active gauge
+carbon_receiver_active{receiver="tcp"} 1
+# TYPE carbon_receiver_metrics_received_total counter
+carbon_receiver_metrics_received_total{receiver="kafka\"2"} 10
+carbon_receiver_metrics_received_total{receiver="tcp"} 20
+`
+	assert.Equal(expected, string(body))
+}
@@ -0,0 +1,130 @@
+package carbonserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	whisper "github.com/go-graphite/go-whisper"
+)
+
+// archive selection modes of render request
+const (
+	archiveAuto  = iota // first archive covering from time, same as whisper does
+	archiveIndex        // archive by index, 0 is the most precise one
+	archiveStep         // the most precise archive with step not less than requested
+	archiveAll          // all archives, one series per archive
+)
+
+// archiveOptions select archives of whisper files read by render request. Zero value selects archive by from time
+type archiveOptions struct {
+	mode  int
+	index int
+	step  int
+}
+
+// parseArchiveOptions reads archive=<index>|all and step=<seconds> params of render request
+func parseArchiveOptions(req *http.Request) (archiveOptions, error) {
+	return newArchiveOptions(req.FormValue("archive"), req.FormValue("step"))
+}
+
+// newArchiveOptions parses archive and step params. Empty string - param is not set
+func newArchiveOptions(archive, step string) (archiveOptions, error) {
+	var opts archiveOptions
+
+	if archive != "" && step != "" {
+		return opts, errors.New("archive and step can't be used together")
+	}
+
+	switch {
+	case archive == "all":
+		opts.mode = archiveAll
+	case archive != "":
+		n, err := strconv.Atoi(archive)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid archive %#v", archive)
+		}
+		opts.mode = archiveIndex
+		opts.index = n
+	case step != "":
+		n, err := strconv.Atoi(step)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid step %#v", step)
+		}
+		opts.mode = archiveStep
+		opts.step = n
+	}
+
+	return opts, nil
+}
+
+// cacheKey is part of query cache key
+func (opts archiveOptions) cacheKey() string {
+	switch opts.mode {
+	case archiveIndex:
+		return fmt.Sprintf("&archive=%d", opts.index)
+	case archiveStep:
+		return fmt.Sprintf("&step=%d", opts.step)
+	case archiveAll:
+		return "&archive=all"
+	}
+	return ""
+}
+
+// selectArchives returns indexes of archives to read. Archives which don't contain untilTime are skipped
+func (opts archiveOptions) selectArchives(retentions []whisper.Retention, now, untilTime int32) ([]int, error) {
+	covers := func(i int) bool {
+		return now-int32(retentions[i].MaxRetention()) < untilTime
+	}
+
+	var indexes []int
+	switch opts.mode {
+	case archiveIndex:
+		if opts.index >= len(retentions) {
+			return nil, fmt.Errorf("archive %d not found", opts.index)
+		}
+		indexes = []int{opts.index}
+	case archiveStep:
+		for i, retention := range retentions {
+			if retention.SecondsPerPoint() >= opts.step {
+				indexes = []int{i}
+				break
+			}
+		}
+		if indexes == nil {
+			return nil, fmt.Errorf("archive with step %d not found", opts.step)
+		}
+	case archiveAll:
+		for i := range retentions {
+			if covers(i) {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+
+	if len(indexes) == 0 || !covers(indexes[0]) {
+		return nil, errors.New("Can't find proper archive")
+	}
+	return indexes, nil
+}
+
+// archiveReadFrom returns from time for whisper Fetch which reads archive with index. Whisper reads first archive
+// covering now - fromTime, so from time is moved back before end of previous archive. Values before requested from
+// time are dropped after read
+func archiveReadFrom(retentions []whisper.Retention, index int, now, fromTime int32) int32 {
+	readFrom := fromTime
+
+	// +1 second is reserved for tick of clock before whisper reads time
+	if maxRetention := int32(retentions[index].MaxRetention()); now-readFrom >= maxRetention {
+		readFrom = now - maxRetention + 1
+	}
+
+	if index > 0 {
+		if prevRetention := int32(retentions[index-1].MaxRetention()); now-readFrom <= prevRetention {
+			readFrom = now - prevRetention - 1
+		}
+	}
+
+	return readFrom
+}
@@ -0,0 +1,112 @@
+package carbonserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	whisper "github.com/go-graphite/go-whisper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArchiveOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		url      string
+		expected archiveOptions
+		cacheKey string
+	}{
+		{"/render/?target=m", archiveOptions{}, ""},
+		{"/render/?target=m&archive=1", archiveOptions{mode: archiveIndex, index: 1}, "&archive=1"},
+		{"/render/?target=m&archive=all", archiveOptions{mode: archiveAll}, "&archive=all"},
+		{"/render/?target=m&step=3600", archiveOptions{mode: archiveStep, step: 3600}, "&step=3600"},
+	}
+
+	for _, tc := range tests {
+		opts, err := parseArchiveOptions(httptest.NewRequest("GET", tc.url, nil))
+		if assert.NoError(err, tc.url) {
+			assert.Equal(tc.expected, opts, tc.url)
+			assert.Equal(tc.cacheKey, opts.cacheKey(), tc.url)
+		}
+	}
+
+	for _, url := range []string{
+		"/render/?archive=-1",
+		"/render/?archive=first",
+		"/render/?step=0",
+		"/render/?step=1h",
+		"/render/?archive=0&step=60",
+	} {
+		_, err := parseArchiveOptions(httptest.NewRequest("GET", url, nil))
+		assert.Error(err, url)
+	}
+
+	_, err := parseRenderOptions(httptest.NewRequest("GET", "/render/?archive=all&aggregate=sumSeries", nil))
+	assert.Error(err)
+}
+
+func TestSelectArchives(t *testing.T) {
+	assert := assert.New(t)
+
+	// 1m:1d, 1h:30d, 1d:1y
+	retentions := []whisper.Retention{
+		whisper.NewRetention(60, 1440),
+		whisper.NewRetention(3600, 720),
+		whisper.NewRetention(86400, 365),
+	}
+	now := int32(1000000000)
+	day := int32(86400)
+
+	tests := []struct {
+		opts     archiveOptions
+		until    int32
+		expected []int
+	}{
+		{archiveOptions{mode: archiveIndex, index: 1}, now, []int{1}},
+		{archiveOptions{mode: archiveStep, step: 60}, now, []int{0}},
+		{archiveOptions{mode: archiveStep, step: 600}, now, []int{1}},
+		{archiveOptions{mode: archiveStep, step: 86400}, now, []int{2}},
+		{archiveOptions{mode: archiveAll}, now, []int{0, 1, 2}},
+		{archiveOptions{mode: archiveAll}, now - 7*day, []int{1, 2}},
+	}
+
+	for _, tc := range tests {
+		indexes, err := tc.opts.selectArchives(retentions, now, tc.until)
+		if assert.NoError(err, "%#v", tc.opts) {
+			assert.Equal(tc.expected, indexes, "%#v", tc.opts)
+		}
+	}
+
+	for _, opts := range []archiveOptions{
+		{mode: archiveIndex, index: 3},
+		{mode: archiveStep, step: 7 * 86400},
+		{mode: archiveIndex, index: 0},
+	} {
+		_, err := opts.selectArchives(retentions, now, now-2*day)
+		assert.Error(err, "%#v", opts)
+	}
+
+	_, err := archiveOptions{mode: archiveAll}.selectArchives(retentions, now, now-400*day)
+	assert.Error(err)
+}
+
+func TestArchiveReadFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	retentions := []whisper.Retention{
+		whisper.NewRetention(60, 1440),
+		whisper.NewRetention(3600, 720),
+	}
+	now := int32(1000000000)
+	day := int32(86400)
+
+	// first archive is read as is
+	assert.Equal(now-3600, archiveReadFrom(retentions, 0, now, now-3600))
+	// second archive covers range, but first archive too
+	assert.Equal(now-day-1, archiveReadFrom(retentions, 1, now, now-3600))
+	// only second archive covers range
+	assert.Equal(now-7*day, archiveReadFrom(retentions, 1, now, now-7*day))
+	// range is older than archive
+	assert.Equal(now-day+1, archiveReadFrom(retentions, 0, now, now-7*day))
+	assert.Equal(now-30*day+1, archiveReadFrom(retentions, 1, now, now-60*day))
+}
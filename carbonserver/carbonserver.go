@@ -19,6 +19,7 @@ package carbonserver
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -47,13 +48,18 @@ import (
 	whisper "github.com/go-graphite/go-whisper"
 	"github.com/lomik/go-carbon/helper"
 	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+	"github.com/lomik/go-carbon/helper/socket"
 	"github.com/lomik/go-carbon/helper/stat"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
 	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/tags"
 	pickle "github.com/lomik/og-rek"
 	"github.com/lomik/zapwriter"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"google.golang.org/grpc"
 )
 
 type metricStruct struct {
@@ -88,6 +94,12 @@ type metricStruct struct {
 	QueryCacheMiss       uint64
 	FindCacheHit         uint64
 	FindCacheMiss        uint64
+	DeleteRequests       uint64
+	DeleteErrors         uint64
+	MetricsDeleted       uint64
+	TagsRequests         uint64
+	TagsErrors           uint64
+	TenantAuthErrors     uint64
 }
 
 type requestsTimes struct {
@@ -128,6 +140,8 @@ var statusCodes = map[string][]uint64{
 	"render":   make([]uint64, 5),
 	"details":  make([]uint64, 5),
 	"info":     make([]uint64, 5),
+	"delete":   make([]uint64, 5),
+	"tags":     make([]uint64, 5),
 }
 
 type responseWriterWithStatus struct {
@@ -226,6 +240,7 @@ func (q *queryCache) getQueryItem(k string, size uint64, expire int32) *QueryIte
 type CarbonserverListener struct {
 	helper.Stoppable
 	cacheGet          func(key string) []points.Point
+	cacheDelete       func(key string)
 	readTimeout       time.Duration
 	idleTimeout       time.Duration
 	writeTimeout      time.Duration
@@ -237,12 +252,21 @@ type CarbonserverListener struct {
 	scanFrequency     time.Duration
 	forceScanChan     chan struct{}
 	metricsAsCounters bool
-	tcpListener       *net.TCPListener
+	tcpListener       net.Listener
+	grpcListener      net.Listener
+	grpcServer        *grpc.Server
+	tlsConfig         *tls.Config
+	socketPermissions *socket.Permissions
+	tenants           *tenant.Tenants
 	logger            *zap.Logger
 	accessLogger      *zap.Logger
 	graphiteweb10     bool
 	internalStatsDir  string
 	flock             bool
+	deleteToken       string
+
+	fetchWorkers           chan struct{} // limits parallel whisper reads of all requests
+	fetchWorkersPerRequest int
 
 	queryCacheEnabled bool
 	queryCacheSizeMB  int
@@ -251,6 +275,8 @@ type CarbonserverListener struct {
 	findCache         queryCache
 	trigramIndex      bool
 
+	cacheGeneration uint64 // changed on metrics delete, part of find and query cache keys
+
 	fileIdx      atomic.Value
 	fileIdxMutex sync.Mutex
 
@@ -277,6 +303,7 @@ type fileIndex struct {
 	idx     trigram.Index
 	files   []string
 	details map[string]*pb.MetricDetails
+	tags    *tagIndex // series from _tagged directory
 
 	accessTimes map[string]int64
 	freeSpace   uint64
@@ -295,6 +322,9 @@ func NewCarbonserverListener(cacheGetFunc func(key string) []points.Point) *Carb
 		trigramIndex:      true,
 		graphiteweb10:     false,
 		percentiles:       []int{100, 99, 98, 95, 75, 50},
+
+		fetchWorkers:           make(chan struct{}, 32),
+		fetchWorkersPerRequest: 8,
 	}
 }
 
@@ -355,6 +385,40 @@ func (listener *CarbonserverListener) SetPercentiles(percentiles []int) {
 	listener.percentiles = percentiles
 }
 
+// SetDeleteToken enables /metrics/delete/ endpoint authenticated with token
+func (listener *CarbonserverListener) SetDeleteToken(token string) {
+	listener.deleteToken = token
+}
+
+// SetMaxFetchWorkers sets max count of parallel whisper reads of all render requests. 0 - unlimited
+func (listener *CarbonserverListener) SetMaxFetchWorkers(workers int) {
+	if workers > 0 {
+		listener.fetchWorkers = make(chan struct{}, workers)
+	} else {
+		listener.fetchWorkers = nil
+	}
+}
+
+// SetFetchWorkersPerRequest sets max count of parallel whisper reads of one render request
+func (listener *CarbonserverListener) SetFetchWorkersPerRequest(workers int) {
+	listener.fetchWorkersPerRequest = workers
+}
+
+// SetTLSConfig enables TLS on listener. nil disables TLS
+func (listener *CarbonserverListener) SetTLSConfig(config *tls.Config) {
+	listener.tlsConfig = config
+}
+
+// SetSocketPermissions sets mode and owner of unix socket file if listen is "unix://<path>"
+func (listener *CarbonserverListener) SetSocketPermissions(permissions *socket.Permissions) {
+	listener.socketPermissions = permissions
+}
+
+// SetCacheDelete sets callback for drop deleted metrics from cache
+func (listener *CarbonserverListener) SetCacheDelete(cacheDeleteFunc func(key string)) {
+	listener.cacheDelete = cacheDeleteFunc
+}
+
 func (listener *CarbonserverListener) CurrentFileIndex() *fileIndex {
 	p := listener.fileIdx.Load()
 	if p == nil {
@@ -436,6 +500,7 @@ func (listener *CarbonserverListener) updateFileList(dir string) {
 
 	var files []string
 	details := make(map[string]*pb.MetricDetails)
+	tagIdx := newTagIndex()
 
 	metricsKnown := uint64(0)
 	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
@@ -451,6 +516,9 @@ func (listener *CarbonserverListener) updateFileList(dir string) {
 			files = append(files, trimmedName)
 			if hasSuffix {
 				metricsKnown++
+				if strings.HasPrefix(trimmedName, "/_tagged/") {
+					tagIdx.add(strings.Replace(info.Name()[:len(info.Name())-4], "_DOT_", ".", -1))
+				}
 				trimmedName = strings.Replace(trimmedName[1:len(trimmedName)-4], "/", ".", -1)
 				details[trimmedName] = &pb.MetricDetails{
 					Size_:   i.RealSize,
@@ -522,6 +590,7 @@ func (listener *CarbonserverListener) updateFileList(dir string) {
 		idx:         idx,
 		files:       files,
 		details:     details,
+		tags:        tagIdx,
 		freeSpace:   freeSpace,
 		totalSpace:  totalSpace,
 		accessTimes: oldAccessTimes,
@@ -535,6 +604,7 @@ func (listener *CarbonserverListener) updateFileList(dir string) {
 		zap.Int("files", len(files)),
 		zap.Int("index_size", indexSize),
 		zap.Int("pruned_trigrams", pruned),
+		zap.Int("tagged_series", tagIdx.len()),
 	)
 }
 
@@ -684,6 +754,31 @@ func (listener *CarbonserverListener) expandGlobs(query string) ([]string, []boo
 	return files, leafs, nil
 }
 
+// expandTarget returns metrics for render target. Target is glob, seriesByTag call or tagged series name
+func (listener *CarbonserverListener) expandTarget(target string) ([]string, []bool, error) {
+	var files []string
+
+	if tags.IsSeriesByTag(target) {
+		exprs, err := tags.ParseSeriesByTag(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		if files, err = listener.findSeriesByTag(exprs); err != nil {
+			return nil, nil, err
+		}
+	} else if strings.IndexByte(target, ';') >= 0 {
+		files = []string{target}
+	} else {
+		return listener.expandGlobs(target)
+	}
+
+	leafs := make([]bool, len(files))
+	for i := range leafs {
+		leafs[i] = true
+	}
+	return files, leafs, nil
+}
+
 var errMaxGlobsExhausted = fmt.Errorf("maxGlobs in request exhausted, kindly refusing to perform the request")
 var errMetricsListEmpty = fmt.Errorf("File index is empty or disabled")
 
@@ -749,6 +844,8 @@ func (listener *CarbonserverListener) detailsHandler(wr http.ResponseWriter, req
 
 	var b []byte
 
+	tenantName := requestTenant(req)
+
 	switch format {
 	case "json":
 		response := jsonMetricDetailsResponse{
@@ -756,7 +853,7 @@ func (listener *CarbonserverListener) detailsHandler(wr http.ResponseWriter, req
 			TotalSpace: fidx.totalSpace,
 		}
 		listener.fileIdxMutex.Lock()
-		for m, v := range fidx.details {
+		for m, v := range tenantDetails(tenantName, fidx.details) {
 			response.Metrics = append(response.Metrics, metricDetailsFlat{
 				Name:          m,
 				MetricDetails: v,
@@ -767,7 +864,7 @@ func (listener *CarbonserverListener) detailsHandler(wr http.ResponseWriter, req
 	case "protobuf", "protobuf3":
 		listener.fileIdxMutex.Lock()
 		response := &pb.MetricDetailsResponse{
-			Metrics:    fidx.details,
+			Metrics:    tenantDetails(tenantName, fidx.details),
 			FreeSpace:  fidx.freeSpace,
 			TotalSpace: fidx.totalSpace,
 		}
@@ -836,6 +933,10 @@ func (listener *CarbonserverListener) listHandler(wr http.ResponseWriter, req *h
 		return
 	}
 
+	if tenantName := requestTenant(req); tenantName != "" {
+		metrics = tenantStripList(tenantName, metrics)
+	}
+
 	var b []byte
 	response := &pb.ListMetricsResponse{Metrics: metrics}
 	switch format {
@@ -884,8 +985,6 @@ func (listener *CarbonserverListener) findHandler(wr http.ResponseWriter, req *h
 	format := req.FormValue("format")
 	query := req.FormValue("query")
 
-	var response *findResponse
-
 	logger := TraceContextToZap(ctx, listener.logger.With(
 		zap.String("handler", "find"),
 		zap.String("url", req.URL.RequestURI()),
@@ -925,32 +1024,12 @@ func (listener *CarbonserverListener) findHandler(wr http.ResponseWriter, req *h
 		return
 	}
 
-	var err error
-	fromCache := false
-	if listener.findCacheEnabled {
-		key := query + "&" + format
-		size := uint64(100 * 1024 * 1024)
-		item := listener.findCache.getQueryItem(key, size, 300)
-		res, ok := item.FetchOrLock()
-		if !ok {
-			logger.Debug("find cache miss")
-			atomic.AddUint64(&listener.metrics.FindCacheMiss, 1)
-			response, err = listener.findMetrics(logger, t0, format, query)
-			if err != nil {
-				item.StoreAbort()
-			} else {
-				item.StoreAndUnlock(response)
-			}
-		} else if res != nil {
-			logger.Debug("query cache hit")
-			atomic.AddUint64(&listener.metrics.FindCacheHit, 1)
-			response = res.(*findResponse)
-			fromCache = true
-		}
-	} else {
-		response, err = listener.findMetrics(logger, t0, format, query)
+	tenantName := requestTenant(req)
+	if tenantName != "" {
+		query = tenant.Prefix(tenantName, query)
 	}
 
+	response, fromCache, err := listener.findWithCache(logger, t0, format, query, tenantName)
 	if response == nil {
 		accessLogger.Error("find failed",
 			zap.Duration("runtime_seconds", time.Since(t0)),
@@ -981,9 +1060,43 @@ func (listener *CarbonserverListener) findHandler(wr http.ResponseWriter, req *h
 	return
 }
 
+// findWithCache returns response of find query from find cache if it is enabled. Response could be non nil
+// together with findMetricsNoMetricsError
+func (listener *CarbonserverListener) findWithCache(logger *zap.Logger, t0 time.Time, format, query string, tenantName string) (*findResponse, bool, error) {
+	if !listener.findCacheEnabled {
+		response, err := listener.findMetrics(logger, t0, format, query, tenantName)
+		return response, false, err
+	}
+
+	var response *findResponse
+	var err error
+	fromCache := false
+
+	key := fmt.Sprintf("%s&%s&%d", query, format, atomic.LoadUint64(&listener.cacheGeneration))
+	size := uint64(100 * 1024 * 1024)
+	item := listener.findCache.getQueryItem(key, size, 300)
+	res, ok := item.FetchOrLock()
+	if !ok {
+		logger.Debug("find cache miss")
+		atomic.AddUint64(&listener.metrics.FindCacheMiss, 1)
+		response, err = listener.findMetrics(logger, t0, format, query, tenantName)
+		if err != nil {
+			item.StoreAbort()
+		} else {
+			item.StoreAndUnlock(response)
+		}
+	} else if res != nil {
+		logger.Debug("query cache hit")
+		atomic.AddUint64(&listener.metrics.FindCacheHit, 1)
+		response = res.(*findResponse)
+		fromCache = true
+	}
+	return response, fromCache, err
+}
+
 var findMetricsNoMetricsError = fmt.Errorf("no metrics available for this query")
 
-func (listener *CarbonserverListener) findMetrics(logger *zap.Logger, t0 time.Time, format, name string) (*findResponse, error) {
+func (listener *CarbonserverListener) findMetrics(logger *zap.Logger, t0 time.Time, format, name string, tenantName string) (*findResponse, error) {
 	var result findResponse
 	files, leafs, err := listener.expandGlobs(name)
 	if err != nil {
@@ -997,6 +1110,14 @@ func (listener *CarbonserverListener) findMetrics(logger *zap.Logger, t0 time.Ti
 		return nil, err
 	}
 
+	if tenantName != "" {
+		// name and files are returned relative to tenant root
+		name, _ = tenant.Strip(tenantName, name)
+		for i := range files {
+			files[i], _ = tenant.Strip(tenantName, files[i])
+		}
+	}
+
 	metricsCount := uint64(0)
 	for i := range files {
 		if leafs[i] {
@@ -1078,9 +1199,20 @@ func (listener *CarbonserverListener) findMetrics(logger *zap.Logger, t0 time.Ti
 
 func (listener *CarbonserverListener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 	// URL: /render/?target=the.metric.name&format=pickle&from=1396008021&until=1396022421
+	// Optional: &maxDataPoints=100&consolidateBy=sum&aggregate=sumSeries
+	// Archives of whisper files: &archive=1, &archive=all or &step=3600
+	// Streaming of json and protobuf3: &stream=1
 	t0 := time.Now()
 	ctx := req.Context()
 
+	// response can't be written after write-timeout, so there is no reason to read whisper files longer
+	if listener.writeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, listener.writeTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+
 	atomic.AddUint64(&listener.metrics.RenderRequests, 1)
 
 	req.ParseForm()
@@ -1140,7 +1272,35 @@ func (listener *CarbonserverListener) renderHandler(wr http.ResponseWriter, req
 		return
 	}
 
-	response, fromCache, err := listener.fetchWithCache(logger, format, targets, from, until)
+	opts, err := parseRenderOptions(req)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+		accessLogger.Error("fetch failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "invalid render options"),
+			zap.Int("http_code", http.StatusBadRequest),
+			zap.Error(err),
+		)
+		http.Error(wr, fmt.Sprintf("Bad request (%s)", err),
+			http.StatusBadRequest)
+		return
+	}
+
+	tenantName := requestTenant(req)
+	if tenantName != "" {
+		scoped := make([]string, len(targets))
+		for i, target := range targets {
+			scoped[i] = tenant.Prefix(tenantName, target)
+		}
+		targets = scoped
+	}
+
+	if req.FormValue("stream") == "1" {
+		listener.renderStream(wr, req, t0, logger, accessLogger, format, targets, from, until, tenantName, opts)
+		return
+	}
+
+	response, fromCache, err := listener.fetchWithCache(ctx, logger, format, targets, from, until, tenantName, opts)
 
 	wr.Header().Set("Content-Type", response.contentType)
 	if err != nil {
@@ -1173,11 +1333,7 @@ func (listener *CarbonserverListener) renderHandler(wr http.ResponseWriter, req
 
 }
 
-func (listener *CarbonserverListener) fetchWithCache(logger *zap.Logger, format string, targets []string, from, until string) (fetchResponse, bool, error) {
-	logger = logger.With(
-		zap.String("function", "fetchWithCache"),
-	)
-	fromCache := false
+func parseFromUntil(logger *zap.Logger, from, until string) (int32, int32, error) {
 	var badTime bool
 
 	i, err := strconv.Atoi(from)
@@ -1194,14 +1350,32 @@ func (listener *CarbonserverListener) fetchWithCache(logger *zap.Logger, format
 	untilTime := int32(i)
 
 	if badTime {
+		return 0, 0, errors.New("Bad request (invalid from/until time)")
+	}
+	return fromTime, untilTime, nil
+}
+
+// queryCacheKey returns key of render response in query cache. Responses cached before metrics delete are not used
+func (listener *CarbonserverListener) queryCacheKey(targets []string, format, from, until string, opts renderOptions) string {
+	return fmt.Sprintf("%s&%s&%s&%s%s&%d", strings.Join(targets, "&"), format, from, until, opts.cacheKey(),
+		atomic.LoadUint64(&listener.cacheGeneration))
+}
+
+func (listener *CarbonserverListener) fetchWithCache(ctx context.Context, logger *zap.Logger, format string, targets []string, from, until string, tenantName string, opts renderOptions) (fetchResponse, bool, error) {
+	logger = logger.With(
+		zap.String("function", "fetchWithCache"),
+	)
+	fromCache := false
+
+	fromTime, untilTime, err := parseFromUntil(logger, from, until)
+	if err != nil {
 		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
-		err = errors.New("Bad request (invalid from/until time)")
 		return fetchResponse{nil, "application/text", 0, 0, 0, nil}, fromCache, err
 	}
 
 	var response fetchResponse
 	if listener.queryCacheEnabled {
-		key := strings.Join(targets, "&") + "&" + format + "&" + from + "&" + until
+		key := listener.queryCacheKey(targets, format, from, until, opts)
 		size := uint64(100 * 1024 * 1024)
 		renderRequests := atomic.LoadUint64(&listener.metrics.RenderRequests)
 		fetchSize := atomic.LoadUint64(&listener.metrics.FetchSize)
@@ -1213,7 +1387,7 @@ func (listener *CarbonserverListener) fetchWithCache(logger *zap.Logger, format
 		if !ok {
 			logger.Debug("query cache miss")
 			atomic.AddUint64(&listener.metrics.QueryCacheMiss, 1)
-			response, err = listener.prepareData(format, targets, fromTime, untilTime)
+			response, err = listener.prepareData(ctx, format, targets, fromTime, untilTime, tenantName, opts)
 			if err != nil {
 				item.StoreAbort()
 			} else {
@@ -1226,12 +1400,12 @@ func (listener *CarbonserverListener) fetchWithCache(logger *zap.Logger, format
 			fromCache = true
 		}
 	} else {
-		response, err = listener.prepareData(format, targets, fromTime, untilTime)
+		response, err = listener.prepareData(ctx, format, targets, fromTime, untilTime, tenantName, opts)
 	}
 	return response, fromCache, err
 }
 
-func (listener *CarbonserverListener) prepareData(format string, targets []string, fromTime, untilTime int32) (fetchResponse, error) {
+func (listener *CarbonserverListener) prepareData(ctx context.Context, format string, targets []string, fromTime, untilTime int32, tenantName string, opts renderOptions) (fetchResponse, error) {
 	contentType := "application/text"
 	var b []byte
 	var err error
@@ -1240,9 +1414,11 @@ func (listener *CarbonserverListener) prepareData(format string, targets []strin
 	var valuesFetched int
 
 	var multi pb.MultiFetchResponse
+	// fetched metrics, differs from names of response if series are aggregated
+	var metrics []string
 	for _, metric := range targets {
 		listener.logger.Debug("fetching data...")
-		files, leafs, err := listener.expandGlobs(metric)
+		files, leafs, err := listener.expandTarget(metric)
 		if err != nil {
 			listener.logger.Debug("expand globs returned an error",
 				zap.Error(err),
@@ -1265,27 +1441,50 @@ func (listener *CarbonserverListener) prepareData(format string, targets []strin
 			zap.Int32("until", untilTime),
 		)
 
-		res, err := listener.fetchDataPB(metric, files, leafs, fromTime, untilTime)
+		res, err := listener.fetchDataPB(ctx, metric, files, leafs, fromTime, untilTime, opts.archives)
 		if err != nil {
 			atomic.AddUint64(&listener.metrics.RenderErrors, 1)
 			listener.logger.Error("error while fetching the data",
 				zap.Error(err),
 			)
+			if ctx.Err() != nil {
+				// request is cancelled or timed out, incomplete response should not be cached
+				return fetchResponse{nil, contentType, 0, 0, 0, nil}, err
+			}
 			continue
 		}
 
+		for i := range res.Metrics {
+			metrics = append(metrics, res.Metrics[i].Name)
+			memoryUsed += res.Metrics[i].Size()
+			valuesFetched += len(res.Metrics[i].Values)
+			if tenantName != "" {
+				// access times are tracked by full names, response contains names relative to tenant root
+				res.Metrics[i].Name, _ = tenant.Strip(tenantName, res.Metrics[i].Name)
+			}
+		}
+
+		if opts.aggregate != "" && len(res.Metrics) > 0 {
+			name := metric
+			if tenantName != "" {
+				name, _ = tenant.Strip(tenantName, metric)
+			}
+			res.Metrics = []*pb.FetchResponse{
+				aggregateSeries(opts.aggregate+"("+name+")", res.Metrics, seriesFuncs[opts.aggregate]),
+			}
+		}
+
 		multi.Metrics = append(multi.Metrics, res.Metrics...)
 	}
 	if len(multi.Metrics) == 0 {
 		return fetchResponse{nil, contentType, 0, 0, 0, nil}, err
 	}
 
-	var metrics []string
-	metricsFetched = len(multi.Metrics)
-	for i := range multi.Metrics {
-		metrics = append(metrics, multi.Metrics[i].Name)
-		memoryUsed += multi.Metrics[i].Size()
-		valuesFetched += len(multi.Metrics[i].Values)
+	metricsFetched = len(metrics)
+	if opts.maxDataPoints > 0 {
+		for i := range multi.Metrics {
+			consolidate(multi.Metrics[i], opts.maxDataPoints, consolidateFuncs[opts.consolidateBy])
+		}
 	}
 
 	switch format {
@@ -1311,6 +1510,11 @@ func (listener *CarbonserverListener) prepareData(format string, targets []strin
 			m["step"] = metric.StepTime
 			m["end"] = metric.StopTime
 			m["name"] = metric.Name
+			if metric.Retention != nil {
+				m["archive"] = metric.Archive
+				m["secondsPerPoint"] = metric.Retention.SecondsPerPoint
+				m["numberOfPoints"] = metric.Retention.NumberOfPoints
+			}
 
 			mv := make([]interface{}, len(metric.Values))
 			for i, p := range metric.Values {
@@ -1339,10 +1543,25 @@ func (listener *CarbonserverListener) prepareData(format string, targets []strin
 }
 
 func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime, untilTime int32) (*pb.FetchResponse, error) {
+	responses, err := listener.fetchArchives(metric, fromTime, untilTime, archiveOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return responses[0], nil
+}
+
+// fetchArchives reads archives of metric selected by archives. Series of archive selected by from time are returned
+// without archive metadata
+func (listener *CarbonserverListener) fetchArchives(metric string, fromTime, untilTime int32, archives archiveOptions) ([]*pb.FetchResponse, error) {
 	var step int32
 
 	// We need to obtain the metadata from whisper file anyway.
-	path := listener.whisperData + "/" + strings.Replace(metric, ".", "/", -1) + ".wsp"
+	var path string
+	if strings.IndexByte(metric, ';') >= 0 {
+		path = tags.FilePath(listener.whisperData, metric) + ".wsp"
+	} else {
+		path = listener.whisperData + "/" + strings.Replace(metric, ".", "/", -1) + ".wsp"
+	}
 	w, err := whisper.OpenWithOptions(path, &whisper.Options{
 		FLock: listener.flock,
 	})
@@ -1353,6 +1572,7 @@ func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime,
 		listener.logger.Error("open error", zap.String("path", path), zap.Error(err))
 		return nil, errors.New("Can't open metric")
 	}
+	defer w.Close()
 
 	logger := listener.logger.With(
 		zap.String("path", path),
@@ -1362,6 +1582,38 @@ func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime,
 
 	retentions := w.Retentions()
 	now := int32(time.Now().Unix())
+
+	if archives.mode != archiveAuto {
+		indexes, err := archives.selectArchives(retentions, now, untilTime)
+		if err != nil {
+			atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+			logger.Warn("can't select archive for the request", zap.Error(err))
+			return nil, err
+		}
+
+		responses := make([]*pb.FetchResponse, 0, len(indexes))
+		for _, index := range indexes {
+			readFrom := archiveReadFrom(retentions, index, now, fromTime)
+			// points of cache are not aggregated, so they are merged only to the most precise archive
+			response, err := listener.readArchive(w, metric, fromTime, untilTime, readFrom, index == 0, logger)
+			if err != nil {
+				return nil, err
+			}
+			if response.StepTime != int32(retentions[index].SecondsPerPoint()) {
+				atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+				logger.Warn("whisper returned unexpected archive", zap.Int("archive", index))
+				return nil, errors.New("Can't read archive")
+			}
+			response.Archive = int32(index)
+			response.Retention = &pb.Retention{
+				SecondsPerPoint: int32(retentions[index].SecondsPerPoint()),
+				NumberOfPoints:  int32(retentions[index].NumberOfPoints()),
+			}
+			responses = append(responses, response)
+		}
+		return responses, nil
+	}
+
 	diff := now - fromTime
 	bestStep := int32(retentions[0].SecondsPerPoint())
 	for _, retention := range retentions {
@@ -1382,13 +1634,25 @@ func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime,
 		step = maxRetention
 	}
 
-	var cacheData []points.Point
 	if step != bestStep {
 		logger.Debug("cache is not supported for this query (required step != best step)",
 			zap.Int("step", int(step)),
 			zap.Int("bestStep", int(bestStep)),
 		)
-	} else {
+	}
+
+	response, err := listener.readArchive(w, metric, fromTime, untilTime, fromTime, step == bestStep, logger)
+	if err != nil {
+		return nil, err
+	}
+	return []*pb.FetchResponse{response}, nil
+}
+
+// readArchive reads range of whisper file starting from readFrom. Whisper reads first archive covering
+// now - readFrom, values before fromTime are dropped
+func (listener *CarbonserverListener) readArchive(w *whisper.Whisper, metric string, fromTime, untilTime, readFrom int32, withCache bool, logger *zap.Logger) (*pb.FetchResponse, error) {
+	var cacheData []points.Point
+	if withCache {
 		// query cache
 		cacheStartTime := time.Now()
 		cacheData = listener.cacheGet(metric)
@@ -1399,8 +1663,7 @@ func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime,
 	logger.Debug("fetching disk metric")
 	atomic.AddUint64(&listener.metrics.DiskRequests, 1)
 	diskStartTime := time.Now()
-	points, err := w.Fetch(int(fromTime), int(untilTime))
-	w.Close()
+	points, err := w.Fetch(int(readFrom), int(untilTime))
 	if err != nil {
 		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
 		logger.Warn("failed to fetch points", zap.Error(err))
@@ -1416,9 +1679,20 @@ func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime,
 	atomic.AddUint64(&listener.metrics.MetricsReturned, 1)
 	values := points.Values()
 
-	fromTime = int32(points.FromTime())
+	step := int32(points.Step())
 	untilTime = int32(points.UntilTime())
-	step = int32(points.Step())
+	readFrom = int32(points.FromTime())
+
+	// whisper returns points starting from the next interval after requested time
+	if start := fromTime - fromTime%step + step; readFrom < start {
+		skip := int((start - readFrom) / step)
+		if skip > len(values) {
+			skip = len(values)
+		}
+		values = values[skip:]
+		readFrom += int32(skip) * step
+	}
+	fromTime = readFrom
 
 	waitTime := uint64(time.Since(diskStartTime).Nanoseconds())
 	atomic.AddUint64(&listener.metrics.DiskWaitTimeNS, waitTime)
@@ -1468,18 +1742,25 @@ func (listener *CarbonserverListener) fetchSingleMetric(metric string, fromTime,
 	return &response, nil
 }
 
-func (listener *CarbonserverListener) fetchDataPB(metric string, files []string, leafs []bool, fromTime, untilTime int32) (*pb.MultiFetchResponse, error) {
+func (listener *CarbonserverListener) fetchDataPB(ctx context.Context, metric string, files []string, leafs []bool, fromTime, untilTime int32, archives archiveOptions) (*pb.MultiFetchResponse, error) {
 	var multi pb.MultiFetchResponse
+
+	metrics := make([]string, 0, len(files))
 	for i, metric := range files {
 		if !leafs[i] {
 			listener.logger.Debug("skipping directory", zap.String("metric", metric))
 			// can't fetch a directory
 			continue
 		}
-		response, err := listener.fetchSingleMetric(metric, fromTime, untilTime)
-		if err == nil {
-			multi.Metrics = append(multi.Metrics, response)
-		}
+		metrics = append(metrics, metric)
+	}
+
+	err := listener.fetchMetrics(ctx, metrics, fromTime, untilTime, archives, func(response *pb.FetchResponse) error {
+		multi.Metrics = append(multi.Metrics, response)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &multi, nil
 }
@@ -1518,9 +1799,7 @@ func (listener *CarbonserverListener) infoHandler(wr http.ResponseWriter, req *h
 		return
 	}
 
-	path := listener.whisperData + "/" + strings.Replace(metric, ".", "/", -1) + ".wsp"
-	w, err := whisper.Open(path)
-
+	response, err := listener.metricInfo(metric, requestTenant(req))
 	if err != nil {
 		atomic.AddUint64(&listener.metrics.NotFound, 1)
 		accessLogger.Error("info served",
@@ -1532,31 +1811,7 @@ func (listener *CarbonserverListener) infoHandler(wr http.ResponseWriter, req *h
 		return
 	}
 
-	defer w.Close()
-
-	aggr := w.AggregationMethod()
-	maxr := int32(w.MaxRetention())
-	xfiles := float32(w.XFilesFactor())
-
 	var b []byte
-	rets := make([]*pb.Retention, 0, 4)
-	for _, retention := range w.Retentions() {
-		spp := int32(retention.SecondsPerPoint())
-		nop := int32(retention.NumberOfPoints())
-		rets = append(rets, &pb.Retention{
-			SecondsPerPoint: spp,
-			NumberOfPoints:  nop,
-		})
-	}
-
-	response := pb.InfoResponse{
-		Name:              metric,
-		AggregationMethod: aggr,
-		MaxRetention:      maxr,
-		XFilesFactor:      xfiles,
-		Retentions:        rets,
-	}
-
 	switch format {
 	case "json":
 		b, err = json.Marshal(response)
@@ -1584,6 +1839,42 @@ func (listener *CarbonserverListener) infoHandler(wr http.ResponseWriter, req *h
 	return
 }
 
+// metricInfo reads header of whisper file. Metric is relative to tenant root if tenantName is not empty
+func (listener *CarbonserverListener) metricInfo(metric string, tenantName string) (*pb.InfoResponse, error) {
+	path := listener.whisperData + "/" + strings.Replace(metric, ".", "/", -1) + ".wsp"
+	if tenantName != "" {
+		path = listener.whisperData + "/" + strings.Replace(tenant.Prefix(tenantName, metric), ".", "/", -1) + ".wsp"
+	}
+	w, err := whisper.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer w.Close()
+
+	aggr := w.AggregationMethod()
+	maxr := int32(w.MaxRetention())
+	xfiles := float32(w.XFilesFactor())
+
+	rets := make([]*pb.Retention, 0, 4)
+	for _, retention := range w.Retentions() {
+		spp := int32(retention.SecondsPerPoint())
+		nop := int32(retention.NumberOfPoints())
+		rets = append(rets, &pb.Retention{
+			SecondsPerPoint: spp,
+			NumberOfPoints:  nop,
+		})
+	}
+
+	return &pb.InfoResponse{
+		Name:              metric,
+		AggregationMethod: aggr,
+		MaxRetention:      maxr,
+		XFilesFactor:      xfiles,
+		Retentions:        rets,
+	}, nil
+}
+
 func (listener *CarbonserverListener) Stat(send helper.StatCallback) {
 	senderRaw := helper.SendUint64
 	sender := helper.SendAndSubstractUint64
@@ -1629,6 +1920,15 @@ func (listener *CarbonserverListener) Stat(send helper.StatCallback) {
 	sender("find_cache_hit", &listener.metrics.FindCacheHit, send)
 	sender("find_cache_miss", &listener.metrics.FindCacheMiss, send)
 
+	sender("delete_requests", &listener.metrics.DeleteRequests, send)
+	sender("delete_errors", &listener.metrics.DeleteErrors, send)
+	sender("metrics_deleted", &listener.metrics.MetricsDeleted, send)
+
+	sender("tags_requests", &listener.metrics.TagsRequests, send)
+	sender("tags_errors", &listener.metrics.TagsErrors, send)
+
+	sender("tenant_auth_errors", &listener.metrics.TenantAuthErrors, send)
+
 	sender("alloc", &alloc, send)
 	sender("total_alloc", &totalAlloc, send)
 	sender("num_gc", &numGC, send)
@@ -1667,6 +1967,23 @@ func (listener *CarbonserverListener) Stat(send helper.StatCallback) {
 	}
 }
 
+// StatType returns type of stat sent by Stat. Counters are sent as totals with metrics-as-counters
+func (listener *CarbonserverListener) StatType(metric string) helper.StatType {
+	switch metric {
+	case "metrics_known", "alloc":
+		return helper.StatGauge
+	case "total_alloc", "num_gc", "pause_ns":
+		return helper.StatCumulative
+	}
+	if strings.HasSuffix(metric, "_percentile_ns") {
+		return helper.StatGauge
+	}
+	if listener.metricsAsCounters {
+		return helper.StatCumulative
+	}
+	return helper.StatCounter
+}
+
 func (listener *CarbonserverListener) Stop() error {
 	close(listener.forceScanChan)
 	close(listener.exitChan)
@@ -1674,6 +1991,9 @@ func (listener *CarbonserverListener) Stop() error {
 		listener.db.Close()
 	}
 	listener.tcpListener.Close()
+	if listener.grpcServer != nil {
+		listener.grpcServer.Stop()
+	}
 	return nil
 }
 
@@ -1773,11 +2093,15 @@ func (listener *CarbonserverListener) Listen(listen string) error {
 			),
 		)
 	}
-	carbonserverMux.HandleFunc("/metrics/find/", wrapHandler(listener.findHandler, statusCodes["find"]))
-	carbonserverMux.HandleFunc("/metrics/list/", wrapHandler(listener.listHandler, statusCodes["list"]))
-	carbonserverMux.HandleFunc("/metrics/details/", wrapHandler(listener.detailsHandler, statusCodes["details"]))
-	carbonserverMux.HandleFunc("/render/", wrapHandler(listener.renderHandler, statusCodes["render"]))
-	carbonserverMux.HandleFunc("/info/", wrapHandler(listener.infoHandler, statusCodes["info"]))
+	carbonserverMux.HandleFunc("/metrics/find/", wrapHandler(listener.tenantHandler(listener.findHandler), statusCodes["find"]))
+	carbonserverMux.HandleFunc("/metrics/list/", wrapHandler(listener.tenantHandler(listener.listHandler), statusCodes["list"]))
+	carbonserverMux.HandleFunc("/metrics/details/", wrapHandler(listener.tenantHandler(listener.detailsHandler), statusCodes["details"]))
+	carbonserverMux.HandleFunc("/render/", wrapHandler(listener.tenantHandler(listener.renderHandler), statusCodes["render"]))
+	carbonserverMux.HandleFunc("/info/", wrapHandler(listener.tenantHandler(listener.infoHandler), statusCodes["info"]))
+	carbonserverMux.HandleFunc("/tags/findSeries", wrapHandler(listener.tenantHandler(listener.tagsFindSeriesHandler), statusCodes["tags"]))
+	if listener.deleteToken != "" {
+		carbonserverMux.HandleFunc("/metrics/delete/", wrapHandler(listener.deleteHandler, statusCodes["delete"]))
+	}
 
 	carbonserverMux.HandleFunc("/forcescan", func(w http.ResponseWriter, r *http.Request) {
 		select {
@@ -1792,11 +2116,8 @@ func (listener *CarbonserverListener) Listen(listen string) error {
 		fmt.Fprintln(w, "User-agent: *\nDisallow: /")
 	})
 
-	tcpAddr, err := net.ResolveTCPAddr("tcp", listen)
-	if err != nil {
-		return err
-	}
-	listener.tcpListener, err = net.ListenTCP("tcp", tcpAddr)
+	var err error
+	listener.tcpListener, err = socket.Listen(listen, listener.socketPermissions)
 	if err != nil {
 		return err
 	}
@@ -1857,7 +2178,7 @@ func (listener *CarbonserverListener) Listen(listen string) error {
 		WriteTimeout: listener.writeTimeout,
 	}
 
-	go srv.Serve(listener.tcpListener)
+	go srv.Serve(tlsconfig.Listener(listener.tcpListener, listener.tlsConfig))
 
 	return nil
 }
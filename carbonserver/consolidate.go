@@ -0,0 +1,241 @@
+package carbonserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+)
+
+// renderOptions are optional params of render request for server-side processing of fetched series
+type renderOptions struct {
+	maxDataPoints int    // consolidate series to at most maxDataPoints values. 0 - disabled
+	consolidateBy string // avg, sum, min, max or last
+	aggregate     string // sumSeries, averageSeries or maxSeries of all metrics of target. Empty - disabled
+	archives      archiveOptions
+}
+
+// aggregateFunc returns aggregated value of not absent values. values is never empty
+type aggregateFunc func(values []float64) float64
+
+func aggregateSum(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func aggregateAvg(values []float64) float64 {
+	return aggregateSum(values) / float64(len(values))
+}
+
+func aggregateMin(values []float64) float64 {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func aggregateMax(values []float64) float64 {
+	max := values[0]
+	for _, v := range values[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+func aggregateLast(values []float64) float64 {
+	return values[len(values)-1]
+}
+
+var consolidateFuncs = map[string]aggregateFunc{
+	"avg":     aggregateAvg,
+	"average": aggregateAvg,
+	"sum":     aggregateSum,
+	"min":     aggregateMin,
+	"max":     aggregateMax,
+	"last":    aggregateLast,
+}
+
+var seriesFuncs = map[string]aggregateFunc{
+	"sumSeries":     aggregateSum,
+	"averageSeries": aggregateAvg,
+	"maxSeries":     aggregateMax,
+}
+
+// parseRenderOptions reads maxDataPoints, consolidateBy, aggregate, archive and step params of request
+func parseRenderOptions(req *http.Request) (renderOptions, error) {
+	return newRenderOptions(req.FormValue("maxDataPoints"), req.FormValue("consolidateBy"), req.FormValue("aggregate"),
+		req.FormValue("archive"), req.FormValue("step"))
+}
+
+// newRenderOptions parses params of render request. Empty string - param is not set
+func newRenderOptions(maxDataPoints, consolidateBy, aggregate, archive, step string) (renderOptions, error) {
+	opts := renderOptions{
+		consolidateBy: "avg",
+	}
+
+	if maxDataPoints != "" {
+		n, err := strconv.Atoi(maxDataPoints)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid maxDataPoints %#v", maxDataPoints)
+		}
+		opts.maxDataPoints = n
+	}
+
+	if consolidateBy != "" {
+		if _, ok := consolidateFuncs[consolidateBy]; !ok {
+			return opts, fmt.Errorf("unknown consolidateBy %#v", consolidateBy)
+		}
+		opts.consolidateBy = consolidateBy
+	}
+
+	if aggregate != "" {
+		if _, ok := seriesFuncs[aggregate]; !ok {
+			return opts, fmt.Errorf("unknown aggregate %#v", aggregate)
+		}
+		opts.aggregate = aggregate
+	}
+
+	archives, err := newArchiveOptions(archive, step)
+	if err != nil {
+		return opts, err
+	}
+	if archives.mode == archiveAll && opts.aggregate != "" {
+		return opts, errors.New("aggregate can't be used with all archives")
+	}
+	opts.archives = archives
+
+	return opts, nil
+}
+
+// cacheKey is part of query cache key
+func (opts renderOptions) cacheKey() string {
+	if opts.maxDataPoints == 0 && opts.aggregate == "" {
+		return opts.archives.cacheKey()
+	}
+	return fmt.Sprintf("&%d&%s&%s", opts.maxDataPoints, opts.consolidateBy, opts.aggregate) + opts.archives.cacheKey()
+}
+
+// consolidate groups values of series to at most maxDataPoints points. Absent values are ignored, point is absent if
+// all values of group are absent
+func consolidate(series *pb.FetchResponse, maxDataPoints int, fn aggregateFunc) {
+	if maxDataPoints <= 0 || len(series.Values) <= maxDataPoints {
+		return
+	}
+
+	valuesPerPoint := (len(series.Values) + maxDataPoints - 1) / maxDataPoints
+	count := (len(series.Values) + valuesPerPoint - 1) / valuesPerPoint
+
+	values := make([]float64, count)
+	isAbsent := make([]bool, count)
+	group := make([]float64, 0, valuesPerPoint)
+
+	for i := 0; i < count; i++ {
+		group = group[:0]
+		for j := i * valuesPerPoint; j < (i+1)*valuesPerPoint && j < len(series.Values); j++ {
+			if !series.IsAbsent[j] {
+				group = append(group, series.Values[j])
+			}
+		}
+		if len(group) == 0 {
+			isAbsent[i] = true
+		} else {
+			values[i] = fn(group)
+		}
+	}
+
+	series.StepTime *= int32(valuesPerPoint)
+	series.StopTime = series.StartTime + int32(count)*series.StepTime
+	series.Values = values
+	series.IsAbsent = isAbsent
+}
+
+func gcd(a, b int32) int32 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// aggregateSeries combines series to one with fn. Series with different steps are normalized to least common
+// multiple of steps with average, same as graphite-web does
+func aggregateSeries(name string, series []*pb.FetchResponse, fn aggregateFunc) *pb.FetchResponse {
+	step := series[0].StepTime
+	start := series[0].StartTime
+	stop := series[0].StopTime
+	for _, s := range series[1:] {
+		step = step / gcd(step, s.StepTime) * s.StepTime
+		if s.StartTime < start {
+			start = s.StartTime
+		}
+		if s.StopTime > stop {
+			stop = s.StopTime
+		}
+	}
+	start -= start % step
+	count := int((stop - start + step - 1) / step)
+
+	// values of each series in each point of result
+	buckets := make([][]float64, count)
+	for _, s := range series {
+		perPoint := int(step / s.StepTime)
+		group := make([]float64, 0, perPoint)
+		last := -1
+
+		flush := func() {
+			if len(group) > 0 {
+				buckets[last] = append(buckets[last], aggregateAvg(group))
+				group = group[:0]
+			}
+		}
+
+		for i, v := range s.Values {
+			if s.IsAbsent[i] {
+				continue
+			}
+			index := int((s.StartTime + int32(i)*s.StepTime - start) / step)
+			if index >= count {
+				break
+			}
+			if index != last {
+				flush()
+				last = index
+			}
+			group = append(group, v)
+		}
+		flush()
+	}
+
+	res := &pb.FetchResponse{
+		Name:      name,
+		StartTime: start,
+		StopTime:  start + int32(count)*step,
+		StepTime:  step,
+		Values:    make([]float64, count),
+		IsAbsent:  make([]bool, count),
+	}
+
+	for i, values := range buckets {
+		if len(values) == 0 {
+			res.IsAbsent[i] = true
+			continue
+		}
+		res.Values[i] = fn(values)
+		if math.IsNaN(res.Values[i]) {
+			res.Values[i] = 0
+			res.IsAbsent[i] = true
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,104 @@
+package carbonserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+)
+
+func series(name string, start, step int32, values ...float64) *pb.FetchResponse {
+	r := &pb.FetchResponse{
+		Name:      name,
+		StartTime: start,
+		StopTime:  start + step*int32(len(values)),
+		StepTime:  step,
+		Values:    make([]float64, len(values)),
+		IsAbsent:  make([]bool, len(values)),
+	}
+	for i, v := range values {
+		// -1 is absent value in tests
+		if v == -1 {
+			r.IsAbsent[i] = true
+		} else {
+			r.Values[i] = v
+		}
+	}
+	return r
+}
+
+func TestConsolidate(t *testing.T) {
+	tests := []struct {
+		fn       string
+		max      int
+		input    *pb.FetchResponse
+		expected *pb.FetchResponse
+	}{
+		{"avg", 10, series("m", 60, 60, 1, 2, 3), series("m", 60, 60, 1, 2, 3)},
+		{"avg", 2, series("m", 60, 60, 1, 2, 3, 4), series("m", 60, 120, 1.5, 3.5)},
+		{"sum", 2, series("m", 60, 60, 1, 2, 3, 4, 5), series("m", 60, 180, 6, 9)},
+		{"min", 2, series("m", 60, 60, 3, 2, 1, 4), series("m", 60, 120, 2, 1)},
+		{"max", 2, series("m", 60, 60, 3, 2, 1, 4), series("m", 60, 120, 3, 4)},
+		{"last", 2, series("m", 60, 60, 3, 2, 1, -1), series("m", 60, 120, 2, 1)},
+		{"avg", 2, series("m", 60, 60, -1, -1, 1, -1), series("m", 60, 120, -1, 1)},
+	}
+
+	for _, tc := range tests {
+		consolidate(tc.input, tc.max, consolidateFuncs[tc.fn])
+		assert.Equal(t, tc.expected, tc.input, tc.fn)
+	}
+}
+
+func TestAggregateSeries(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(
+		series("sumSeries(m.*)", 60, 60, 3, 2, 7, -1),
+		aggregateSeries("sumSeries(m.*)", []*pb.FetchResponse{
+			series("m.a", 60, 60, 1, 2, 3, -1),
+			series("m.b", 60, 60, 2, -1, 4, -1),
+		}, seriesFuncs["sumSeries"]),
+	)
+
+	assert.Equal(
+		series("averageSeries(m.*)", 60, 60, 1.5, 2, 3.5),
+		aggregateSeries("averageSeries(m.*)", []*pb.FetchResponse{
+			series("m.a", 60, 60, 1, 2, 3),
+			series("m.b", 60, 60, 2, -1, 4),
+		}, seriesFuncs["averageSeries"]),
+	)
+
+	// series with different steps are normalized to common step with average
+	assert.Equal(
+		series("maxSeries(m.*)", 120, 120, 5, 3.5),
+		aggregateSeries("maxSeries(m.*)", []*pb.FetchResponse{
+			series("m.a", 120, 60, 1, 2, 3, 4),
+			series("m.b", 120, 120, 5, 1),
+		}, seriesFuncs["maxSeries"]),
+	)
+}
+
+func TestParseRenderOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opts, err := parseRenderOptions(httptest.NewRequest("GET", "/render/?target=m&maxDataPoints=100&consolidateBy=sum&aggregate=sumSeries", nil))
+	assert.NoError(err)
+	assert.Equal(renderOptions{maxDataPoints: 100, consolidateBy: "sum", aggregate: "sumSeries"}, opts)
+
+	opts, err = parseRenderOptions(httptest.NewRequest("GET", "/render/?target=m", nil))
+	assert.NoError(err)
+	assert.Equal(renderOptions{consolidateBy: "avg"}, opts)
+	assert.Equal("", opts.cacheKey())
+
+	for _, url := range []string{
+		"/render/?maxDataPoints=abc",
+		"/render/?maxDataPoints=-1",
+		"/render/?consolidateBy=median",
+		"/render/?aggregate=minSeries",
+	} {
+		_, err = parseRenderOptions(httptest.NewRequest("GET", url, nil))
+		assert.Error(err, url)
+	}
+}
@@ -0,0 +1,219 @@
+package carbonserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"go.uber.org/zap"
+)
+
+type deleteResponse struct {
+	Deleted []string
+	Errors  []string
+}
+
+// checkDeleteToken validates "Authorization: Bearer <token>" header
+func (listener *CarbonserverListener) checkDeleteToken(req *http.Request) bool {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(listener.deleteToken)) == 1
+}
+
+func (listener *CarbonserverListener) deleteHandler(wr http.ResponseWriter, req *http.Request) {
+	// URL: DELETE /metrics/delete/?query=the.metric.path.with.glob&remove_empty_dirs=1
+	t0 := time.Now()
+	ctx := req.Context()
+
+	atomic.AddUint64(&listener.metrics.DeleteRequests, 1)
+
+	req.ParseForm()
+	query := req.FormValue("query")
+	removeEmptyDirs := req.FormValue("remove_empty_dirs") == "1" || req.FormValue("remove_empty_dirs") == "true"
+
+	accessLogger := TraceContextToZap(ctx, listener.accessLogger.With(
+		zap.String("handler", "delete"),
+		zap.String("url", req.URL.RequestURI()),
+		zap.String("peer", req.RemoteAddr),
+		zap.String("query", query),
+	))
+
+	if req.Method != "DELETE" {
+		atomic.AddUint64(&listener.metrics.DeleteErrors, 1)
+		accessLogger.Error("delete failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "method not allowed"),
+			zap.Int("http_code", http.StatusMethodNotAllowed),
+		)
+		http.Error(wr, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !listener.checkDeleteToken(req) {
+		atomic.AddUint64(&listener.metrics.DeleteErrors, 1)
+		accessLogger.Error("delete failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "unauthorized"),
+			zap.Int("http_code", http.StatusUnauthorized),
+		)
+		http.Error(wr, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if query == "" {
+		atomic.AddUint64(&listener.metrics.DeleteErrors, 1)
+		accessLogger.Error("delete failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "empty query"),
+			zap.Int("http_code", http.StatusBadRequest),
+		)
+		http.Error(wr, "Bad request (no query)", http.StatusBadRequest)
+		return
+	}
+
+	files, leafs, err := listener.expandGlobs(query)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.DeleteErrors, 1)
+		accessLogger.Error("delete failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "can't expand globs"),
+			zap.Error(err),
+			zap.Int("http_code", http.StatusBadRequest),
+		)
+		http.Error(wr, fmt.Sprintf("Bad request (%s)", err), http.StatusBadRequest)
+		return
+	}
+
+	var metrics []string
+	for i := range files {
+		if leafs[i] {
+			metrics = append(metrics, files[i])
+		}
+	}
+
+	response := listener.deleteMetrics(metrics, removeEmptyDirs)
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.DeleteErrors, 1)
+		accessLogger.Error("delete failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "response encode failed"),
+			zap.Error(err),
+			zap.Int("http_code", http.StatusInternalServerError),
+		)
+		http.Error(wr, fmt.Sprintf("An internal error has occured: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(b)
+
+	accessLogger.Info("delete success",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+		zap.Int("deleted", len(response.Deleted)),
+		zap.Int("errors", len(response.Errors)),
+		zap.Int("http_code", http.StatusOK),
+	)
+}
+
+// deleteMetrics removes whisper files of metrics and drops them from cache, file index, stats database and find cache
+func (listener *CarbonserverListener) deleteMetrics(metrics []string, removeEmptyDirs bool) *deleteResponse {
+	response := &deleteResponse{
+		Deleted: make([]string, 0, len(metrics)),
+		Errors:  make([]string, 0),
+	}
+
+	for _, metric := range metrics {
+		// drop from cache before removing file, but points being written by persister right now can recreate it
+		if listener.cacheDelete != nil {
+			listener.cacheDelete(metric)
+		}
+
+		path := filepath.Join(listener.whisperData, strings.Replace(metric, ".", "/", -1)+".wsp")
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			atomic.AddUint64(&listener.metrics.DeleteErrors, 1)
+			listener.logger.Error("delete failed", zap.String("path", path), zap.Error(err))
+			response.Errors = append(response.Errors, metric)
+			continue
+		}
+
+		if removeEmptyDirs {
+			listener.removeEmptyDirs(filepath.Dir(path))
+		}
+
+		response.Deleted = append(response.Deleted, metric)
+	}
+
+	if len(response.Deleted) == 0 {
+		return response
+	}
+
+	atomic.AddUint64(&listener.metrics.MetricsDeleted, uint64(len(response.Deleted)))
+
+	listener.fileIdxMutex.Lock()
+	if fidx := listener.CurrentFileIndex(); fidx != nil {
+		deleted := make(map[string]bool)
+		for _, metric := range response.Deleted {
+			deleted["/"+strings.Replace(metric, ".", "/", -1)+".wsp"] = true
+			delete(fidx.details, metric)
+			delete(fidx.accessTimes, metric)
+		}
+
+		// trigram index is immutable, so removed files are replaced with empty names in copy of list
+		files := make([]string, len(fidx.files))
+		for i, f := range fidx.files {
+			if !deleted[f] {
+				files[i] = f
+			}
+		}
+
+		newIdx := *fidx
+		newIdx.files = files
+		listener.UpdateFileIndex(&newIdx)
+	}
+	listener.fileIdxMutex.Unlock()
+
+	if listener.db != nil {
+		batch := new(leveldb.Batch)
+		for _, metric := range response.Deleted {
+			batch.Delete([]byte(metric))
+		}
+		if err := listener.db.Write(batch, nil); err != nil {
+			listener.logger.Info("Error updating database",
+				zap.Error(err),
+			)
+		}
+	}
+
+	// all cached find and render responses become stale
+	atomic.AddUint64(&listener.cacheGeneration, 1)
+
+	return response
+}
+
+// removeEmptyDirs removes dir and its parents up to whisperData while they are empty
+func (listener *CarbonserverListener) removeEmptyDirs(dir string) {
+	root := filepath.Clean(listener.whisperData)
+	for {
+		dir = filepath.Clean(dir)
+		if dir == root || !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			return
+		}
+		// fails on not empty directory
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
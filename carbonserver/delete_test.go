@@ -0,0 +1,87 @@
+package carbonserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	for _, f := range []string{"junk/a/m1.wsp", "junk/a/m2.wsp", "junk/b/m1.wsp", "good/m1.wsp"} {
+		if err := os.MkdirAll(filepath.Join(path, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cacheDeleted []string
+
+	carbonserver := NewCarbonserverListener(nil)
+	carbonserver.SetWhisperData(path)
+	carbonserver.SetMaxGlobs(100)
+	carbonserver.SetTrigramIndex(false)
+	carbonserver.SetDeleteToken("secret")
+	carbonserver.SetCacheDelete(func(key string) {
+		cacheDeleted = append(cacheDeleted, key)
+	})
+
+	do := func(method, url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		carbonserver.deleteHandler(rr, req)
+		return rr
+	}
+
+	assert.Equal(http.StatusMethodNotAllowed, do("GET", "/metrics/delete/?query=junk.a.*", "secret").Code)
+	assert.Equal(http.StatusUnauthorized, do("DELETE", "/metrics/delete/?query=junk.a.*", "").Code)
+	assert.Equal(http.StatusUnauthorized, do("DELETE", "/metrics/delete/?query=junk.a.*", "wrong").Code)
+	assert.Equal(http.StatusBadRequest, do("DELETE", "/metrics/delete/", "secret").Code)
+
+	renderKey := carbonserver.queryCacheKey([]string{"junk.a.*"}, "json", "0", "60", renderOptions{})
+
+	rr := do("DELETE", "/metrics/delete/?query=junk.a.*&remove_empty_dirs=1", "secret")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.JSONEq(`{"Deleted":["junk.a.m1","junk.a.m2"],"Errors":[]}`, rr.Body.String())
+	assert.Equal([]string{"junk.a.m1", "junk.a.m2"}, cacheDeleted)
+
+	// cached render responses of deleted metrics are not used
+	assert.NotEqual(renderKey, carbonserver.queryCacheKey([]string{"junk.a.*"}, "json", "0", "60", renderOptions{}))
+
+	_, err = os.Stat(filepath.Join(path, "junk/a"))
+	assert.True(os.IsNotExist(err))
+
+	// not empty parent is kept
+	_, err = os.Stat(filepath.Join(path, "junk/b/m1.wsp"))
+	assert.NoError(err)
+
+	// directory itself is not a metric
+	rr = do("DELETE", "/metrics/delete/?query=good", "secret")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.JSONEq(`{"Deleted":[],"Errors":[]}`, rr.Body.String())
+
+	rr = do("DELETE", "/metrics/delete/?query=junk.b.m1", "secret")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.JSONEq(`{"Deleted":["junk.b.m1"],"Errors":[]}`, rr.Body.String())
+
+	// empty dirs are kept by default
+	_, err = os.Stat(filepath.Join(path, "junk/b"))
+	assert.NoError(err)
+}
@@ -0,0 +1,96 @@
+package carbonserver
+
+import (
+	"context"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+)
+
+// fetchResult is result of fetchArchives
+type fetchResult struct {
+	responses []*pb.FetchResponse
+	err       error
+}
+
+// fetchOrdered calls fetch for each metric with at most concurrency parallel calls. Results are passed to out in
+// order of metrics, not more than concurrency results are waiting for out. Stops on first error of out or if ctx is done
+func fetchOrdered(ctx context.Context, metrics []string, concurrency int, fetch func(metric string) ([]*pb.FetchResponse, error), out func(*pb.FetchResponse) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	done := make(chan struct{})
+	pending := make(chan chan fetchResult, concurrency)
+
+	go func() {
+		defer close(pending)
+		for _, metric := range metrics {
+			ch := make(chan fetchResult, 1)
+			select {
+			case pending <- ch:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+			go func(metric string) {
+				responses, err := fetch(metric)
+				ch <- fetchResult{responses: responses, err: err}
+			}(metric)
+		}
+	}()
+
+	var err error
+	for ch := range pending {
+		if err != nil {
+			// drain, fetchers write to buffered channels and never block
+			continue
+		}
+		res := <-ch
+		if res.err != nil {
+			// not found metric is skipped
+			continue
+		}
+		for _, response := range res.responses {
+			if err = out(response); err != nil {
+				close(done)
+				break
+			}
+		}
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// fetchMetric reads archives of metric in one of global fetch workers. Metric is not read if ctx is done while
+// waiting for free worker
+func (listener *CarbonserverListener) fetchMetric(ctx context.Context, metric string, fromTime, untilTime int32, archives archiveOptions) ([]*pb.FetchResponse, error) {
+	if listener.fetchWorkers != nil {
+		select {
+		case listener.fetchWorkers <- struct{}{}:
+			defer func() { <-listener.fetchWorkers }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return listener.fetchArchives(metric, fromTime, untilTime, archives)
+}
+
+// fetchMetrics reads metrics in parallel, not more than fetch-workers-per-request at once. Results are passed to
+// out in order of metrics, not found metrics are skipped. Error is returned if ctx is done or out failed
+func (listener *CarbonserverListener) fetchMetrics(ctx context.Context, metrics []string, fromTime, untilTime int32, archives archiveOptions, out func(*pb.FetchResponse) error) error {
+	return fetchOrdered(ctx, metrics, listener.fetchWorkersPerRequest,
+		func(metric string) ([]*pb.FetchResponse, error) {
+			return listener.fetchMetric(ctx, metric, fromTime, untilTime, archives)
+		},
+		out,
+	)
+}
@@ -0,0 +1,91 @@
+package carbonserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+)
+
+func TestFetchOrdered(t *testing.T) {
+	assert := assert.New(t)
+
+	var metrics []string
+	for i := 0; i < 100; i++ {
+		metrics = append(metrics, fmt.Sprintf("m%d", i))
+	}
+
+	var running, maxRunning int32
+	fetch := func(metric string) ([]*pb.FetchResponse, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if metric == "m13" {
+			return nil, errors.New("not found")
+		}
+		return []*pb.FetchResponse{{Name: metric}}, nil
+	}
+
+	var received []string
+	err := fetchOrdered(context.Background(), metrics, 4, fetch, func(r *pb.FetchResponse) error {
+		received = append(received, r.Name)
+		return nil
+	})
+	assert.NoError(err)
+
+	expected := append(append([]string{}, metrics[:13]...), metrics[14:]...)
+	assert.Equal(expected, received)
+	assert.True(atomic.LoadInt32(&maxRunning) <= 5, "max running %d", maxRunning)
+
+	// stops on first error of out
+	received = nil
+	err = fetchOrdered(context.Background(), metrics, 4, fetch, func(r *pb.FetchResponse) error {
+		received = append(received, r.Name)
+		if len(received) == 3 {
+			return errors.New("client gone")
+		}
+		return nil
+	})
+	assert.EqualError(err, "client gone")
+	assert.Equal(metrics[:3], received)
+
+	// cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = fetchOrdered(ctx, metrics, 4, fetch, func(r *pb.FetchResponse) error { return nil })
+	assert.Equal(context.Canceled, err)
+}
+
+func TestFetchMetricCancelled(t *testing.T) {
+	listener := NewCarbonserverListener(nil)
+	listener.SetMaxFetchWorkers(1)
+
+	// all workers are busy
+	listener.fetchWorkers <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := listener.fetchMetric(ctx, "metric", 0, 60, archiveOptions{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	var received int
+	err = listener.fetchMetrics(ctx, []string{"m1", "m2"}, 0, 60, archiveOptions{}, func(*pb.FetchResponse) error {
+		received++
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 0, received)
+}
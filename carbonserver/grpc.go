@@ -0,0 +1,382 @@
+package carbonserver
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+	"github.com/lomik/go-carbon/helper/socket"
+	"github.com/lomik/go-carbon/helper/tenant"
+)
+
+// grpcServer serves carbonzipper protocol over gRPC. Find and Fetch share caches with HTTP handlers
+type grpcServer struct {
+	listener *CarbonserverListener
+}
+
+// ListenGRPC starts gRPC server of carbonzipper protocol. Should be called after Listen
+func (listener *CarbonserverListener) ListenGRPC(listen string) error {
+	listener.logger.Info("starting carbonserver grpc",
+		zap.String("listen", listen),
+	)
+
+	var err error
+	listener.grpcListener, err = socket.Listen(listen, listener.socketPermissions)
+	if err != nil {
+		return err
+	}
+
+	var opts []grpc.ServerOption
+	if listener.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(listener.tlsConfig)))
+	}
+
+	listener.grpcServer = grpc.NewServer(opts...)
+	pb.RegisterCarbonserverServer(listener.grpcServer, &grpcServer{listener: listener})
+
+	go listener.grpcServer.Serve(listener.grpcListener)
+
+	return nil
+}
+
+// GRPCAddr returns binded address of gRPC server. For bind port 0 in tests
+func (listener *CarbonserverListener) GRPCAddr() string {
+	if listener.grpcListener == nil {
+		return ""
+	}
+	return listener.grpcListener.Addr().String()
+}
+
+func (s *grpcServer) accessLogger(ctx context.Context, handler string) *zap.Logger {
+	logger := s.listener.accessLogger.With(zap.String("handler", handler))
+	if p, ok := peer.FromContext(ctx); ok {
+		logger = logger.With(zap.String("peer", p.Addr.String()))
+	}
+	return logger
+}
+
+// tenant authenticates request by "authorization: Bearer <token>" metadata. Empty string is returned if tenants are
+// disabled
+func (s *grpcServer) tenant(ctx context.Context) (string, error) {
+	if s.listener.tenants == nil {
+		return "", nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if auth := md["authorization"]; len(auth) > 0 {
+			token = tenant.AuthorizationToken(auth[0])
+		}
+	}
+
+	tenantName, ok := s.listener.tenants.Lookup(token)
+	if !ok {
+		atomic.AddUint64(&s.listener.metrics.TenantAuthErrors, 1)
+		return "", grpc.Errorf(codes.Unauthenticated, "unauthorized")
+	}
+	return tenantName, nil
+}
+
+// contextError converts error of cancelled or timed out request to gRPC status
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return grpc.Errorf(codes.DeadlineExceeded, "%s", err.Error())
+	case context.Canceled:
+		return grpc.Errorf(codes.Canceled, "%s", err.Error())
+	}
+	return err
+}
+
+func (s *grpcServer) Find(ctx context.Context, req *pb.FindRequest) (*pb.GlobResponse, error) {
+	t0 := time.Now()
+	listener := s.listener
+
+	atomic.AddUint64(&listener.metrics.FindRequests, 1)
+
+	accessLogger := s.accessLogger(ctx, "grpc_find").With(
+		zap.String("query", req.Query),
+	)
+
+	tenantName, err := s.tenant(ctx)
+	if err != nil {
+		accessLogger.Error("find failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "unauthorized"),
+		)
+		return nil, err
+	}
+
+	if req.Query == "" {
+		atomic.AddUint64(&listener.metrics.FindErrors, 1)
+		accessLogger.Error("find failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "empty query"),
+		)
+		return nil, grpc.Errorf(codes.InvalidArgument, "no query")
+	}
+
+	query := req.Query
+	if tenantName != "" {
+		query = tenant.Prefix(tenantName, query)
+	}
+
+	// protobuf3 response is cached, so find cache is shared with HTTP requests of protobuf3 format
+	response, fromCache, err := listener.findWithCache(accessLogger, t0, "protobuf3", query, tenantName)
+	if response == nil {
+		accessLogger.Error("find failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "internal error while processing request"),
+			zap.Error(err),
+		)
+		return nil, grpc.Errorf(codes.Internal, "internal error while processing request (%v)", err)
+	}
+
+	res := &pb.GlobResponse{}
+	if err = res.Unmarshal(response.data); err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%s", err.Error())
+	}
+
+	if response.files == 0 {
+		atomic.AddUint64(&listener.metrics.FindZero, 1)
+	}
+
+	accessLogger.Info("find success",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+		zap.Int("files", response.files),
+		zap.Bool("find_cache_enabled", listener.findCacheEnabled),
+		zap.Bool("from_cache", fromCache),
+	)
+	return res, nil
+}
+
+func (s *grpcServer) Fetch(req *pb.FetchRequest, stream pb.Carbonserver_FetchServer) error {
+	t0 := time.Now()
+	ctx := stream.Context()
+	listener := s.listener
+
+	atomic.AddUint64(&listener.metrics.RenderRequests, 1)
+
+	accessLogger := s.accessLogger(ctx, "grpc_fetch").With(
+		zap.Strings("targets", req.Targets),
+		zap.Int32("from", req.From),
+		zap.Int32("until", req.Until),
+	)
+
+	tenantName, err := s.tenant(ctx)
+	if err != nil {
+		accessLogger.Error("fetch failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "unauthorized"),
+		)
+		return err
+	}
+
+	// zero values of request are not set params
+	var maxDataPoints, step string
+	if req.MaxDataPoints != 0 {
+		maxDataPoints = strconv.Itoa(int(req.MaxDataPoints))
+	}
+	if req.Step != 0 {
+		step = strconv.Itoa(int(req.Step))
+	}
+
+	opts, err := newRenderOptions(maxDataPoints, req.ConsolidateBy, req.Aggregate, req.Archive, step)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+		accessLogger.Error("fetch failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "invalid render options"),
+			zap.Error(err),
+		)
+		return grpc.Errorf(codes.InvalidArgument, "%s", err.Error())
+	}
+
+	targets := req.Targets
+	if tenantName != "" {
+		targets = make([]string, len(req.Targets))
+		for i, target := range req.Targets {
+			targets[i] = tenant.Prefix(tenantName, target)
+		}
+	}
+
+	var metrics []string
+	var valuesFetched, memoryUsed int
+	fromCache := false
+
+	if listener.queryCacheEnabled || opts.aggregate != "" {
+		// protobuf3 response is cached, so query cache is shared with HTTP requests of protobuf3 format.
+		// Aggregated series need all metrics of target, so they are never streamed
+		var response fetchResponse
+		response, fromCache, err = listener.fetchWithCache(ctx, accessLogger, "protobuf3", targets,
+			strconv.Itoa(int(req.From)), strconv.Itoa(int(req.Until)), tenantName, opts)
+		if err == nil {
+			var multi pb.MultiFetchResponse
+			if err = multi.Unmarshal(response.data); err == nil {
+				for _, r := range multi.Metrics {
+					if err = stream.Send(r); err != nil {
+						break
+					}
+				}
+			}
+			metrics, valuesFetched, memoryUsed = response.metrics, response.valuesFetched, response.memoryUsed
+		}
+	} else {
+		metrics, valuesFetched, memoryUsed, err = listener.fetchTargets(ctx, accessLogger, targets, req.From, req.Until,
+			tenantName, opts, stream.Send)
+	}
+
+	listener.UpdateMetricsAccessTimesByRequest(metrics)
+	atomic.AddUint64(&listener.metrics.FetchSize, uint64(memoryUsed))
+
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+		accessLogger.Error("fetch failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "failed to read data"),
+			zap.Int("metrics_fetched", len(metrics)),
+			zap.Error(err),
+		)
+		return contextError(ctx, err)
+	}
+
+	accessLogger.Info("fetch served",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+		zap.Bool("query_cache_enabled", listener.queryCacheEnabled),
+		zap.Bool("from_cache", fromCache),
+		zap.Int("metrics_fetched", len(metrics)),
+		zap.Int("values_fetched", valuesFetched),
+		zap.Int("memory_used_bytes", memoryUsed),
+	)
+	return nil
+}
+
+func (s *grpcServer) Info(ctx context.Context, req *pb.InfoRequest) (*pb.InfoResponse, error) {
+	t0 := time.Now()
+	listener := s.listener
+
+	atomic.AddUint64(&listener.metrics.InfoRequests, 1)
+
+	accessLogger := s.accessLogger(ctx, "grpc_info").With(
+		zap.String("target", req.Name),
+	)
+
+	tenantName, err := s.tenant(ctx)
+	if err != nil {
+		accessLogger.Error("info failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "unauthorized"),
+		)
+		return nil, err
+	}
+
+	response, err := listener.metricInfo(req.Name, tenantName)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.NotFound, 1)
+		accessLogger.Error("info served",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "metric not found"),
+		)
+		return nil, grpc.Errorf(codes.NotFound, "metric not found")
+	}
+
+	accessLogger.Info("info served",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+	)
+	return response, nil
+}
+
+func (s *grpcServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListMetricsResponse, error) {
+	t0 := time.Now()
+	listener := s.listener
+
+	atomic.AddUint64(&listener.metrics.ListRequests, 1)
+
+	accessLogger := s.accessLogger(ctx, "grpc_list")
+
+	tenantName, err := s.tenant(ctx)
+	if err != nil {
+		accessLogger.Error("list failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "unauthorized"),
+		)
+		return nil, err
+	}
+
+	metrics, err := listener.getMetricsList()
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.ListErrors, 1)
+		accessLogger.Error("list failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "can't fetch metrics list"),
+			zap.Error(err),
+		)
+		return nil, grpc.Errorf(codes.Unavailable, "can't fetch metrics list: %s", err)
+	}
+
+	if tenantName != "" {
+		metrics = tenantStripList(tenantName, metrics)
+	}
+
+	accessLogger.Info("list served",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+	)
+	return &pb.ListMetricsResponse{Metrics: metrics}, nil
+}
+
+func (s *grpcServer) Details(ctx context.Context, req *pb.DetailsRequest) (*pb.MetricDetailsResponse, error) {
+	t0 := time.Now()
+	listener := s.listener
+
+	atomic.AddUint64(&listener.metrics.DetailsRequests, 1)
+
+	accessLogger := s.accessLogger(ctx, "grpc_details")
+
+	tenantName, err := s.tenant(ctx)
+	if err != nil {
+		accessLogger.Error("details failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "unauthorized"),
+		)
+		return nil, err
+	}
+
+	fidx := listener.CurrentFileIndex()
+	if fidx == nil {
+		atomic.AddUint64(&listener.metrics.DetailsErrors, 1)
+		accessLogger.Error("details failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "can't fetch metrics list"),
+			zap.Error(errMetricsListEmpty),
+		)
+		return nil, grpc.Errorf(codes.Unavailable, "can't fetch metrics details: %s", errMetricsListEmpty)
+	}
+
+	response := &pb.MetricDetailsResponse{
+		Metrics:    make(map[string]*pb.MetricDetails),
+		FreeSpace:  fidx.freeSpace,
+		TotalSpace: fidx.totalSpace,
+	}
+
+	// details are updated by render requests, response is encoded after unlock so it gets copies
+	listener.fileIdxMutex.Lock()
+	for m, v := range tenantDetails(tenantName, fidx.details) {
+		details := *v
+		response.Metrics[m] = &details
+	}
+	listener.fileIdxMutex.Unlock()
+
+	accessLogger.Info("details served",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+	)
+	return response, nil
+}
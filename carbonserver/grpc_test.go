@@ -0,0 +1,200 @@
+package carbonserver
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	whisper "github.com/go-graphite/go-whisper"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/lomik/go-carbon/cache"
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+	"github.com/lomik/go-carbon/helper/tenant"
+)
+
+func TestGRPC(t *testing.T) {
+	assert := assert.New(t)
+
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	for _, f := range []string{"team/a/m1.wsp", "team/a/m2.wsp", "other/a/m3.wsp"} {
+		if err := os.MkdirAll(filepath.Join(path, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retentions, err := whisper.ParseRetentionDefs("60s:1d,1h:30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "team/b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pointTime := int(time.Now().Unix()) - 120
+	for i, name := range []string{"m4", "m5"} {
+		wsp, err := whisper.Create(filepath.Join(path, "team/b", name+".wsp"), retentions, whisper.Average, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wsp.Update(float64(i+1), pointTime)
+		wsp.Close()
+	}
+
+	tenantsFile := filepath.Join(path, "tenants")
+	if err := ioutil.WriteFile(tenantsFile, []byte("secret team\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := tenant.Load(tenantsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	carbonserver := NewCarbonserverListener(cache.New().Get)
+	carbonserver.SetWhisperData(path)
+	carbonserver.SetMaxGlobs(100)
+	carbonserver.SetTrigramIndex(false)
+	carbonserver.SetFindCacheEnabled(true)
+	carbonserver.SetTenants(tenants)
+
+	if err := carbonserver.ListenGRPC("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer carbonserver.grpcServer.Stop()
+
+	conn, err := grpc.Dial(carbonserver.GRPCAddr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := pb.NewCarbonserverClient(conn)
+
+	_, err = client.Find(context.Background(), &pb.FindRequest{Query: "a.*"})
+	assert.Equal(codes.Unauthenticated, grpc.Code(err))
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Find(ctx, &pb.FindRequest{Query: "a.*"})
+		if assert.NoError(err) {
+			assert.Equal(&pb.GlobResponse{
+				Name: "a.*",
+				Matches: []*pb.GlobMatch{
+					{Path: "a.m1", IsLeaf: true},
+					{Path: "a.m2", IsLeaf: true},
+				},
+			}, res)
+		}
+	}
+	assert.Equal(uint64(1), carbonserver.metrics.FindCacheHit)
+
+	_, err = client.Find(ctx, &pb.FindRequest{})
+	assert.Equal(codes.InvalidArgument, grpc.Code(err))
+
+	stream, err := client.Fetch(ctx, &pb.FetchRequest{Targets: []string{"unknown.*"}, From: 0, Until: 100})
+	if assert.NoError(err) {
+		_, err = stream.Recv()
+		assert.Equal(io.EOF, err)
+	}
+
+	stream, err = client.Fetch(ctx, &pb.FetchRequest{Targets: []string{"a.*"}, ConsolidateBy: "median"})
+	if assert.NoError(err) {
+		_, err = stream.Recv()
+		assert.Equal(codes.InvalidArgument, grpc.Code(err))
+	}
+
+	now := int32(time.Now().Unix())
+
+	for _, req := range []*pb.FetchRequest{
+		{Targets: []string{"b.m4"}, Aggregate: "sumSeries", Archive: "all"},
+		{Targets: []string{"b.m4"}, Archive: "0", Step: 60},
+		{Targets: []string{"b.m4"}, Step: -1},
+	} {
+		stream, err = client.Fetch(ctx, req)
+		if assert.NoError(err) {
+			_, err = stream.Recv()
+			assert.Equal(codes.InvalidArgument, grpc.Code(err), "%#v", req)
+		}
+	}
+
+	// archive and step select archives same as /render/
+	fetch := func(req *pb.FetchRequest) []int32 {
+		var steps []int32
+		stream, err := client.Fetch(ctx, req)
+		if !assert.NoError(err) {
+			return nil
+		}
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return steps
+			}
+			if !assert.NoError(err) {
+				return nil
+			}
+			assert.Equal("b.m4", res.Name)
+			steps = append(steps, res.StepTime)
+		}
+	}
+	assert.Equal([]int32{60, 3600}, fetch(&pb.FetchRequest{Targets: []string{"b.m4"}, From: now - 3600, Until: now, Archive: "all"}))
+	assert.Equal([]int32{3600}, fetch(&pb.FetchRequest{Targets: []string{"b.m4"}, From: now - 3600, Until: now, Step: 600}))
+
+	// series are aggregated without query cache too
+	stream, err = client.Fetch(ctx, &pb.FetchRequest{Targets: []string{"b.*"}, From: now - 600, Until: now, Aggregate: "sumSeries"})
+	if assert.NoError(err) {
+		res, err := stream.Recv()
+		if assert.NoError(err) {
+			assert.Equal("sumSeries(b.*)", res.Name)
+			i := (int32(pointTime) - res.StartTime) / res.StepTime
+			if assert.True(i >= 0 && int(i) < len(res.Values)) {
+				assert.Equal(3.0, res.Values[i])
+				assert.False(res.IsAbsent[i])
+			}
+		}
+		_, err = stream.Recv()
+		assert.Equal(io.EOF, err)
+	}
+
+	_, err = client.Info(ctx, &pb.InfoRequest{Name: "a.unknown"})
+	assert.Equal(codes.NotFound, grpc.Code(err))
+
+	// file index is not built without trigram index and scan
+	_, err = client.List(ctx, &pb.ListRequest{})
+	assert.Equal(codes.Unavailable, grpc.Code(err))
+
+	_, err = client.Details(ctx, &pb.DetailsRequest{})
+	assert.Equal(codes.Unavailable, grpc.Code(err))
+
+	carbonserver.UpdateFileIndex(&fileIndex{
+		files: []string{"/team/a/m1.wsp", "/other/a/m3.wsp"},
+		details: map[string]*pb.MetricDetails{
+			"team.a.m1":  {Size_: 42},
+			"other.a.m3": {Size_: 43},
+		},
+	})
+
+	list, err := client.List(ctx, &pb.ListRequest{})
+	if assert.NoError(err) {
+		assert.Equal([]string{"a.m1"}, list.Metrics)
+	}
+
+	details, err := client.Details(ctx, &pb.DetailsRequest{})
+	if assert.NoError(err) {
+		assert.Equal(map[string]*pb.MetricDetails{"a.m1": {Size_: 42}}, details.Metrics)
+	}
+}
@@ -0,0 +1,186 @@
+package carbonserver
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+	"github.com/lomik/go-carbon/helper/tenant"
+)
+
+// seriesWriter writes series of streaming render response
+type seriesWriter interface {
+	Write(*pb.FetchResponse) error
+	Close() error
+}
+
+// protobufStreamWriter writes FetchResponse messages, each prefixed with varint length
+type protobufStreamWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (p *protobufStreamWriter) Write(r *pb.FetchResponse) error {
+	size := r.Size()
+	if cap(p.buf) < size+binary.MaxVarintLen64 {
+		p.buf = make([]byte, size+binary.MaxVarintLen64)
+	}
+	n := binary.PutUvarint(p.buf, uint64(size))
+	m, err := r.MarshalTo(p.buf[n:])
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(p.buf[:n+m])
+	return err
+}
+
+func (p *protobufStreamWriter) Close() error {
+	return nil
+}
+
+// jsonStreamWriter writes same document as json format of render, one series at a time
+type jsonStreamWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonStreamWriter) Write(r *pb.FetchResponse) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	prefix := ","
+	if j.count == 0 {
+		prefix = `{"metrics":[`
+	}
+	j.count++
+	if _, err = io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonStreamWriter) Close() error {
+	var err error
+	if j.count == 0 {
+		_, err = io.WriteString(j.w, `{"metrics":[]}`)
+	} else {
+		_, err = io.WriteString(j.w, "]}")
+	}
+	return err
+}
+
+// streamRender writes series of render response as they are fetched. Query cache is not used
+func (listener *CarbonserverListener) streamRender(ctx context.Context, wr http.ResponseWriter, logger *zap.Logger, format string, targets []string, fromTime, untilTime int32, tenantName string, opts renderOptions) (int, int, int, error) {
+	var sw seriesWriter
+	switch format {
+	case "json":
+		wr.Header().Set("Content-Type", "application/json")
+		sw = &jsonStreamWriter{w: wr}
+	case "protobuf3":
+		wr.Header().Set("Content-Type", "application/protobuf")
+		sw = &protobufStreamWriter{w: wr}
+	default:
+		return 0, 0, 0, errors.New("streaming is supported only for json and protobuf3 formats")
+	}
+
+	if opts.aggregate != "" {
+		return 0, 0, 0, errors.New("aggregate is not supported in streaming mode")
+	}
+
+	metrics, valuesFetched, memoryUsed, err := listener.fetchTargets(ctx, logger, targets, fromTime, untilTime, tenantName, opts, sw.Write)
+	if err == nil {
+		err = sw.Close()
+	}
+
+	listener.UpdateMetricsAccessTimesByRequest(metrics)
+	atomic.AddUint64(&listener.metrics.FetchSize, uint64(memoryUsed))
+
+	return len(metrics), valuesFetched, memoryUsed, err
+}
+
+// fetchTargets passes series of all metrics of targets to out as they are fetched. Series are consolidated
+// according to opts, aggregate is ignored. Fetched metrics are returned with full names
+func (listener *CarbonserverListener) fetchTargets(ctx context.Context, logger *zap.Logger, targets []string, fromTime, untilTime int32, tenantName string, opts renderOptions, out func(*pb.FetchResponse) error) ([]string, int, int, error) {
+	var files []string
+	for _, target := range targets {
+		expanded, leafs, err := listener.expandTarget(target)
+		if err != nil {
+			logger.Debug("expand globs returned an error", zap.Error(err))
+			continue
+		}
+		for i := range expanded {
+			if leafs[i] {
+				files = append(files, expanded[i])
+			}
+		}
+	}
+
+	var metrics []string
+	var valuesFetched, memoryUsed int
+
+	err := listener.fetchMetrics(ctx, files, fromTime, untilTime, opts.archives,
+		func(r *pb.FetchResponse) error {
+			metrics = append(metrics, r.Name)
+			valuesFetched += len(r.Values)
+			memoryUsed += r.Size()
+			if tenantName != "" {
+				r.Name, _ = tenant.Strip(tenantName, r.Name)
+			}
+			consolidate(r, opts.maxDataPoints, consolidateFuncs[opts.consolidateBy])
+			return out(r)
+		},
+	)
+
+	return metrics, valuesFetched, memoryUsed, err
+}
+
+// renderStream serves streaming render request. Errors after first written series can't be reported to client
+// and only logged
+func (listener *CarbonserverListener) renderStream(wr http.ResponseWriter, req *http.Request, t0 time.Time, logger, accessLogger *zap.Logger, format string, targets []string, from, until string, tenantName string, opts renderOptions) {
+	fromTime, untilTime, err := parseFromUntil(logger, from, until)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+		accessLogger.Error("fetch failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "failed to read data"),
+			zap.Int("http_code", http.StatusBadRequest),
+			zap.Error(err),
+		)
+		http.Error(wr, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metricsFetched, valuesFetched, memoryUsed, err := listener.streamRender(req.Context(), wr, logger, format, targets, fromTime, untilTime, tenantName, opts)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.RenderErrors, 1)
+		accessLogger.Error("fetch failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "streaming failed"),
+			zap.Int("metrics_fetched", metricsFetched),
+			zap.Error(err),
+		)
+		if metricsFetched == 0 {
+			http.Error(wr, "Bad request ("+err.Error()+")", http.StatusBadRequest)
+		}
+		return
+	}
+
+	logger.Info("fetch served",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+		zap.Bool("stream", true),
+		zap.Int("metrics_fetched", metricsFetched),
+		zap.Int("values_fetched", valuesFetched),
+		zap.Int("memory_used_bytes", memoryUsed),
+		zap.Int("http_code", http.StatusOK),
+	)
+}
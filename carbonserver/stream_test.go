@@ -0,0 +1,53 @@
+package carbonserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+)
+
+func TestStreamWriters(t *testing.T) {
+	assert := assert.New(t)
+
+	series := []*pb.FetchResponse{
+		{Name: "m1", StartTime: 60, StopTime: 180, StepTime: 60, Values: []float64{1, 0}, IsAbsent: []bool{false, true}},
+		{Name: "m2", StartTime: 60, StopTime: 120, StepTime: 60, Values: []float64{2}, IsAbsent: []bool{false}},
+	}
+
+	var buf bytes.Buffer
+	pw := &protobufStreamWriter{w: &buf}
+	for _, s := range series {
+		assert.NoError(pw.Write(s))
+	}
+	assert.NoError(pw.Close())
+
+	data := buf.Bytes()
+	for _, s := range series {
+		size, n := binary.Uvarint(data)
+		var r pb.FetchResponse
+		assert.NoError(r.Unmarshal(data[n : n+int(size)]))
+		assert.Equal(*s, r)
+		data = data[n+int(size):]
+	}
+	assert.Len(data, 0)
+
+	buf.Reset()
+	jw := &jsonStreamWriter{w: &buf}
+	for _, s := range series {
+		assert.NoError(jw.Write(s))
+	}
+	assert.NoError(jw.Close())
+
+	expected, _ := json.Marshal(pb.MultiFetchResponse{Metrics: series})
+	assert.JSONEq(string(expected), buf.String())
+
+	buf.Reset()
+	jw = &jsonStreamWriter{w: &buf}
+	assert.NoError(jw.Close())
+	assert.JSONEq(`{"metrics":[]}`, buf.String())
+}
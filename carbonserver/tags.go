@@ -0,0 +1,177 @@
+package carbonserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/tags"
+)
+
+// tagIndex is in-memory index of tagged series stored in _tagged directory
+type tagIndex struct {
+	sync.RWMutex
+	series map[string]map[string]string   // series -> tag -> value
+	values map[string]map[string][]string // tag -> value -> series
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		series: make(map[string]map[string]string),
+		values: make(map[string]map[string][]string),
+	}
+}
+
+func (ti *tagIndex) add(series string) {
+	t := tags.ParseSeries(series)
+
+	ti.Lock()
+	defer ti.Unlock()
+
+	if _, exists := ti.series[series]; exists {
+		return
+	}
+	ti.series[series] = t
+
+	for tag, value := range t {
+		v, ok := ti.values[tag]
+		if !ok {
+			v = make(map[string][]string)
+			ti.values[tag] = v
+		}
+		v[value] = append(v[value], series)
+	}
+}
+
+func (ti *tagIndex) len() int {
+	ti.RLock()
+	defer ti.RUnlock()
+	return len(ti.series)
+}
+
+// findSeries returns sorted list of series matched all expressions
+func (ti *tagIndex) findSeries(exprs []*tags.Expr) ([]string, error) {
+	// candidates are taken from values of first tag which can't be empty
+	first, err := tags.PositiveExpr(exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+
+	ti.RLock()
+	for value, list := range ti.values[first.Tag] {
+		if !first.Match(value) {
+			continue
+		}
+		for _, series := range list {
+			if tags.MatchAll(exprs, ti.series[series]) {
+				result = append(result, series)
+			}
+		}
+	}
+	ti.RUnlock()
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// AddTagged adds new tagged series to local tag index. Index is also rebuilt on every file list scan
+func (listener *CarbonserverListener) AddTagged(series string) {
+	fidx := listener.CurrentFileIndex()
+	if fidx != nil && fidx.tags != nil {
+		fidx.tags.add(series)
+	}
+}
+
+// findSeriesByTag finds tagged series in local tag index
+func (listener *CarbonserverListener) findSeriesByTag(exprs []*tags.Expr) ([]string, error) {
+	fidx := listener.CurrentFileIndex()
+	if fidx == nil || fidx.tags == nil {
+		return nil, errMetricsListEmpty
+	}
+	return fidx.tags.findSeries(exprs)
+}
+
+func (listener *CarbonserverListener) tagsFindSeriesHandler(wr http.ResponseWriter, req *http.Request) {
+	// URL: /tags/findSeries?expr=name=cpu&expr=host=~web.*
+	t0 := time.Now()
+	ctx := req.Context()
+
+	atomic.AddUint64(&listener.metrics.TagsRequests, 1)
+
+	req.ParseForm()
+	exprList := req.Form["expr"]
+
+	accessLogger := TraceContextToZap(ctx, listener.accessLogger.With(
+		zap.String("handler", "tags/findSeries"),
+		zap.String("url", req.URL.RequestURI()),
+		zap.String("peer", req.RemoteAddr),
+		zap.Strings("expr", exprList),
+	))
+
+	if requestTenant(req) != "" {
+		atomic.AddUint64(&listener.metrics.TagsErrors, 1)
+		accessLogger.Error("findSeries failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "not supported for tenants"),
+			zap.Int("http_code", http.StatusForbidden),
+		)
+		http.Error(wr, "Forbidden (tag queries are not supported for tenants)", http.StatusForbidden)
+		return
+	}
+
+	exprs, err := tags.ParseExprs(exprList)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.TagsErrors, 1)
+		accessLogger.Error("findSeries failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "bad tag expression"),
+			zap.Error(err),
+			zap.Int("http_code", http.StatusBadRequest),
+		)
+		http.Error(wr, fmt.Sprintf("Bad request (%s)", err), http.StatusBadRequest)
+		return
+	}
+
+	series, err := listener.findSeriesByTag(exprs)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.TagsErrors, 1)
+		accessLogger.Error("findSeries failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "can't find series"),
+			zap.Error(err),
+			zap.Int("http_code", http.StatusBadRequest),
+		)
+		http.Error(wr, fmt.Sprintf("Bad request (%s)", err), http.StatusBadRequest)
+		return
+	}
+
+	b, err := json.Marshal(series)
+	if err != nil {
+		atomic.AddUint64(&listener.metrics.TagsErrors, 1)
+		accessLogger.Error("findSeries failed",
+			zap.Duration("runtime_seconds", time.Since(t0)),
+			zap.String("reason", "response encode failed"),
+			zap.Error(err),
+			zap.Int("http_code", http.StatusInternalServerError),
+		)
+		http.Error(wr, fmt.Sprintf("An internal error has occured: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Write(b)
+
+	accessLogger.Info("findSeries served",
+		zap.Duration("runtime_seconds", time.Since(t0)),
+		zap.Int("series", len(series)),
+		zap.Int("http_code", http.StatusOK),
+	)
+}
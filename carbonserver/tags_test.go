@@ -0,0 +1,79 @@
+package carbonserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/tags"
+)
+
+func TestTagIndexFindSeries(t *testing.T) {
+	assert := assert.New(t)
+
+	idx := newTagIndex()
+	idx.add("cpu;dc=am;host=web01")
+	idx.add("cpu;dc=ny;host=web02")
+	idx.add("cpu;host=db01")
+	idx.add("mem;dc=am;host=web01")
+	idx.add("cpu;dc=am;host=web01")
+
+	table := []struct {
+		exprs    []string
+		expected []string
+		err      bool
+	}{
+		{[]string{"name=cpu"}, []string{"cpu;dc=am;host=web01", "cpu;dc=ny;host=web02", "cpu;host=db01"}, false},
+		{[]string{"name=cpu", "host=~web"}, []string{"cpu;dc=am;host=web01", "cpu;dc=ny;host=web02"}, false},
+		{[]string{"host=web01"}, []string{"cpu;dc=am;host=web01", "mem;dc=am;host=web01"}, false},
+		{[]string{"name=cpu", "dc!=am"}, []string{"cpu;dc=ny;host=web02", "cpu;host=db01"}, false},
+		{[]string{"name=cpu", "dc="}, []string{"cpu;host=db01"}, false},
+		{[]string{"name=~c|m", "host!=~web"}, []string{"cpu;host=db01"}, false},
+		{[]string{"name=disk"}, []string{}, false},
+		{[]string{"dc!=am"}, nil, true},
+		{[]string{"name=~.*"}, nil, true},
+	}
+
+	for _, tc := range table {
+		exprs, err := tags.ParseExprs(tc.exprs)
+		if !assert.NoError(err) {
+			continue
+		}
+		series, err := idx.findSeries(exprs)
+		if tc.err {
+			assert.Error(err, "%v", tc.exprs)
+		} else {
+			assert.NoError(err, "%v", tc.exprs)
+			assert.Equal(tc.expected, series, "%v", tc.exprs)
+		}
+	}
+}
+
+func TestTagsFindSeriesHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	carbonserver := NewCarbonserverListener(nil)
+
+	// index is not built yet
+	req := httptest.NewRequest("GET", "/tags/findSeries?expr=name=cpu", nil)
+	rr := httptest.NewRecorder()
+	carbonserver.tagsFindSeriesHandler(rr, req)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	carbonserver.UpdateFileIndex(&fileIndex{tags: newTagIndex()})
+	carbonserver.AddTagged("cpu;host=web01")
+	carbonserver.AddTagged("cpu;host=db01")
+
+	req = httptest.NewRequest("GET", "/tags/findSeries?expr=name=cpu&expr=host=~web", nil)
+	rr = httptest.NewRecorder()
+	carbonserver.tagsFindSeriesHandler(rr, req)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.JSONEq(`["cpu;host=web01"]`, rr.Body.String())
+
+	files, leafs, err := carbonserver.expandTarget("seriesByTag('name=cpu')")
+	assert.NoError(err)
+	assert.Equal([]string{"cpu;host=db01", "cpu;host=web01"}, files)
+	assert.Equal([]bool{true, true}, leafs)
+}
@@ -0,0 +1,69 @@
+package carbonserver
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	pb "github.com/lomik/go-carbon/helper/carbonzipperpb"
+	"github.com/lomik/go-carbon/helper/tenant"
+)
+
+type tenantContextKey struct{}
+
+// SetTenants enables tenant scoped queries. Requests should be authenticated with
+// "Authorization: Bearer <token>" header, metrics are searched under root of token tenant
+func (listener *CarbonserverListener) SetTenants(tenants *tenant.Tenants) {
+	listener.tenants = tenants
+}
+
+// tenantHandler authenticates request and stores tenant name in request context
+func (listener *CarbonserverListener) tenantHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		if listener.tenants == nil {
+			h(wr, req)
+			return
+		}
+
+		tenantName, ok := listener.tenants.Lookup(tenant.RequestToken(req))
+		if !ok {
+			atomic.AddUint64(&listener.metrics.TenantAuthErrors, 1)
+			http.Error(wr, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h(wr, req.WithContext(context.WithValue(req.Context(), tenantContextKey{}, tenantName)))
+	}
+}
+
+// requestTenant returns tenant of request or empty string if tenants are disabled
+func requestTenant(req *http.Request) string {
+	tenantName, _ := req.Context().Value(tenantContextKey{}).(string)
+	return tenantName
+}
+
+// tenantStripList returns metrics of tenant relative to tenant root
+func tenantStripList(tenantName string, metrics []string) []string {
+	result := make([]string, 0)
+	for _, m := range metrics {
+		if name, ok := tenant.Strip(tenantName, m); ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// tenantDetails returns details of tenant metrics relative to tenant root. All details are returned if tenantName is empty
+func tenantDetails(tenantName string, details map[string]*pb.MetricDetails) map[string]*pb.MetricDetails {
+	if tenantName == "" {
+		return details
+	}
+
+	result := make(map[string]*pb.MetricDetails)
+	for m, v := range details {
+		if name, ok := tenant.Strip(tenantName, m); ok {
+			result[name] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package carbonserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/helper/tenant"
+)
+
+func TestTenantFind(t *testing.T) {
+	assert := assert.New(t)
+
+	path, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	for _, f := range []string{"team/a/m1.wsp", "team/a/m2.wsp", "other/a/m3.wsp"} {
+		if err := os.MkdirAll(filepath.Join(path, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tenantsFile := filepath.Join(path, "tenants")
+	if err := ioutil.WriteFile(tenantsFile, []byte("secret team\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := tenant.Load(tenantsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	carbonserver := NewCarbonserverListener(nil)
+	carbonserver.SetWhisperData(path)
+	carbonserver.SetMaxGlobs(100)
+	carbonserver.SetTrigramIndex(false)
+	carbonserver.SetTenants(tenants)
+
+	h := carbonserver.tenantHandler(carbonserver.findHandler)
+
+	do := func(url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	assert.Equal(http.StatusUnauthorized, do("/metrics/find/?format=json&query=a.*", "").Code)
+	assert.Equal(http.StatusUnauthorized, do("/metrics/find/?format=json&query=a.*", "wrong").Code)
+
+	rr := do("/metrics/find/?format=json&query=a.*", "secret")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.JSONEq(`{"name":"a.*","matches":[{"path":"a.m1","isLeaf":true},{"path":"a.m2","isLeaf":true}]}`, rr.Body.String())
+
+	assert.Equal([]string{"a.m1"}, tenantStripList("team", []string{"team.a.m1", "other.a.m3"}))
+}
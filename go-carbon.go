@@ -19,6 +19,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/lomik/go-carbon/carbon"
+	"github.com/lomik/go-carbon/persister"
 	"github.com/lomik/go-carbon/points"
 
 	_ "net/http/pprof"
@@ -60,6 +61,10 @@ func main() {
 
 	cat := flag.String("cat", "", "Print cache dump file")
 
+	resize := flag.Bool("resize", false, "Resize whisper files which retentions or aggregation differ from storage-schemas.conf and storage-aggregation.conf and exit")
+	resizeDryRun := flag.Bool("resize-dry-run", false, "Only print whisper files which should be resized")
+	resizeFilesPerSecond := flag.Int("resize-files-per-second", 0, "Resize speed limit in checked files per second. 0 - unlimited")
+
 	flag.Parse()
 
 	if *printVersion {
@@ -117,6 +122,24 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// resize logs to configured destinations
+	if *resize || *resizeDryRun {
+		if !cfg.Whisper.Enabled {
+			log.Fatal("whisper is disabled in config")
+		}
+
+		r := persister.NewWhisperResize(cfg.Whisper.DataDir, cfg.Whisper.Schemas, cfg.Whisper.Aggregation)
+		r.SetDryRun(*resizeDryRun)
+		r.SetSparse(cfg.Whisper.Sparse)
+		r.SetFLock(cfg.Whisper.FLock)
+		r.SetMaxFilesPerSecond(*resizeFilesPerSecond)
+
+		if err = r.Run(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	mainLogger := zapwriter.Logger("main")
 
 	if *isDaemon {
@@ -13,6 +13,7 @@
 		Metric
 		Payload
 		CacheRequest
+		StoreResponse
 */
 package carbonpb
 
@@ -91,11 +92,23 @@ func (m *CacheRequest) String() string            { return proto.CompactTextStri
 func (*CacheRequest) ProtoMessage()               {}
 func (*CacheRequest) Descriptor() ([]byte, []int) { return fileDescriptorCarbon, []int{3} }
 
+type StoreResponse struct {
+	// accepted metrics and points
+	Metrics uint32 `protobuf:"varint,1,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	Points  uint32 `protobuf:"varint,2,opt,name=points,proto3" json:"points,omitempty"`
+}
+
+func (m *StoreResponse) Reset()                    { *m = StoreResponse{} }
+func (m *StoreResponse) String() string            { return proto.CompactTextString(m) }
+func (*StoreResponse) ProtoMessage()               {}
+func (*StoreResponse) Descriptor() ([]byte, []int) { return fileDescriptorCarbon, []int{4} }
+
 func init() {
 	proto.RegisterType((*Point)(nil), "carbonpb.Point")
 	proto.RegisterType((*Metric)(nil), "carbonpb.Metric")
 	proto.RegisterType((*Payload)(nil), "carbonpb.Payload")
 	proto.RegisterType((*CacheRequest)(nil), "carbonpb.CacheRequest")
+	proto.RegisterType((*StoreResponse)(nil), "carbonpb.StoreResponse")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -111,6 +124,10 @@ const _ = grpc.SupportPackageIsVersion3
 type CarbonClient interface {
 	// Same as carbonlink
 	CacheQuery(ctx context.Context, in *CacheRequest, opts ...grpc.CallOption) (*Payload, error)
+	// Stores stream of payloads. Counts of accepted metrics and points are returned after end of stream
+	Store(ctx context.Context, opts ...grpc.CallOption) (Carbon_StoreClient, error)
+	// Stores single payload
+	StorePayload(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*StoreResponse, error)
 }
 
 type carbonClient struct {
@@ -130,11 +147,58 @@ func (c *carbonClient) CacheQuery(ctx context.Context, in *CacheRequest, opts ..
 	return out, nil
 }
 
+func (c *carbonClient) Store(ctx context.Context, opts ...grpc.CallOption) (Carbon_StoreClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Carbon_serviceDesc.Streams[0], c.cc, "/carbonpb.Carbon/Store", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &carbonStoreClient{stream}
+	return x, nil
+}
+
+type Carbon_StoreClient interface {
+	Send(*Payload) error
+	CloseAndRecv() (*StoreResponse, error)
+	grpc.ClientStream
+}
+
+type carbonStoreClient struct {
+	grpc.ClientStream
+}
+
+func (x *carbonStoreClient) Send(m *Payload) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *carbonStoreClient) CloseAndRecv() (*StoreResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(StoreResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *carbonClient) StorePayload(ctx context.Context, in *Payload, opts ...grpc.CallOption) (*StoreResponse, error) {
+	out := new(StoreResponse)
+	err := grpc.Invoke(ctx, "/carbonpb.Carbon/StorePayload", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Carbon service
 
 type CarbonServer interface {
 	// Same as carbonlink
 	CacheQuery(context.Context, *CacheRequest) (*Payload, error)
+	// Stores stream of payloads. Counts of accepted metrics and points are returned after end of stream
+	Store(Carbon_StoreServer) error
+	// Stores single payload
+	StorePayload(context.Context, *Payload) (*StoreResponse, error)
 }
 
 func RegisterCarbonServer(s *grpc.Server, srv CarbonServer) {
@@ -159,6 +223,50 @@ func _Carbon_CacheQuery_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Carbon_Store_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CarbonServer).Store(&carbonStoreServer{stream})
+}
+
+type Carbon_StoreServer interface {
+	SendAndClose(*StoreResponse) error
+	Recv() (*Payload, error)
+	grpc.ServerStream
+}
+
+type carbonStoreServer struct {
+	grpc.ServerStream
+}
+
+func (x *carbonStoreServer) SendAndClose(m *StoreResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *carbonStoreServer) Recv() (*Payload, error) {
+	m := new(Payload)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Carbon_StorePayload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Payload)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonServer).StorePayload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/carbonpb.Carbon/StorePayload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonServer).StorePayload(ctx, req.(*Payload))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Carbon_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "carbonpb.Carbon",
 	HandlerType: (*CarbonServer)(nil),
@@ -167,8 +275,18 @@ var _Carbon_serviceDesc = grpc.ServiceDesc{
 			MethodName: "CacheQuery",
 			Handler:    _Carbon_CacheQuery_Handler,
 		},
+		{
+			MethodName: "StorePayload",
+			Handler:    _Carbon_StorePayload_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Store",
+			Handler:       _Carbon_Store_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: fileDescriptorCarbon,
 }
 
@@ -299,6 +417,34 @@ func (m *CacheRequest) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func (m *StoreResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *StoreResponse) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Metrics != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintCarbon(dAtA, i, uint64(m.Metrics))
+	}
+	if m.Points != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintCarbon(dAtA, i, uint64(m.Points))
+	}
+	return i, nil
+}
+
 func encodeFixed64Carbon(dAtA []byte, offset int, v uint64) int {
 	dAtA[offset] = uint8(v)
 	dAtA[offset+1] = uint8(v >> 8)
@@ -378,6 +524,18 @@ func (m *CacheRequest) Size() (n int) {
 	return n
 }
 
+func (m *StoreResponse) Size() (n int) {
+	var l int
+	_ = l
+	if m.Metrics != 0 {
+		n += 1 + sovCarbon(uint64(m.Metrics))
+	}
+	if m.Points != 0 {
+		n += 1 + sovCarbon(uint64(m.Points))
+	}
+	return n
+}
+
 func sovCarbon(x uint64) (n int) {
 	for {
 		n++
@@ -748,6 +906,94 @@ func (m *CacheRequest) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *StoreResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCarbon
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: StoreResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: StoreResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metrics", wireType)
+			}
+			m.Metrics = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Metrics |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Points", wireType)
+			}
+			m.Points = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbon
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Points |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCarbon(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCarbon
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipCarbon(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -856,23 +1102,26 @@ var (
 func init() { proto.RegisterFile("carbon.proto", fileDescriptorCarbon) }
 
 var fileDescriptorCarbon = []byte{
-	// 278 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x54, 0x90, 0xd1, 0x4a, 0xc3, 0x30,
-	0x14, 0x86, 0x97, 0xe9, 0x3a, 0x7b, 0xac, 0xa8, 0x41, 0x46, 0x19, 0x52, 0x4b, 0xaf, 0x8a, 0xb0,
-	0x0e, 0x26, 0x5e, 0x88, 0x77, 0xeb, 0xb5, 0x38, 0xf3, 0x06, 0x49, 0x8d, 0x5d, 0x61, 0x5d, 0x6a,
-	0x9b, 0x08, 0x7b, 0xc3, 0x5d, 0xfa, 0x04, 0x22, 0x7d, 0x12, 0xf1, 0x64, 0xb3, 0xf3, 0xee, 0xfc,
-	0xe1, 0xff, 0xbe, 0x73, 0x08, 0x78, 0x19, 0xaf, 0x85, 0x5a, 0x27, 0x55, 0xad, 0xb4, 0xa2, 0x27,
-	0x36, 0x55, 0x62, 0x3c, 0xc9, 0x0b, 0xbd, 0x34, 0x22, 0xc9, 0x54, 0x39, 0xcd, 0x55, 0xae, 0xa6,
-	0x58, 0x10, 0xe6, 0x0d, 0x13, 0x06, 0x9c, 0x2c, 0x18, 0x3d, 0xc2, 0x60, 0xa1, 0x8a, 0xb5, 0xa6,
-	0xd7, 0xe0, 0xea, 0xa2, 0x94, 0x8d, 0xe6, 0x65, 0xe5, 0x93, 0x90, 0xc4, 0x67, 0xac, 0x7b, 0xa0,
-	0x57, 0x30, 0xf8, 0xe0, 0x2b, 0x23, 0xfd, 0x7e, 0x48, 0x62, 0xc2, 0x6c, 0x88, 0x9e, 0xc1, 0x79,
-	0x92, 0xba, 0x2e, 0x32, 0x3a, 0x02, 0xa7, 0xc4, 0x09, 0x51, 0x97, 0xed, 0x12, 0x9d, 0x80, 0x53,
-	0xfd, 0xea, 0x1b, 0xbf, 0x1f, 0x1e, 0xc5, 0xa7, 0xb3, 0xf3, 0x64, 0x7f, 0x68, 0x82, 0x6b, 0xe7,
-	0xc7, 0xdb, 0xaf, 0x9b, 0x1e, 0xdb, 0x95, 0xa2, 0x7b, 0x18, 0x2e, 0xf8, 0x66, 0xa5, 0xf8, 0x2b,
-	0xbd, 0x85, 0xa1, 0x75, 0x34, 0x3e, 0x41, 0xf4, 0xa2, 0x43, 0xed, 0x52, 0xb6, 0x2f, 0x44, 0x31,
-	0x78, 0x29, 0xcf, 0x96, 0x92, 0xc9, 0x77, 0x23, 0x1b, 0x4d, 0xfd, 0xff, 0xac, 0xfb, 0xd7, 0x9c,
-	0xa5, 0xe0, 0xa4, 0x68, 0xa1, 0x0f, 0x00, 0xc8, 0xbc, 0x18, 0x59, 0x6f, 0xe8, 0xa8, 0x93, 0x1f,
-	0x9a, 0xc6, 0x97, 0x07, 0xf7, 0xda, 0xc3, 0xa2, 0xde, 0xdc, 0xdb, 0xb6, 0x01, 0xf9, 0x6c, 0x03,
-	0xf2, 0xdd, 0x06, 0x44, 0x38, 0xf8, 0x91, 0x77, 0x3f, 0x01, 0x00, 0x00, 0xff, 0xff, 0x96, 0x97,
-	0x56, 0x0a, 0x91, 0x01, 0x00, 0x00,
+	// 333 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x52, 0xd1, 0x4a, 0xeb, 0x40,
+	0x10, 0xed, 0xf6, 0xde, 0xa6, 0x76, 0x4c, 0x51, 0x07, 0xa9, 0xa1, 0x48, 0x2d, 0x79, 0x0a, 0x42,
+	0x53, 0xa8, 0x88, 0x88, 0xbe, 0xd8, 0x3e, 0x8b, 0x75, 0xfd, 0x82, 0x24, 0xae, 0x6d, 0xa0, 0xe9,
+	0xc6, 0x64, 0x23, 0xf4, 0xd7, 0xfc, 0x82, 0x3e, 0xfa, 0x05, 0x22, 0xfd, 0x12, 0xc9, 0x6c, 0x63,
+	0x1a, 0x7c, 0xf2, 0x6d, 0xce, 0xcc, 0x39, 0x33, 0xe7, 0x2c, 0x0b, 0x66, 0xe0, 0x25, 0xbe, 0x5c,
+	0xba, 0x71, 0x22, 0x95, 0xc4, 0x3d, 0x8d, 0x62, 0xbf, 0x3b, 0x98, 0x85, 0x6a, 0x9e, 0xf9, 0x6e,
+	0x20, 0xa3, 0xe1, 0x4c, 0xce, 0xe4, 0x90, 0x08, 0x7e, 0xf6, 0x42, 0x88, 0x00, 0x55, 0x5a, 0x68,
+	0xdf, 0x40, 0x63, 0x2a, 0xc3, 0xa5, 0xc2, 0x53, 0x68, 0xa9, 0x30, 0x12, 0xa9, 0xf2, 0xa2, 0xd8,
+	0x62, 0x7d, 0xe6, 0xb4, 0x79, 0xd9, 0xc0, 0x63, 0x68, 0xbc, 0x79, 0x8b, 0x4c, 0x58, 0xf5, 0x3e,
+	0x73, 0x18, 0xd7, 0xc0, 0x7e, 0x00, 0xe3, 0x5e, 0xa8, 0x24, 0x0c, 0xb0, 0x03, 0x46, 0x44, 0x15,
+	0x49, 0x5b, 0x7c, 0x8b, 0x70, 0x00, 0x46, 0x9c, 0xaf, 0x4f, 0xad, 0x7a, 0xff, 0x9f, 0xb3, 0x3f,
+	0x3a, 0x70, 0x0b, 0xa3, 0x2e, 0x9d, 0x1d, 0xff, 0x5f, 0x7f, 0x9e, 0xd5, 0xf8, 0x96, 0x64, 0x5f,
+	0x42, 0x73, 0xea, 0xad, 0x16, 0xd2, 0x7b, 0xc6, 0x73, 0x68, 0xea, 0x1d, 0xa9, 0xc5, 0x48, 0x7a,
+	0x58, 0x4a, 0xf5, 0x51, 0x5e, 0x10, 0x6c, 0x07, 0xcc, 0x89, 0x17, 0xcc, 0x05, 0x17, 0xaf, 0x99,
+	0x48, 0x15, 0x5a, 0x55, 0x6d, 0xab, 0x64, 0xde, 0x41, 0xfb, 0x49, 0xc9, 0x44, 0x70, 0x91, 0xc6,
+	0x72, 0x99, 0x8a, 0x2a, 0x35, 0x0f, 0x5d, 0xc0, 0x3c, 0xd2, 0x8f, 0xf5, 0x7c, 0xb0, 0x45, 0xa3,
+	0x77, 0x06, 0xc6, 0x84, 0x9c, 0xe0, 0x35, 0x00, 0xdd, 0x7d, 0xcc, 0x44, 0xb2, 0xc2, 0x4e, 0x69,
+	0x70, 0xd7, 0x4d, 0xf7, 0x68, 0x27, 0xb3, 0x0e, 0x67, 0xd7, 0xf0, 0x0a, 0x1a, 0x64, 0x04, 0x7f,
+	0x4f, 0xbb, 0x27, 0x65, 0xab, 0x62, 0xd6, 0xae, 0x39, 0x0c, 0x6f, 0xc1, 0xa4, 0x66, 0xf1, 0x4e,
+	0x7f, 0xd2, 0x8f, 0xcd, 0xf5, 0xa6, 0xc7, 0x3e, 0x36, 0x3d, 0xf6, 0xb5, 0xe9, 0x31, 0xdf, 0xa0,
+	0x3f, 0x70, 0xf1, 0x3d, 0x00, 0xf3, 0xa8, 0x81, 0xff, 0x4c, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,1289 @@
+// Code generated by protoc-gen-gogo.
+// source: carbonserver.proto
+// DO NOT EDIT!
+
+package carbonzipperpb
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+import io "io"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type FindRequest struct {
+	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+}
+
+func (m *FindRequest) Reset()                    { *m = FindRequest{} }
+func (m *FindRequest) String() string            { return proto.CompactTextString(m) }
+func (*FindRequest) ProtoMessage()               {}
+func (*FindRequest) Descriptor() ([]byte, []int) { return fileDescriptorCarbonserver, []int{0} }
+
+func (m *FindRequest) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+type FetchRequest struct {
+	Targets       []string `protobuf:"bytes,1,rep,name=targets" json:"targets,omitempty"`
+	From          int32    `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"`
+	Until         int32    `protobuf:"varint,3,opt,name=until,proto3" json:"until,omitempty"`
+	MaxDataPoints int32    `protobuf:"varint,4,opt,name=maxDataPoints,proto3" json:"maxDataPoints,omitempty"`
+	ConsolidateBy string   `protobuf:"bytes,5,opt,name=consolidateBy,proto3" json:"consolidateBy,omitempty"`
+	Aggregate     string   `protobuf:"bytes,6,opt,name=aggregate,proto3" json:"aggregate,omitempty"`
+	Archive       string   `protobuf:"bytes,7,opt,name=archive,proto3" json:"archive,omitempty"`
+	Step          int32    `protobuf:"varint,8,opt,name=step,proto3" json:"step,omitempty"`
+}
+
+func (m *FetchRequest) Reset()                    { *m = FetchRequest{} }
+func (m *FetchRequest) String() string            { return proto.CompactTextString(m) }
+func (*FetchRequest) ProtoMessage()               {}
+func (*FetchRequest) Descriptor() ([]byte, []int) { return fileDescriptorCarbonserver, []int{1} }
+
+func (m *FetchRequest) GetTargets() []string {
+	if m != nil {
+		return m.Targets
+	}
+	return nil
+}
+
+func (m *FetchRequest) GetFrom() int32 {
+	if m != nil {
+		return m.From
+	}
+	return 0
+}
+
+func (m *FetchRequest) GetUntil() int32 {
+	if m != nil {
+		return m.Until
+	}
+	return 0
+}
+
+func (m *FetchRequest) GetMaxDataPoints() int32 {
+	if m != nil {
+		return m.MaxDataPoints
+	}
+	return 0
+}
+
+func (m *FetchRequest) GetConsolidateBy() string {
+	if m != nil {
+		return m.ConsolidateBy
+	}
+	return ""
+}
+
+func (m *FetchRequest) GetAggregate() string {
+	if m != nil {
+		return m.Aggregate
+	}
+	return ""
+}
+
+func (m *FetchRequest) GetArchive() string {
+	if m != nil {
+		return m.Archive
+	}
+	return ""
+}
+
+func (m *FetchRequest) GetStep() int32 {
+	if m != nil {
+		return m.Step
+	}
+	return 0
+}
+
+type InfoRequest struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (m *InfoRequest) Reset()                    { *m = InfoRequest{} }
+func (m *InfoRequest) String() string            { return proto.CompactTextString(m) }
+func (*InfoRequest) ProtoMessage()               {}
+func (*InfoRequest) Descriptor() ([]byte, []int) { return fileDescriptorCarbonserver, []int{2} }
+
+func (m *InfoRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type ListRequest struct {
+}
+
+func (m *ListRequest) Reset()                    { *m = ListRequest{} }
+func (m *ListRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListRequest) ProtoMessage()               {}
+func (*ListRequest) Descriptor() ([]byte, []int) { return fileDescriptorCarbonserver, []int{3} }
+
+type DetailsRequest struct {
+}
+
+func (m *DetailsRequest) Reset()                    { *m = DetailsRequest{} }
+func (m *DetailsRequest) String() string            { return proto.CompactTextString(m) }
+func (*DetailsRequest) ProtoMessage()               {}
+func (*DetailsRequest) Descriptor() ([]byte, []int) { return fileDescriptorCarbonserver, []int{4} }
+
+func init() {
+	proto.RegisterType((*FindRequest)(nil), "carbonzipperpb.FindRequest")
+	proto.RegisterType((*FetchRequest)(nil), "carbonzipperpb.FetchRequest")
+	proto.RegisterType((*InfoRequest)(nil), "carbonzipperpb.InfoRequest")
+	proto.RegisterType((*ListRequest)(nil), "carbonzipperpb.ListRequest")
+	proto.RegisterType((*DetailsRequest)(nil), "carbonzipperpb.DetailsRequest")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for Carbonserver service
+
+type CarbonserverClient interface {
+	// Finds metrics matching glob, same as /metrics/find/
+	Find(ctx context.Context, in *FindRequest, opts ...grpc.CallOption) (*GlobResponse, error)
+	// Streams series of all metrics matching targets, same as /render/
+	Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (Carbonserver_FetchClient, error)
+	// Returns whisper file info, same as /info/
+	Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error)
+	// Returns all known metrics, same as /metrics/list/
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	// Returns all known metrics with file details, same as /metrics/details/
+	Details(ctx context.Context, in *DetailsRequest, opts ...grpc.CallOption) (*MetricDetailsResponse, error)
+}
+
+type carbonserverClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCarbonserverClient(cc *grpc.ClientConn) CarbonserverClient {
+	return &carbonserverClient{cc}
+}
+
+func (c *carbonserverClient) Find(ctx context.Context, in *FindRequest, opts ...grpc.CallOption) (*GlobResponse, error) {
+	out := new(GlobResponse)
+	err := grpc.Invoke(ctx, "/carbonzipperpb.Carbonserver/Find", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *carbonserverClient) Fetch(ctx context.Context, in *FetchRequest, opts ...grpc.CallOption) (Carbonserver_FetchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Carbonserver_serviceDesc.Streams[0], c.cc, "/carbonzipperpb.Carbonserver/Fetch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &carbonserverFetchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Carbonserver_FetchClient interface {
+	Recv() (*FetchResponse, error)
+	grpc.ClientStream
+}
+
+type carbonserverFetchClient struct {
+	grpc.ClientStream
+}
+
+func (x *carbonserverFetchClient) Recv() (*FetchResponse, error) {
+	m := new(FetchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *carbonserverClient) Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error) {
+	out := new(InfoResponse)
+	err := grpc.Invoke(ctx, "/carbonzipperpb.Carbonserver/Info", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *carbonserverClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
+	out := new(ListMetricsResponse)
+	err := grpc.Invoke(ctx, "/carbonzipperpb.Carbonserver/List", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *carbonserverClient) Details(ctx context.Context, in *DetailsRequest, opts ...grpc.CallOption) (*MetricDetailsResponse, error) {
+	out := new(MetricDetailsResponse)
+	err := grpc.Invoke(ctx, "/carbonzipperpb.Carbonserver/Details", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Carbonserver service
+
+type CarbonserverServer interface {
+	// Finds metrics matching glob, same as /metrics/find/
+	Find(context.Context, *FindRequest) (*GlobResponse, error)
+	// Streams series of all metrics matching targets, same as /render/
+	Fetch(*FetchRequest, Carbonserver_FetchServer) error
+	// Returns whisper file info, same as /info/
+	Info(context.Context, *InfoRequest) (*InfoResponse, error)
+	// Returns all known metrics, same as /metrics/list/
+	List(context.Context, *ListRequest) (*ListMetricsResponse, error)
+	// Returns all known metrics with file details, same as /metrics/details/
+	Details(context.Context, *DetailsRequest) (*MetricDetailsResponse, error)
+}
+
+func RegisterCarbonserverServer(s *grpc.Server, srv CarbonserverServer) {
+	s.RegisterService(&_Carbonserver_serviceDesc, srv)
+}
+
+func _Carbonserver_Find_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonserverServer).Find(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/carbonzipperpb.Carbonserver/Find",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonserverServer).Find(ctx, req.(*FindRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Carbonserver_Fetch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CarbonserverServer).Fetch(m, &carbonserverFetchServer{stream})
+}
+
+type Carbonserver_FetchServer interface {
+	Send(*FetchResponse) error
+	grpc.ServerStream
+}
+
+type carbonserverFetchServer struct {
+	grpc.ServerStream
+}
+
+func (x *carbonserverFetchServer) Send(m *FetchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Carbonserver_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonserverServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/carbonzipperpb.Carbonserver/Info",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonserverServer).Info(ctx, req.(*InfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Carbonserver_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonserverServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/carbonzipperpb.Carbonserver/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonserverServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Carbonserver_Details_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DetailsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CarbonserverServer).Details(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/carbonzipperpb.Carbonserver/Details",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CarbonserverServer).Details(ctx, req.(*DetailsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Carbonserver_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "carbonzipperpb.Carbonserver",
+	HandlerType: (*CarbonserverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Find",
+			Handler:    _Carbonserver_Find_Handler,
+		},
+		{
+			MethodName: "Info",
+			Handler:    _Carbonserver_Info_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Carbonserver_List_Handler,
+		},
+		{
+			MethodName: "Details",
+			Handler:    _Carbonserver_Details_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Fetch",
+			Handler:       _Carbonserver_Fetch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: fileDescriptorCarbonserver,
+}
+
+func (m *FindRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FindRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Query) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(len(m.Query)))
+		i += copy(dAtA[i:], m.Query)
+	}
+	return i, nil
+}
+
+func (m *FetchRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FetchRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Targets) > 0 {
+		for _, s := range m.Targets {
+			dAtA[i] = 0xa
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				dAtA[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			dAtA[i] = uint8(l)
+			i++
+			i += copy(dAtA[i:], s)
+		}
+	}
+	if m.From != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(m.From))
+	}
+	if m.Until != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(m.Until))
+	}
+	if m.MaxDataPoints != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(m.MaxDataPoints))
+	}
+	if len(m.ConsolidateBy) > 0 {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(len(m.ConsolidateBy)))
+		i += copy(dAtA[i:], m.ConsolidateBy)
+	}
+	if len(m.Aggregate) > 0 {
+		dAtA[i] = 0x32
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(len(m.Aggregate)))
+		i += copy(dAtA[i:], m.Aggregate)
+	}
+	if len(m.Archive) > 0 {
+		dAtA[i] = 0x3a
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(len(m.Archive)))
+		i += copy(dAtA[i:], m.Archive)
+	}
+	if m.Step != 0 {
+		dAtA[i] = 0x40
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(m.Step))
+	}
+	return i, nil
+}
+
+func (m *InfoRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *InfoRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Name) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintCarbonserver(dAtA, i, uint64(len(m.Name)))
+		i += copy(dAtA[i:], m.Name)
+	}
+	return i, nil
+}
+
+func (m *ListRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ListRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	return i, nil
+}
+
+func (m *DetailsRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *DetailsRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	return i, nil
+}
+
+func encodeFixed64Carbonserver(dAtA []byte, offset int, v uint64) int {
+	dAtA[offset] = uint8(v)
+	dAtA[offset+1] = uint8(v >> 8)
+	dAtA[offset+2] = uint8(v >> 16)
+	dAtA[offset+3] = uint8(v >> 24)
+	dAtA[offset+4] = uint8(v >> 32)
+	dAtA[offset+5] = uint8(v >> 40)
+	dAtA[offset+6] = uint8(v >> 48)
+	dAtA[offset+7] = uint8(v >> 56)
+	return offset + 8
+}
+func encodeFixed32Carbonserver(dAtA []byte, offset int, v uint32) int {
+	dAtA[offset] = uint8(v)
+	dAtA[offset+1] = uint8(v >> 8)
+	dAtA[offset+2] = uint8(v >> 16)
+	dAtA[offset+3] = uint8(v >> 24)
+	return offset + 4
+}
+func encodeVarintCarbonserver(dAtA []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return offset + 1
+}
+func (m *FindRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Query)
+	if l > 0 {
+		n += 1 + l + sovCarbonserver(uint64(l))
+	}
+	return n
+}
+
+func (m *FetchRequest) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.Targets) > 0 {
+		for _, s := range m.Targets {
+			l = len(s)
+			n += 1 + l + sovCarbonserver(uint64(l))
+		}
+	}
+	if m.From != 0 {
+		n += 1 + sovCarbonserver(uint64(m.From))
+	}
+	if m.Until != 0 {
+		n += 1 + sovCarbonserver(uint64(m.Until))
+	}
+	if m.MaxDataPoints != 0 {
+		n += 1 + sovCarbonserver(uint64(m.MaxDataPoints))
+	}
+	l = len(m.ConsolidateBy)
+	if l > 0 {
+		n += 1 + l + sovCarbonserver(uint64(l))
+	}
+	l = len(m.Aggregate)
+	if l > 0 {
+		n += 1 + l + sovCarbonserver(uint64(l))
+	}
+	l = len(m.Archive)
+	if l > 0 {
+		n += 1 + l + sovCarbonserver(uint64(l))
+	}
+	if m.Step != 0 {
+		n += 1 + sovCarbonserver(uint64(m.Step))
+	}
+	return n
+}
+
+func (m *InfoRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovCarbonserver(uint64(l))
+	}
+	return n
+}
+
+func (m *ListRequest) Size() (n int) {
+	var l int
+	_ = l
+	return n
+}
+
+func (m *DetailsRequest) Size() (n int) {
+	var l int
+	_ = l
+	return n
+}
+
+func sovCarbonserver(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozCarbonserver(x uint64) (n int) {
+	return sovCarbonserver(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *FindRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCarbonserver
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: FindRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: FindRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Query", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Query = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCarbonserver(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *FetchRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCarbonserver
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: FetchRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: FetchRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Targets", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Targets = append(m.Targets, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field From", wireType)
+			}
+			m.From = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.From |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Until", wireType)
+			}
+			m.Until = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Until |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxDataPoints", wireType)
+			}
+			m.MaxDataPoints = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxDataPoints |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ConsolidateBy", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ConsolidateBy = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Aggregate", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Aggregate = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Archive", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Archive = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Step", wireType)
+			}
+			m.Step = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Step |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCarbonserver(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *InfoRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCarbonserver
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: InfoRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: InfoRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCarbonserver(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ListRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCarbonserver
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ListRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ListRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCarbonserver(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *DetailsRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCarbonserver
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DetailsRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DetailsRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCarbonserver(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCarbonserver
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipCarbonserver(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowCarbonserver
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowCarbonserver
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			iNdEx += length
+			if length < 0 {
+				return 0, ErrInvalidLengthCarbonserver
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowCarbonserver
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipCarbonserver(dAtA[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthCarbonserver = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowCarbonserver   = fmt.Errorf("proto: integer overflow")
+)
+
+func init() { proto.RegisterFile("carbonserver.proto", fileDescriptorCarbonserver) }
+
+var fileDescriptorCarbonserver = []byte{
+	// 384 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x74, 0x52, 0xed, 0x6e, 0xda, 0x30,
+	0x14, 0x5d, 0x46, 0x02, 0xe3, 0xf2, 0xa1, 0xc9, 0xda, 0x0f, 0x2b, 0x63, 0x13, 0x0b, 0x9b, 0xc4,
+	0x2f, 0x34, 0x6d, 0x6f, 0x30, 0x10, 0xdb, 0xaa, 0x56, 0xaa, 0xf2, 0x06, 0x4e, 0xb8, 0x04, 0x4b,
+	0x21, 0x0e, 0xb6, 0x41, 0xa5, 0x3f, 0xfb, 0xb8, 0x7d, 0x8a, 0xca, 0x4e, 0x42, 0x13, 0xa0, 0xff,
+	0x7c, 0xcf, 0x39, 0x39, 0x3a, 0xf7, 0xdc, 0x00, 0x89, 0x99, 0x8c, 0x44, 0xa6, 0x50, 0x1e, 0x50,
+	0xce, 0x72, 0x29, 0xb4, 0x20, 0xc3, 0x02, 0x7b, 0xe4, 0x79, 0x8e, 0x32, 0x8f, 0x7c, 0x52, 0x9f,
+	0x0b, 0x4d, 0x30, 0x81, 0xde, 0x92, 0x67, 0xab, 0x10, 0x77, 0x7b, 0x54, 0x9a, 0x7c, 0x02, 0x6f,
+	0xb7, 0x47, 0x79, 0xa4, 0xce, 0xd8, 0x99, 0x76, 0xc3, 0x62, 0x08, 0x9e, 0x1d, 0xe8, 0x2f, 0x51,
+	0xc7, 0x9b, 0x4a, 0x46, 0xa1, 0xa3, 0x99, 0x4c, 0x50, 0x2b, 0xea, 0x8c, 0x5b, 0xd3, 0x6e, 0x58,
+	0x8d, 0x84, 0x80, 0xbb, 0x96, 0x62, 0x4b, 0xdf, 0x8f, 0x9d, 0xa9, 0x17, 0xda, 0xb7, 0x31, 0xdd,
+	0x67, 0x9a, 0xa7, 0xb4, 0x65, 0xc1, 0x62, 0x20, 0xdf, 0x61, 0xb0, 0x65, 0x0f, 0x0b, 0xa6, 0xd9,
+	0xbd, 0xe0, 0x99, 0x56, 0xd4, 0xb5, 0x6c, 0x13, 0x34, 0xaa, 0x58, 0x64, 0x4a, 0xa4, 0x7c, 0xc5,
+	0x34, 0xfe, 0x39, 0x52, 0xcf, 0x06, 0x6b, 0x82, 0x64, 0x04, 0x5d, 0x96, 0x24, 0x12, 0x13, 0xa6,
+	0x91, 0xb6, 0xad, 0xe2, 0x15, 0x30, 0x69, 0x99, 0x8c, 0x37, 0xfc, 0x80, 0xb4, 0x63, 0xb9, 0x6a,
+	0x34, 0x69, 0x95, 0xc6, 0x9c, 0x7e, 0x28, 0xd2, 0x9a, 0x77, 0xf0, 0x0d, 0x7a, 0xff, 0xb3, 0xb5,
+	0xa8, 0x56, 0x25, 0xe0, 0x66, 0x6c, 0x8b, 0x65, 0x21, 0xf6, 0x1d, 0x0c, 0xa0, 0x77, 0xcb, 0x95,
+	0x2e, 0x25, 0xc1, 0x47, 0x18, 0x2e, 0x50, 0x33, 0x9e, 0xaa, 0x12, 0xf9, 0xf5, 0xd4, 0x82, 0xfe,
+	0xbc, 0x76, 0x10, 0x32, 0x07, 0xd7, 0xd4, 0x4c, 0x3e, 0xcf, 0x9a, 0x37, 0x99, 0xd5, 0xca, 0xf7,
+	0x47, 0xe7, 0xe4, 0xdf, 0x54, 0x44, 0x21, 0xaa, 0xdc, 0xd8, 0x04, 0xef, 0xc8, 0x3f, 0xf0, 0xec,
+	0x15, 0xc8, 0x85, 0xb0, 0x7e, 0x1c, 0xff, 0xcb, 0x1b, 0x6c, 0xe5, 0xf3, 0xd3, 0x31, 0x71, 0xcc,
+	0x8e, 0x97, 0x71, 0x6a, 0x9b, 0xfb, 0xa3, 0xeb, 0xe4, 0x29, 0xce, 0x0d, 0xb8, 0xa6, 0x85, 0x4b,
+	0x93, 0x5a, 0x37, 0xfe, 0xe4, 0x1a, 0x79, 0x87, 0x5a, 0xf2, 0x58, 0xd5, 0xbc, 0x42, 0xe8, 0x94,
+	0x15, 0x92, 0xaf, 0xe7, 0x5f, 0x34, 0xbb, 0xf5, 0x7f, 0x9c, 0xf3, 0x85, 0xdb, 0x49, 0x55, 0x79,
+	0x46, 0x6d, 0xfb, 0x87, 0xff, 0x7e, 0x19, 0x00, 0x50, 0xab, 0xa3, 0xd2, 0x1b, 0x03, 0x00, 0x00,
+}
@@ -41,12 +41,14 @@ var _ = math.Inf
 const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
 
 type FetchResponse struct {
-	Name      string    `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	StartTime int32     `protobuf:"varint,2,opt,name=startTime,proto3" json:"startTime,omitempty"`
-	StopTime  int32     `protobuf:"varint,3,opt,name=stopTime,proto3" json:"stopTime,omitempty"`
-	StepTime  int32     `protobuf:"varint,4,opt,name=stepTime,proto3" json:"stepTime,omitempty"`
-	Values    []float64 `protobuf:"fixed64,5,rep,packed,name=values" json:"values,omitempty"`
-	IsAbsent  []bool    `protobuf:"varint,6,rep,packed,name=isAbsent" json:"isAbsent,omitempty"`
+	Name      string     `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	StartTime int32      `protobuf:"varint,2,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	StopTime  int32      `protobuf:"varint,3,opt,name=stopTime,proto3" json:"stopTime,omitempty"`
+	StepTime  int32      `protobuf:"varint,4,opt,name=stepTime,proto3" json:"stepTime,omitempty"`
+	Values    []float64  `protobuf:"fixed64,5,rep,packed,name=values" json:"values,omitempty"`
+	IsAbsent  []bool     `protobuf:"varint,6,rep,packed,name=isAbsent" json:"isAbsent,omitempty"`
+	Archive   int32      `protobuf:"varint,7,opt,name=archive,proto3" json:"archive,omitempty"`
+	Retention *Retention `protobuf:"bytes,8,opt,name=retention" json:"retention,omitempty"`
 }
 
 func (m *FetchResponse) Reset()                    { *m = FetchResponse{} }
@@ -96,6 +98,20 @@ func (m *FetchResponse) GetIsAbsent() []bool {
 	return nil
 }
 
+func (m *FetchResponse) GetArchive() int32 {
+	if m != nil {
+		return m.Archive
+	}
+	return 0
+}
+
+func (m *FetchResponse) GetRetention() *Retention {
+	if m != nil {
+		return m.Retention
+	}
+	return nil
+}
+
 type MultiFetchResponse struct {
 	Metrics []*FetchResponse `protobuf:"bytes,1,rep,name=metrics" json:"metrics,omitempty"`
 }
@@ -448,6 +464,21 @@ func (m *FetchResponse) MarshalTo(dAtA []byte) (int, error) {
 			i++
 		}
 	}
+	if m.Archive != 0 {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintCarbonzipper(dAtA, i, uint64(m.Archive))
+	}
+	if m.Retention != nil {
+		dAtA[i] = 0x42
+		i++
+		i = encodeVarintCarbonzipper(dAtA, i, uint64(m.Retention.Size()))
+		n2, err := m.Retention.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
 	return i, nil
 }
 
@@ -656,11 +687,11 @@ func (m *ServerInfoResponse) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x12
 		i++
 		i = encodeVarintCarbonzipper(dAtA, i, uint64(m.Info.Size()))
-		n2, err := m.Info.MarshalTo(dAtA[i:])
+		n3, err := m.Info.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n2
+		i += n3
 	}
 	return i, nil
 }
@@ -801,11 +832,11 @@ func (m *MetricDetailsResponse) MarshalTo(dAtA []byte) (int, error) {
 				dAtA[i] = 0x12
 				i++
 				i = encodeVarintCarbonzipper(dAtA, i, uint64(v.Size()))
-				n3, err := v.MarshalTo(dAtA[i:])
+				n4, err := v.MarshalTo(dAtA[i:])
 				if err != nil {
 					return 0, err
 				}
-				i += n3
+				i += n4
 			}
 		}
 	}
@@ -871,6 +902,13 @@ func (m *FetchResponse) Size() (n int) {
 	if len(m.IsAbsent) > 0 {
 		n += 1 + sovCarbonzipper(uint64(len(m.IsAbsent))) + len(m.IsAbsent)*1
 	}
+	if m.Archive != 0 {
+		n += 1 + sovCarbonzipper(uint64(m.Archive))
+	}
+	if m.Retention != nil {
+		l = m.Retention.Size()
+		n += 1 + l + sovCarbonzipper(uint64(l))
+	}
 	return n
 }
 
@@ -1284,6 +1322,58 @@ func (m *FetchResponse) Unmarshal(dAtA []byte) error {
 			} else {
 				return fmt.Errorf("proto: wrong wireType = %d for field IsAbsent", wireType)
 			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Archive", wireType)
+			}
+			m.Archive = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonzipper
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Archive |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Retention", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCarbonzipper
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthCarbonzipper
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Retention == nil {
+				m.Retention = &Retention{}
+			}
+			if err := m.Retention.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipCarbonzipper(dAtA[iNdEx:])
@@ -2570,44 +2660,46 @@ var (
 func init() { proto.RegisterFile("carbonzipper.proto", fileDescriptorCarbonzipper) }
 
 var fileDescriptorCarbonzipper = []byte{
-	// 623 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x54, 0xdd, 0x4e, 0x13, 0x41,
-	0x14, 0xce, 0x76, 0xdb, 0xc2, 0x1e, 0x0a, 0xea, 0xa8, 0x64, 0x25, 0xd0, 0x34, 0x73, 0x61, 0x7a,
-	0x61, 0xd0, 0xc0, 0x05, 0xea, 0x95, 0x18, 0xad, 0x31, 0xa1, 0x91, 0x0c, 0x44, 0xa3, 0x89, 0x26,
-	0xd3, 0xe5, 0x94, 0x4e, 0x68, 0x77, 0x36, 0x33, 0x03, 0x01, 0xde, 0xc9, 0xf7, 0xf0, 0xd2, 0xc4,
-	0x17, 0x30, 0x3c, 0x88, 0x31, 0x33, 0xb3, 0xbb, 0x74, 0x17, 0xc2, 0xdd, 0xf9, 0xbe, 0xf3, 0x33,
-	0xdf, 0x99, 0x39, 0x67, 0x80, 0x24, 0x5c, 0x8d, 0x64, 0x7a, 0x29, 0xb2, 0x0c, 0xd5, 0x66, 0xa6,
-	0xa4, 0x91, 0x64, 0x65, 0x9e, 0xcb, 0x46, 0xf4, 0x67, 0x00, 0xcb, 0x03, 0x34, 0xc9, 0x84, 0xa1,
-	0xce, 0x64, 0xaa, 0x91, 0x10, 0x68, 0xa6, 0x7c, 0x86, 0x71, 0xd0, 0x0b, 0xfa, 0x11, 0x73, 0x36,
-	0x59, 0x87, 0x48, 0x1b, 0xae, 0xcc, 0xa1, 0x98, 0x61, 0xdc, 0xe8, 0x05, 0xfd, 0x16, 0xbb, 0x26,
-	0xc8, 0x1a, 0x2c, 0x6a, 0x23, 0x33, 0xe7, 0x0c, 0x9d, 0xb3, 0xc4, 0xde, 0x87, 0xde, 0xd7, 0x2c,
-	0x7c, 0x1e, 0x93, 0x55, 0x68, 0x9f, 0xf1, 0xe9, 0x29, 0xea, 0xb8, 0xd5, 0x0b, 0xfb, 0x01, 0xcb,
-	0x91, 0xcd, 0x11, 0x7a, 0x77, 0xa4, 0x31, 0x35, 0x71, 0xbb, 0x17, 0xf6, 0x17, 0x59, 0x89, 0xe9,
-	0x10, 0xc8, 0xf0, 0x74, 0x6a, 0x44, 0x55, 0xf3, 0x0e, 0x2c, 0xcc, 0xd0, 0x28, 0x91, 0xe8, 0x38,
-	0xe8, 0x85, 0xfd, 0xa5, 0xad, 0x8d, 0xcd, 0x6a, 0x9f, 0x9b, 0x95, 0x78, 0x56, 0x44, 0xd3, 0x1d,
-	0x88, 0x3e, 0x4c, 0xe5, 0x68, 0xc8, 0x4d, 0x32, 0xb1, 0x9d, 0x67, 0xdc, 0x4c, 0x8a, 0xce, 0xad,
-	0x6d, 0x35, 0x0a, 0xbd, 0x87, 0x7c, 0xec, 0xda, 0x5e, 0x64, 0x39, 0xa2, 0x5f, 0xa0, 0x63, 0x13,
-	0xef, 0xbc, 0xb5, 0x6d, 0x58, 0x98, 0xd9, 0xc2, 0xa8, 0xe3, 0x86, 0x53, 0xf5, 0xa4, 0xae, 0xaa,
-	0x3c, 0x9b, 0x15, 0x91, 0xf4, 0x3b, 0x44, 0x0c, 0x0d, 0xa6, 0x46, 0xc8, 0x94, 0xf4, 0xe1, 0x9e,
-	0xc6, 0x44, 0xa6, 0x47, 0x7a, 0x1f, 0xd5, 0xbe, 0x14, 0xa9, 0x71, 0x07, 0xb4, 0x58, 0x9d, 0x26,
-	0x4f, 0x61, 0x25, 0x3d, 0x9d, 0x8d, 0x50, 0x7d, 0x1a, 0x3b, 0x42, 0xe7, 0xcf, 0x54, 0x63, 0xe9,
-	0x9f, 0x00, 0x3a, 0x1f, 0xd3, 0xb1, 0xbc, 0x53, 0xf8, 0x33, 0x78, 0xc0, 0x8f, 0x8f, 0x15, 0x1e,
-	0x73, 0xab, 0x62, 0x88, 0x66, 0x22, 0x8f, 0x5c, 0xbd, 0x88, 0xdd, 0x74, 0x10, 0x0a, 0x9d, 0x19,
-	0x3f, 0x2f, 0x45, 0xe7, 0x23, 0x50, 0xe1, 0x6c, 0xcc, 0xf9, 0x40, 0x4c, 0x51, 0x0f, 0x78, 0x62,
-	0xa4, 0x72, 0xa3, 0xd0, 0x60, 0x15, 0x8e, 0xbc, 0x02, 0x50, 0x45, 0x82, 0x1f, 0x89, 0x5b, 0x6e,
-	0xac, 0x2c, 0xc9, 0xe6, 0x82, 0xe9, 0x0f, 0x20, 0x07, 0xa8, 0xce, 0x50, 0x55, 0x5a, 0x5b, 0x85,
-	0xb6, 0x76, 0x6c, 0xde, 0x5c, 0x8e, 0xc8, 0x0b, 0x68, 0x8a, 0x74, 0x2c, 0x5d, 0x47, 0x4b, 0x5b,
-	0xeb, 0xf5, 0x23, 0xe6, 0x6b, 0x30, 0x17, 0x49, 0x3f, 0x03, 0xf9, 0xe6, 0xdc, 0x95, 0xfa, 0x6f,
-	0x20, 0x52, 0xb9, 0x5d, 0xcc, 0x1d, 0xad, 0x17, 0xbb, 0x29, 0x8b, 0x5d, 0x27, 0xd1, 0xe7, 0xf0,
-	0x70, 0x4f, 0x68, 0x33, 0xf4, 0xd3, 0x58, 0x16, 0x8e, 0x61, 0x61, 0x38, 0x37, 0xce, 0x11, 0x2b,
-	0x20, 0x3d, 0x81, 0x65, 0x6f, 0xbe, 0x43, 0xc3, 0xc5, 0x54, 0xdb, 0xe7, 0x3b, 0x10, 0x97, 0x7e,
-	0x29, 0x43, 0xe6, 0x6c, 0x97, 0x2e, 0x8f, 0xca, 0x75, 0x0c, 0x59, 0x01, 0xc9, 0x23, 0x68, 0xed,
-	0x96, 0xab, 0x18, 0x32, 0x0f, 0xec, 0x3d, 0x31, 0x1f, 0xde, 0x72, 0x74, 0x8e, 0xe8, 0xbf, 0x00,
-	0x1e, 0x57, 0x4e, 0x2b, 0x05, 0xee, 0xd5, 0xf7, 0x6d, 0xab, 0xde, 0xf7, 0xad, 0x79, 0x39, 0xab,
-	0xdf, 0xa7, 0x46, 0x5d, 0x94, 0x4b, 0x68, 0x7f, 0x97, 0x81, 0x42, 0x3c, 0xc8, 0x78, 0xe2, 0x1b,
-	0x69, 0xb2, 0x6b, 0x82, 0x74, 0x01, 0x0e, 0xa5, 0xe1, 0x53, 0xef, 0x0e, 0x9d, 0x7b, 0x8e, 0x59,
-	0xfb, 0x0a, 0x9d, 0xf9, 0xb2, 0xe4, 0x3e, 0x84, 0x27, 0x78, 0x91, 0x3f, 0xb9, 0x35, 0xc9, 0x36,
-	0xb4, 0xdc, 0xcf, 0x92, 0x3f, 0xf8, 0xc6, 0xdd, 0x5a, 0x7d, 0xec, 0xeb, 0xc6, 0xcb, 0xe0, 0x6d,
-	0xe7, 0xd7, 0x55, 0x37, 0xf8, 0x7d, 0xd5, 0x0d, 0xfe, 0x5e, 0x75, 0x83, 0x51, 0xdb, 0xfd, 0xa0,
-	0xdb, 0xff, 0x03, 0x00, 0x00, 0xff, 0xff, 0xd3, 0x62, 0x83, 0x17, 0x57, 0x05, 0x00, 0x00,
+	// 651 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x7c, 0x54, 0x4f, 0x6f, 0xd3, 0x4a,
+	0x10, 0x97, 0xe3, 0xfc, 0xf3, 0x34, 0xed, 0x7b, 0x6f, 0x1f, 0x54, 0xa6, 0x6a, 0x23, 0xcb, 0x07,
+	0xe4, 0x03, 0x2a, 0x28, 0x3d, 0x14, 0x38, 0x51, 0x04, 0x41, 0x48, 0x8d, 0xa8, 0xb6, 0x15, 0x08,
+	0x24, 0x90, 0x36, 0xee, 0xa4, 0x59, 0x35, 0xf1, 0x5a, 0xbb, 0xdb, 0xaa, 0xed, 0x89, 0x8f, 0xc7,
+	0x11, 0x89, 0x2f, 0x80, 0xfa, 0x41, 0x10, 0xf2, 0xae, 0xed, 0xc4, 0x6e, 0x95, 0xdb, 0xfc, 0x7e,
+	0xf3, 0xdb, 0xd9, 0x99, 0x9d, 0x99, 0x05, 0x12, 0x33, 0x39, 0x16, 0xc9, 0x0d, 0x4f, 0x53, 0x94,
+	0xbb, 0xa9, 0x14, 0x5a, 0x90, 0x8d, 0x65, 0x2e, 0x1d, 0x87, 0xdf, 0x1b, 0xb0, 0x3e, 0x44, 0x1d,
+	0x4f, 0x29, 0xaa, 0x54, 0x24, 0x0a, 0x09, 0x81, 0x66, 0xc2, 0xe6, 0xe8, 0x3b, 0x81, 0x13, 0x79,
+	0xd4, 0xd8, 0x64, 0x1b, 0x3c, 0xa5, 0x99, 0xd4, 0x27, 0x7c, 0x8e, 0x7e, 0x23, 0x70, 0xa2, 0x16,
+	0x5d, 0x10, 0x64, 0x0b, 0xba, 0x4a, 0x8b, 0xd4, 0x38, 0x5d, 0xe3, 0x2c, 0xb1, 0xf5, 0xa1, 0xf5,
+	0x35, 0x0b, 0x9f, 0xc5, 0x64, 0x13, 0xda, 0x97, 0x6c, 0x76, 0x81, 0xca, 0x6f, 0x05, 0x6e, 0xe4,
+	0xd0, 0x1c, 0x65, 0x67, 0xb8, 0x3a, 0x18, 0x2b, 0x4c, 0xb4, 0xdf, 0x0e, 0xdc, 0xa8, 0x4b, 0x4b,
+	0x4c, 0x7c, 0xe8, 0x30, 0x19, 0x4f, 0xf9, 0x25, 0xfa, 0x1d, 0x13, 0xae, 0x80, 0x64, 0x1f, 0x3c,
+	0x89, 0x1a, 0x13, 0xcd, 0x45, 0xe2, 0x77, 0x03, 0x27, 0x5a, 0x1b, 0x3c, 0xda, 0xad, 0x56, 0xbb,
+	0x4b, 0x0b, 0x01, 0x5d, 0x68, 0xc3, 0x11, 0x90, 0xd1, 0xc5, 0x4c, 0xf3, 0xea, 0x33, 0xec, 0x43,
+	0x67, 0x8e, 0x5a, 0xf2, 0x58, 0xf9, 0x4e, 0xe0, 0x46, 0x6b, 0x83, 0x9d, 0x7a, 0xb0, 0x8a, 0x9e,
+	0x16, 0xea, 0x70, 0x1f, 0xbc, 0x77, 0x33, 0x31, 0x1e, 0x31, 0x1d, 0x4f, 0xb3, 0xc7, 0x4c, 0x99,
+	0x9e, 0x16, 0x8f, 0x99, 0xd9, 0x59, 0xd9, 0x5c, 0x1d, 0x22, 0x9b, 0x98, 0x97, 0xec, 0xd2, 0x1c,
+	0x85, 0x9f, 0xa0, 0x97, 0x1d, 0x5c, 0xd9, 0x88, 0x3d, 0xe8, 0xcc, 0xb3, 0xc0, 0xa8, 0xfc, 0x46,
+	0xe0, 0xde, 0x57, 0x62, 0x79, 0x37, 0x2d, 0x94, 0xe1, 0x57, 0xf0, 0xca, 0xc2, 0x49, 0x04, 0xff,
+	0x28, 0x8c, 0x45, 0x72, 0xaa, 0x8e, 0x50, 0x1e, 0x09, 0x9e, 0x68, 0x73, 0x41, 0x8b, 0xd6, 0x69,
+	0xf2, 0x18, 0x36, 0x92, 0x8b, 0xf9, 0x18, 0xe5, 0x87, 0x89, 0x21, 0x54, 0xde, 0xf9, 0x1a, 0x1b,
+	0xfe, 0x72, 0xa0, 0xf7, 0x3e, 0x99, 0x88, 0x95, 0x89, 0x3f, 0x81, 0xff, 0xd8, 0xd9, 0x99, 0xc4,
+	0x33, 0x96, 0x65, 0x31, 0x42, 0x3d, 0x15, 0xa7, 0x26, 0x9e, 0x47, 0xef, 0x3a, 0x48, 0x08, 0xbd,
+	0x39, 0xbb, 0x2a, 0x93, 0xce, 0xa7, 0xaa, 0xc2, 0x65, 0x9a, 0xab, 0x21, 0x9f, 0xa1, 0x1a, 0xb2,
+	0x58, 0x0b, 0x69, 0xa6, 0xab, 0x41, 0x2b, 0x1c, 0x79, 0x01, 0x50, 0xf6, 0xd9, 0x4e, 0xd9, 0xca,
+	0xa1, 0x58, 0x12, 0x87, 0xdf, 0x80, 0x1c, 0xa3, 0xbc, 0x44, 0x59, 0x29, 0x6d, 0x13, 0xda, 0xca,
+	0xb0, 0x79, 0x71, 0x39, 0x22, 0xcf, 0xa0, 0xc9, 0x93, 0x89, 0x30, 0x15, 0xad, 0x0d, 0xb6, 0xeb,
+	0x57, 0x2c, 0xc7, 0xa0, 0x46, 0x19, 0x7e, 0x04, 0xf2, 0xc5, 0xb8, 0x2b, 0xf1, 0x5f, 0x65, 0x43,
+	0x6c, 0xed, 0x62, 0xee, 0xc2, 0x7a, 0xb0, 0xbb, 0x69, 0xd1, 0xc5, 0xa1, 0xf0, 0x29, 0xfc, 0x7f,
+	0xc8, 0x95, 0x1e, 0xd9, 0x69, 0x2c, 0x03, 0xfb, 0xd0, 0x19, 0x2d, 0x8d, 0xb3, 0x47, 0x0b, 0x18,
+	0x9e, 0xc3, 0xba, 0x35, 0xdf, 0xa0, 0x66, 0x7c, 0xa6, 0xb2, 0xf6, 0x1d, 0xf3, 0x1b, 0xbb, 0xe7,
+	0x2e, 0x35, 0xb6, 0x39, 0x2e, 0x4e, 0xcb, 0x0d, 0x77, 0x69, 0x01, 0xc9, 0x03, 0x68, 0x1d, 0x94,
+	0xdb, 0xed, 0x52, 0x0b, 0xb2, 0x77, 0xa2, 0x56, 0xde, 0x32, 0x74, 0x8e, 0xc2, 0x3f, 0x0e, 0x3c,
+	0xac, 0xdc, 0x56, 0x26, 0x78, 0x58, 0xdf, 0xb7, 0x41, 0xbd, 0xee, 0x7b, 0xcf, 0xe5, 0xac, 0x7a,
+	0x9b, 0x68, 0x79, 0x5d, 0x2e, 0x61, 0xf6, 0x61, 0x0d, 0x25, 0xe2, 0x71, 0xca, 0x62, 0x5b, 0x48,
+	0x93, 0x2e, 0x08, 0xd2, 0x07, 0x38, 0x11, 0x9a, 0xcd, 0xac, 0xdb, 0x35, 0xee, 0x25, 0x66, 0xeb,
+	0x33, 0xf4, 0x96, 0xc3, 0x92, 0x7f, 0xc1, 0x3d, 0xc7, 0xeb, 0xbc, 0xe5, 0x99, 0x49, 0xf6, 0xa0,
+	0x65, 0x3e, 0xab, 0xbc, 0xe1, 0x3b, 0xab, 0x73, 0xb5, 0xda, 0x97, 0x8d, 0xe7, 0xce, 0xeb, 0xde,
+	0x8f, 0xdb, 0xbe, 0xf3, 0xf3, 0xb6, 0xef, 0xfc, 0xbe, 0xed, 0x3b, 0xe3, 0xb6, 0xf9, 0x94, 0xf7,
+	0xfe, 0x0e, 0x00, 0xd0, 0x4f, 0x50, 0x5d, 0xaa, 0x05, 0x00, 0x00,
 }
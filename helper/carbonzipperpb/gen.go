@@ -1,3 +1,4 @@
 package carbonzipperpb
 
 //go:generate protoc --gogofast_out=. carbonzipper.proto
+//go:generate protoc --gogofast_out=plugins=grpc:. carbonserver.proto
@@ -0,0 +1,3 @@
+package prompb
+
+//go:generate protoc --gogofast_out=. remote.proto --proto_path=../../vendor/ --proto_path=.
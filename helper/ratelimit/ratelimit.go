@@ -0,0 +1,294 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ActionDrop   = "drop"   // over-limit points are silently dropped
+	ActionReject = "reject" // tcp connection is closed, http request is answered with 429 Too Many Requests
+)
+
+// buckets not used during cleanupInterval are removed
+const cleanupInterval = time.Minute
+
+// Options of token bucket limits. Rates are in points per second, 0 - unlimited
+type Options struct {
+	Enabled        bool   `toml:"enabled"`
+	PerIP          int    `toml:"per-ip"`
+	PerIPBurst     int    `toml:"per-ip-burst"`
+	PerPrefix      int    `toml:"per-prefix"`
+	PerPrefixBurst int    `toml:"per-prefix-burst"`
+	PrefixDepth    int    `toml:"prefix-depth"`
+	Action         string `toml:"action"`
+}
+
+// NewOptions returns default options
+func NewOptions() *Options {
+	return &Options{
+		Enabled:     false,
+		PrefixDepth: 1,
+		Action:      ActionDrop,
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds tokens for time passed since last call
+func (b *bucket) refill(rate, burst float64, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+}
+
+// buckets of limit are divided to shardCount maps with own locks to avoid lock contention of receivers
+const shardCount = 64
+
+type shard struct {
+	sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+}
+
+type limit struct {
+	rate   float64
+	burst  float64
+	shards [shardCount]shard
+}
+
+func newLimit(rate, burst int, now time.Time) *limit {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	l := &limit{
+		rate:  float64(rate),
+		burst: float64(burst),
+	}
+	for i := 0; i < shardCount; i++ {
+		l.shards[i].buckets = make(map[string]*bucket)
+		l.shards[i].lastCleanup = now
+	}
+	return l
+}
+
+// hash function
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	const prime32 = uint32(16777619)
+	for i := 0; i < len(key); i++ {
+		hash *= prime32
+		hash ^= uint32(key[i])
+	}
+	return hash
+}
+
+// lock returns locked shard and refilled bucket of key
+func (l *limit) lock(key string, now time.Time) (*shard, *bucket) {
+	s := &l.shards[fnv32(key)%shardCount]
+	s.Lock()
+
+	if now.Sub(s.lastCleanup) > cleanupInterval {
+		for k, b := range s.buckets {
+			if now.Sub(b.last) > cleanupInterval {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		s.buckets[key] = b
+		return s, b
+	}
+	b.refill(l.rate, l.burst, now)
+	return s, b
+}
+
+type limits struct {
+	perIP       *limit
+	perPrefix   *limit
+	prefixDepth int
+}
+
+// Limiter limits points rate per client IP and per metric prefix
+type Limiter struct {
+	enabled int32        // atomic, fast path for disabled limiter
+	reject  int32        // atomic
+	limits  atomic.Value // *limits
+}
+
+// New creates Limiter with options
+func New(options *Options) (*Limiter, error) {
+	l := &Limiter{}
+	if err := l.Update(options); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// reuse returns current limit if it has same rate and burst, so state of its buckets is kept. Otherwise new limit
+// is created
+func (l *limit) reuse(rate, burst int, now time.Time) *limit {
+	if burst <= 0 {
+		burst = rate
+	}
+	if l != nil && rate > 0 && l.rate == float64(rate) && l.burst == float64(burst) {
+		return l
+	}
+	return newLimit(rate, burst, now)
+}
+
+// Update replaces options of limiter. State of buckets is kept for limits with unchanged rate and burst
+func (l *Limiter) Update(options *Options) error {
+	if options.Action != ActionDrop && options.Action != ActionReject {
+		return fmt.Errorf("unknown rate limit action %#v", options.Action)
+	}
+	if options.PerPrefix > 0 && options.PrefixDepth <= 0 {
+		return fmt.Errorf("rate limit prefix-depth should be positive")
+	}
+
+	// buckets are kept on reload (SIGHUP), otherwise every reload gives all clients full burst
+	old, _ := l.limits.Load().(*limits)
+	if old == nil {
+		old = &limits{}
+	}
+	oldPrefix := old.perPrefix
+	if old.prefixDepth != options.PrefixDepth {
+		// buckets are keyed by prefix of other depth
+		oldPrefix = nil
+	}
+
+	now := time.Now()
+	ls := &limits{
+		perIP:       old.perIP.reuse(options.PerIP, options.PerIPBurst, now),
+		perPrefix:   oldPrefix.reuse(options.PerPrefix, options.PerPrefixBurst, now),
+		prefixDepth: options.PrefixDepth,
+	}
+	l.limits.Store(ls)
+
+	var enabled, reject int32
+	if options.Enabled && (ls.perIP != nil || ls.perPrefix != nil) {
+		enabled = 1
+	}
+	if options.Action == ActionReject {
+		reject = 1
+	}
+	atomic.StoreInt32(&l.enabled, enabled)
+	atomic.StoreInt32(&l.reject, reject)
+
+	return nil
+}
+
+// Prefix returns first depth nodes of metric name
+func Prefix(metric string, depth int) string {
+	// tags are not part of prefix
+	if i := strings.IndexByte(metric, ';'); i >= 0 {
+		metric = metric[:i]
+	}
+	offset := 0
+	for n := 0; n < depth; n++ {
+		i := strings.IndexByte(metric[offset:], '.')
+		if i < 0 {
+			return metric
+		}
+		offset += i + 1
+	}
+	return metric[:offset-1]
+}
+
+// enough returns true if bucket can pay n tokens. Batch bigger than burst is allowed if bucket is full, bucket goes
+// into debt then and next batches wait until it is paid back by refill
+func (b *bucket) enough(n, burst float64) bool {
+	if n > burst {
+		n = burst
+	}
+	return b.tokens >= n
+}
+
+// Allow takes count tokens from buckets of ip and metric prefix. Returns false if any bucket has not enough tokens
+func (l *Limiter) Allow(ip string, metric string, count int) bool {
+	if atomic.LoadInt32(&l.enabled) == 0 {
+		return true
+	}
+
+	ls := l.limits.Load().(*limits)
+	now := time.Now()
+	n := float64(count)
+
+	// shard of ip is always locked before shard of prefix, they belong to different limits
+	var ipBucket, prefixBucket *bucket
+
+	if ls.perIP != nil {
+		var s *shard
+		s, ipBucket = ls.perIP.lock(ip, now)
+		defer s.Unlock()
+		if !ipBucket.enough(n, ls.perIP.burst) {
+			return false
+		}
+	}
+
+	if ls.perPrefix != nil {
+		var s *shard
+		s, prefixBucket = ls.perPrefix.lock(Prefix(metric, ls.prefixDepth), now)
+		defer s.Unlock()
+		if !prefixBucket.enough(n, ls.perPrefix.burst) {
+			return false
+		}
+	}
+
+	if ipBucket != nil {
+		ipBucket.tokens -= n
+	}
+	if prefixBucket != nil {
+		prefixBucket.tokens -= n
+	}
+
+	return true
+}
+
+// Reject returns true if clients over limit should be rejected instead of silent drop of points
+func (l *Limiter) Reject() bool {
+	return atomic.LoadInt32(&l.reject) != 0
+}
+
+// HostIP returns host part of "host:port" address
+func HostIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// limiter shared by all receivers. Configured by Configure on start and reload of config
+var defaultLimiter, _ = New(NewOptions())
+
+// Configure updates options of shared limiter used by receivers
+func Configure(options *Options) error {
+	return defaultLimiter.Update(options)
+}
+
+// Allow calls Allow of shared limiter
+func Allow(ip string, metric string, count int) bool {
+	return defaultLimiter.Allow(ip, metric, count)
+}
+
+// Reject calls Reject of shared limiter
+func Reject() bool {
+	return defaultLimiter.Reject()
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(&Options{Action: "unknown"})
+	assert.Error(err)
+
+	_, err = New(&Options{Action: ActionDrop, PerPrefix: 10, PrefixDepth: 0})
+	assert.Error(err)
+
+	// disabled limiter allows everything
+	l, err := New(&Options{Enabled: false, PerIP: 1, Action: ActionDrop})
+	if !assert.NoError(err) {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		assert.True(l.Allow("127.0.0.1", "a.b", 1))
+	}
+
+	assert.NoError(l.Update(&Options{Enabled: true, PerIP: 1000, PerIPBurst: 10, Action: ActionReject}))
+	assert.True(l.Reject())
+	assert.True(l.Allow("127.0.0.1", "a.b", 8))
+	assert.False(l.Allow("127.0.0.1", "a.b", 8))
+	assert.True(l.Allow("127.0.0.2", "a.b", 8))
+
+	assert.NoError(l.Update(&Options{Enabled: true, PerPrefix: 1000, PerPrefixBurst: 10, PrefixDepth: 1, Action: ActionDrop}))
+	assert.False(l.Reject())
+	assert.True(l.Allow("127.0.0.1", "a.b", 10))
+	assert.False(l.Allow("127.0.0.2", "a.c", 1))
+	assert.True(l.Allow("127.0.0.1", "b.c", 10))
+
+	// tokens are not taken from ip bucket if prefix is over limit
+	assert.NoError(l.Update(&Options{Enabled: true, PerIP: 1000, PerIPBurst: 10, PerPrefix: 1000, PerPrefixBurst: 5, PrefixDepth: 1, Action: ActionDrop}))
+	assert.True(l.Allow("127.0.0.1", "a.b", 5))
+	assert.False(l.Allow("127.0.0.1", "a.b", 5))
+	assert.True(l.Allow("127.0.0.1", "b.c", 5))
+	assert.False(l.Allow("127.0.0.1", "c.d", 1))
+}
+
+func TestLimiterDebt(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := New(&Options{Enabled: true, PerIP: 1, PerIPBurst: 10, Action: ActionReject})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// batch bigger than burst is allowed with full bucket, next batches wait until debt is paid
+	assert.True(l.Allow("127.0.0.1", "a.b", 100))
+	assert.False(l.Allow("127.0.0.1", "a.b", 1))
+	assert.False(l.Allow("127.0.0.1", "a.b", 100))
+	assert.True(l.Allow("127.0.0.2", "a.b", 10))
+	assert.False(l.Allow("127.0.0.2", "a.b", 100))
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := New(&Options{Enabled: true, PerIP: 1, PerIPBurst: 10, PerPrefix: 1, PerPrefixBurst: 10, PrefixDepth: 1, Action: ActionDrop})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(l.Allow("127.0.0.1", "a.b", 10))
+	assert.True(l.Allow("127.0.0.2", "b.c", 10))
+
+	// unchanged limits keep buckets
+	assert.NoError(l.Update(&Options{Enabled: true, PerIP: 1, PerIPBurst: 10, PerPrefix: 1, PerPrefixBurst: 10, PrefixDepth: 1, Action: ActionReject}))
+	assert.False(l.Allow("127.0.0.1", "c.d", 1))
+	assert.False(l.Allow("127.0.0.3", "b.c", 1))
+
+	// changed limits start with full buckets
+	assert.NoError(l.Update(&Options{Enabled: true, PerIP: 2, PerIPBurst: 10, PerPrefix: 1, PerPrefixBurst: 10, PrefixDepth: 2, Action: ActionReject}))
+	assert.True(l.Allow("127.0.0.1", "c.d", 1))
+	assert.True(l.Allow("127.0.0.3", "b.c", 1))
+}
+
+func TestPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("a", Prefix("a.b.c", 1))
+	assert.Equal("a.b", Prefix("a.b.c", 2))
+	assert.Equal("a.b.c", Prefix("a.b.c", 3))
+	assert.Equal("a.b.c", Prefix("a.b.c", 4))
+	assert.Equal("cpu", Prefix("cpu;host=a.b", 1))
+
+	assert.Equal("127.0.0.1", HostIP("127.0.0.1:2003"))
+	assert.Equal("::1", HostIP("[::1]:2003"))
+	assert.Equal("local", HostIP("local"))
+}
+
+func BenchmarkAllow(b *testing.B) {
+	l, err := New(&Options{Enabled: true, PerIP: 1e9, PerPrefix: 1e9, PrefixDepth: 1, Action: ActionDrop})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	metrics := make([]string, 1024)
+	for i := range metrics {
+		metrics[i] = fmt.Sprintf("prefix%d.metric", i)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			l.Allow(fmt.Sprintf("127.0.0.%d", i%256), metrics[i%len(metrics)], 1)
+			i++
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package socket
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UnixPrefix is prefix of listen address of unix socket: "unix:///var/run/go-carbon.sock".
+// Abstract socket (linux only) is "unix://@go-carbon"
+const UnixPrefix = "unix://"
+
+// Permissions of unix socket file. Ignored for tcp, udp and abstract sockets
+type Permissions struct {
+	Mode  string `toml:"socket-mode"`  // octal, e.g. "0660". Empty - umask default
+	Owner string `toml:"socket-owner"` // "user", "user:group" or ":group". Numeric ids are allowed
+}
+
+// IsUnix returns true if listen is address of unix socket
+func IsUnix(listen string) bool {
+	return strings.HasPrefix(listen, UnixPrefix)
+}
+
+// unixPath returns path of unix socket from listen address
+func unixPath(listen string) (string, error) {
+	path := strings.TrimPrefix(listen, UnixPrefix)
+	if path == "" || path == "@" {
+		return "", fmt.Errorf("empty unix socket path in %#v", listen)
+	}
+	return path, nil
+}
+
+func isAbstract(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// removeStale removes socket file left by previous process. Error is returned if socket is still in use
+func removeStale(network, path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%#v exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial(network, path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %#v is already in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+func lookupUser(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGroup(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// Check validates mode and owner
+func (p *Permissions) Check() error {
+	if p == nil {
+		return nil
+	}
+	if p.Mode != "" {
+		if _, err := strconv.ParseUint(p.Mode, 8, 32); err != nil {
+			return fmt.Errorf("invalid socket-mode %#v, octal number expected", p.Mode)
+		}
+	}
+	if p.Owner != "" {
+		if _, _, err := p.owner(); err != nil {
+			return fmt.Errorf("invalid socket-owner %#v: %s", p.Owner, err.Error())
+		}
+	}
+	return nil
+}
+
+// owner returns uid and gid of Owner. -1 - not changed
+func (p *Permissions) owner() (uid int, gid int, err error) {
+	uid, gid = -1, -1
+
+	userName := p.Owner
+	groupName := ""
+	if i := strings.IndexByte(p.Owner, ':'); i >= 0 {
+		userName, groupName = p.Owner[:i], p.Owner[i+1:]
+	}
+
+	if userName != "" {
+		if uid, err = lookupUser(userName); err != nil {
+			return
+		}
+	}
+
+	if groupName != "" {
+		if gid, err = lookupGroup(groupName); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// apply sets mode and owner of socket file
+func (p *Permissions) apply(path string) error {
+	if p == nil || isAbstract(path) {
+		return nil
+	}
+
+	if p.Mode != "" {
+		mode, err := strconv.ParseUint(p.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid socket-mode %#v, octal number expected", p.Mode)
+		}
+		if err = os.Chmod(path, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	if p.Owner != "" {
+		uid, gid, err := p.owner()
+		if err != nil {
+			return fmt.Errorf("invalid socket-owner %#v: %s", p.Owner, err.Error())
+		}
+		if err = os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isEmpty returns true if permissions don't change mode and owner of socket file
+func (p *Permissions) isEmpty() bool {
+	return p == nil || (p.Mode == "" && p.Owner == "")
+}
+
+// bind creates socket file at path. If permissions are set socket is created in private directory next to path,
+// mode and owner are applied there and then file is moved to path. So socket is never reachable with mode and
+// owner derived from umask
+func bind(path string, permissions *Permissions, create func(path string) (io.Closer, error)) (io.Closer, error) {
+	if isAbstract(path) || permissions.isEmpty() {
+		return create(path)
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, "s")
+
+	c, err := create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = permissions.apply(tmpPath); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// unixListener removes socket file on close. Socket is bound to temporary path, so net.UnixListener can't do it
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// Listen announces on tcp address or on unix stream socket if listen is "unix://<path>"
+func Listen(listen string, permissions *Permissions) (net.Listener, error) {
+	if !IsUnix(listen) {
+		return net.Listen("tcp", listen)
+	}
+
+	path, err := unixPath(listen)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAbstract(path) {
+		if err = removeStale("unix", path); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := bind(path, permissions, func(path string) (io.Closer, error) {
+		return net.Listen("unix", path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l := c.(*net.UnixListener)
+	if isAbstract(path) || permissions.isEmpty() {
+		return l, nil
+	}
+
+	l.SetUnlinkOnClose(false)
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// ListenPacket announces on udp address or on unix datagram socket if listen is "unix://<path>"
+func ListenPacket(listen string, permissions *Permissions) (net.PacketConn, error) {
+	if !IsUnix(listen) {
+		return net.ListenPacket("udp", listen)
+	}
+
+	path, err := unixPath(listen)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAbstract(path) {
+		if err = removeStale("unixgram", path); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := bind(path, permissions, func(path string) (io.Closer, error) {
+		return net.ListenPacket("unixgram", path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.(net.PacketConn), nil
+}
@@ -0,0 +1,125 @@
+package socket
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lomik/go-carbon/helper/qa"
+)
+
+func TestListenUnix(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		path := filepath.Join(dir, "carbon.sock")
+
+		l, err := Listen(UnixPrefix+path, &Permissions{Mode: "0640", Owner: ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0640 {
+			t.Fatalf("unexpected mode %s", fi.Mode())
+		}
+
+		// socket is bound in private directory, which is removed after move of socket to path
+		if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+			t.Fatalf("unexpected files in socket directory: %v %v", files, err)
+		}
+
+		// socket in use
+		if _, err = Listen(UnixPrefix+path, nil); err == nil {
+			t.Fatal("listen of used socket should fail")
+		}
+
+		l.Close()
+
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("socket file is not removed on close: %v", err)
+		}
+
+		if l, err = Listen(UnixPrefix+path, &Permissions{Mode: "0600"}); err != nil {
+			t.Fatal(err)
+		}
+		c, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		l.Close()
+
+		if conn, err := ListenPacket(UnixPrefix+path, &Permissions{Mode: "0620"}); err != nil {
+			t.Fatal(err)
+		} else {
+			conn.Close()
+		}
+		if fi, err = os.Stat(path); err != nil || fi.Mode().Perm() != 0620 {
+			t.Fatalf("unexpected mode of datagram socket: %v %v", fi, err)
+		}
+
+		// stale socket file is replaced
+		conn, err := ListenPacket(UnixPrefix+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		if _, err = Listen(UnixPrefix+path, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestListenNotSocket(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		path := filepath.Join(dir, "file")
+		if f, err := os.Create(path); err != nil {
+			t.Fatal(err)
+		} else {
+			f.Close()
+		}
+
+		if _, err := Listen(UnixPrefix+path, nil); err == nil {
+			t.Fatal("regular file should not be removed")
+		}
+	})
+}
+
+func TestListenTCP(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", &Permissions{Mode: "0600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if _, ok := l.(*net.TCPListener); !ok {
+		t.Fatalf("unexpected listener %#v", l)
+	}
+}
+
+func TestPermissionsCheck(t *testing.T) {
+	table := []struct {
+		permissions Permissions
+		valid       bool
+	}{
+		{Permissions{}, true},
+		{Permissions{Mode: "0660"}, true},
+		{Permissions{Mode: "rw"}, false},
+		{Permissions{Mode: "0999"}, false},
+		{Permissions{Owner: "0:0"}, true},
+		{Permissions{Owner: ":0"}, true},
+		{Permissions{Owner: "no-such-user-go-carbon"}, false},
+	}
+
+	for _, tt := range table {
+		err := tt.permissions.Check()
+		if (err == nil) != tt.valid {
+			t.Errorf("%#v: unexpected error %v", tt.permissions, err)
+		}
+	}
+}
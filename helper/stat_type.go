@@ -0,0 +1,16 @@
+package helper
+
+// StatType is kind of value sent to StatCallback
+type StatType int
+
+const (
+	StatCounter    StatType = iota // value is increment since previous Stat call
+	StatCumulative                 // value is counter total since start
+	StatGauge                      // value is current state
+)
+
+// StatTyper is implemented by modules which send stats other than increments of counters.
+// StatType returns type of metric sent by Stat of module
+type StatTyper interface {
+	StatType(metric string) StatType
+}
@@ -0,0 +1,160 @@
+package tenant
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Tenants maps auth tokens to tenant names. Metrics of tenant are stored under "<tenant>." prefix
+type Tenants struct {
+	sync.RWMutex
+	filename string
+	tokens   map[string]string
+}
+
+var registry = make(map[string]*Tenants)
+var registryMutex sync.Mutex
+
+// Load returns tenants from file. File contains lines "<token> <tenant>", empty lines and lines started with # are ignored.
+// Tenants with same filename are shared and reloaded by Reload
+func Load(filename string) (*Tenants, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if t, ok := registry[filename]; ok {
+		return t, nil
+	}
+
+	t := &Tenants{filename: filename}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+
+	registry[filename] = t
+	return t, nil
+}
+
+// Reload reads again all files loaded by Load. Old tokens are kept on error
+func Reload() error {
+	registryMutex.Lock()
+	list := make([]*Tenants, 0, len(registry))
+	for _, t := range registry {
+		list = append(list, t)
+	}
+	registryMutex.Unlock()
+
+	var firstErr error
+	for _, t := range list {
+		if err := t.load(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *Tenants) load() error {
+	body, err := ioutil.ReadFile(t.filename)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := parse(body)
+	if err != nil {
+		return fmt.Errorf("%s: %s", t.filename, err.Error())
+	}
+
+	t.Lock()
+	t.tokens = tokens
+	t.Unlock()
+
+	return nil
+}
+
+func parse(body []byte) (map[string]string, error) {
+	tokens := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"<token> <tenant>\"", lineNum)
+		}
+
+		if strings.ContainsAny(fields[1], ".;=") {
+			return nil, fmt.Errorf("line %d: bad tenant name %#v", lineNum, fields[1])
+		}
+
+		if _, exists := tokens[fields[0]]; exists {
+			return nil, fmt.Errorf("line %d: duplicate token", lineNum)
+		}
+
+		tokens[fields[0]] = fields[1]
+	}
+
+	return tokens, scanner.Err()
+}
+
+// Lookup returns tenant of token
+func (t *Tenants) Lookup(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	// compare all tokens with constant time for not leak token by response time
+	var tenant string
+	found := false
+	for k, v := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(token)) == 1 {
+			tenant = v
+			found = true
+		}
+	}
+
+	return tenant, found
+}
+
+// Prefix returns metric name under tenant root
+func Prefix(tenant string, metric string) string {
+	return tenant + "." + metric
+}
+
+// Strip removes tenant root from metric name. Second value is false if metric is not owned by tenant
+func Strip(tenant string, metric string) (string, bool) {
+	prefix := tenant + "."
+	if !strings.HasPrefix(metric, prefix) {
+		return metric, false
+	}
+	return metric[len(prefix):], true
+}
+
+// RequestToken returns token from "Authorization: Bearer <token>" or "Authorization: Token <token>" header
+func RequestToken(r *http.Request) string {
+	return AuthorizationToken(r.Header.Get("Authorization"))
+}
+
+// AuthorizationToken returns token from "Bearer <token>" or "Token <token>" value of authorization header
+func AuthorizationToken(auth string) string {
+	for _, scheme := range []string{"Bearer ", "Token "} {
+		if strings.HasPrefix(auth, scheme) {
+			return strings.TrimSpace(auth[len(scheme):])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package tenant
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/helper/qa"
+)
+
+func TestTenants(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		assert := assert.New(t)
+
+		filename := filepath.Join(dir, "tenants")
+		assert.NoError(ioutil.WriteFile(filename, []byte("# comment\n\nsecret1 team-a\n  secret2\tteam-b  \n"), 0600))
+
+		tenants, err := Load(filename)
+		if !assert.NoError(err) {
+			return
+		}
+
+		tenantName, ok := tenants.Lookup("secret2")
+		assert.True(ok)
+		assert.Equal("team-b", tenantName)
+
+		_, ok = tenants.Lookup("secret")
+		assert.False(ok)
+		_, ok = tenants.Lookup("")
+		assert.False(ok)
+
+		// same file is shared
+		same, err := Load(filename)
+		assert.NoError(err)
+		assert.True(same == tenants)
+
+		assert.NoError(ioutil.WriteFile(filename, []byte("secret3 team-c\n"), 0600))
+		assert.NoError(Reload())
+
+		_, ok = tenants.Lookup("secret1")
+		assert.False(ok)
+		tenantName, ok = tenants.Lookup("secret3")
+		assert.True(ok)
+		assert.Equal("team-c", tenantName)
+
+		// old tokens are kept on error
+		assert.NoError(ioutil.WriteFile(filename, []byte("secret4\n"), 0600))
+		assert.Error(Reload())
+		_, ok = tenants.Lookup("secret3")
+		assert.True(ok)
+	})
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, body := range []string{
+		"token",
+		"token tenant extra",
+		"token team.a",
+		"token team;a",
+		"token a\ntoken b",
+	} {
+		_, err := parse([]byte(body))
+		assert.Error(err, body)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("team.cpu.user", Prefix("team", "cpu.user"))
+	assert.Equal("team.cpu;host=a", Prefix("team", "cpu;host=a"))
+
+	name, ok := Strip("team", "team.cpu.user")
+	assert.True(ok)
+	assert.Equal("cpu.user", name)
+
+	_, ok = Strip("team", "teammate.cpu")
+	assert.False(ok)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Equal("", RequestToken(req))
+	req.Header.Set("Authorization", "Bearer secret")
+	assert.Equal("secret", RequestToken(req))
+	req.Header.Set("Authorization", "Token secret")
+	assert.Equal("secret", RequestToken(req))
+	req.Header.Set("Authorization", "Basic c2VjcmV0")
+	assert.Equal("", RequestToken(req))
+}
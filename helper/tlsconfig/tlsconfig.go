@@ -0,0 +1,177 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// Options is TLS settings of listener. TLS is enabled if cert and key are set
+type Options struct {
+	Cert       string `toml:"tls-cert"`
+	Key        string `toml:"tls-key"`
+	ClientCA   string `toml:"tls-client-ca"`
+	MinVersion string `toml:"tls-min-version"`
+}
+
+var minVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// Enabled returns true if listener should serve TLS
+func (o *Options) Enabled() bool {
+	return o.Cert != "" || o.Key != ""
+}
+
+// holder keeps current certificate and client CA pool. Reloaded by Reload
+type holder struct {
+	sync.RWMutex
+	options   Options
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func (h *holder) load() error {
+	cert, err := tls.LoadX509KeyPair(h.options.Cert, h.options.Key)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if h.options.ClientCA != "" {
+		pem, err := ioutil.ReadFile(h.options.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %#v", h.options.ClientCA)
+		}
+	}
+
+	h.Lock()
+	h.cert = &cert
+	h.clientCAs = pool
+	h.Unlock()
+
+	return nil
+}
+
+func (h *holder) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	h.RLock()
+	defer h.RUnlock()
+	return h.cert, nil
+}
+
+// verifyClient checks client certificate with current client CA pool
+func (h *holder) verifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("client certificate required")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	h.RLock()
+	roots := h.clientCAs
+	h.RUnlock()
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+var holders = make(map[Options]*holder)
+var holdersMutex sync.Mutex
+
+// New returns server TLS config for options or nil if TLS is disabled.
+// Certificate and client CA are read on each Reload call, so config can be used by long living listener
+func New(options *Options) (*tls.Config, error) {
+	if !options.Enabled() {
+		return nil, nil
+	}
+
+	if options.Cert == "" || options.Key == "" {
+		return nil, errors.New("both tls-cert and tls-key should be set")
+	}
+
+	minVersion, ok := minVersions[options.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls-min-version %#v, supported: \"1.0\", \"1.1\", \"1.2\"", options.MinVersion)
+	}
+
+	holdersMutex.Lock()
+	h, ok := holders[*options]
+	holdersMutex.Unlock()
+
+	if !ok {
+		h = &holder{options: *options}
+		if err := h.load(); err != nil {
+			return nil, err
+		}
+
+		holdersMutex.Lock()
+		holders[*options] = h
+		holdersMutex.Unlock()
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: h.getCertificate,
+	}
+
+	if options.ClientCA != "" {
+		// client certificate is verified by VerifyPeerCertificate because ClientCAs of config can't be replaced on reload
+		config.ClientAuth = tls.RequireAnyClientCert
+		config.VerifyPeerCertificate = h.verifyClient
+	}
+
+	return config, nil
+}
+
+// Reload reads again certificates of all configs created by New. Old certificates are kept on error
+func Reload() error {
+	holdersMutex.Lock()
+	list := make([]*holder, 0, len(holders))
+	for _, h := range holders {
+		list = append(list, h)
+	}
+	holdersMutex.Unlock()
+
+	var firstErr error
+	for _, h := range list {
+		if err := h.load(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("tls reload of %#v failed: %s", h.options.Cert, err.Error())
+		}
+	}
+	return firstErr
+}
+
+// Listener wraps listener with TLS if config is not nil
+func Listener(l net.Listener, config *tls.Config) net.Listener {
+	if config == nil {
+		return l
+	}
+	return tls.NewListener(l, config)
+}
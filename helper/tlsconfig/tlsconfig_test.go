@@ -0,0 +1,193 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/helper/qa"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	kpem []byte
+}
+
+func newTestCert(t *testing.T, cn string, usage x509.ExtKeyUsage, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		tpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		kpem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}),
+	}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	if err := ioutil.WriteFile(certFile, c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := ioutil.WriteFile(keyFile, c.kpem, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		assert := assert.New(t)
+
+		config, err := New(&Options{})
+		assert.NoError(err)
+		assert.Nil(config)
+
+		_, err = New(&Options{Cert: "server.crt"})
+		assert.Error(err)
+
+		ca := newTestCert(t, "ca", 0, nil)
+		server := newTestCert(t, "server1", x509.ExtKeyUsageServerAuth, ca)
+		client := newTestCert(t, "client", x509.ExtKeyUsageClientAuth, ca)
+		otherCA := newTestCert(t, "other-ca", 0, nil)
+		otherClient := newTestCert(t, "other-client", x509.ExtKeyUsageClientAuth, otherCA)
+
+		options := &Options{
+			Cert:     filepath.Join(dir, "server.crt"),
+			Key:      filepath.Join(dir, "server.key"),
+			ClientCA: filepath.Join(dir, "ca.crt"),
+		}
+		ca.write(t, options.ClientCA, "")
+		server.write(t, options.Cert, options.Key)
+
+		_, err = New(&Options{Cert: options.Cert, Key: options.Key, MinVersion: "0.9"})
+		assert.Error(err)
+
+		config, err = New(options)
+		if !assert.NoError(err) {
+			return
+		}
+
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(err) {
+			return
+		}
+		l := Listener(tcpListener, config)
+		defer l.Close()
+
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}()
+			}
+		}()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+
+		// dial returns CN of server certificate
+		dial := func(c *testCert) (string, error) {
+			clientConfig := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+			if c != nil {
+				clientConfig.Certificates = []tls.Certificate{{
+					Certificate: [][]byte{c.cert.Raw},
+					PrivateKey:  c.key,
+				}}
+			}
+			conn, err := tls.Dial("tcp", tcpListener.Addr().String(), clientConfig)
+			if err != nil {
+				return "", err
+			}
+			defer conn.Close()
+
+			// with TLS 1.3 client certificate is verified by server after client handshake is finished
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Read(make([]byte, 1)); err != nil && err != io.EOF {
+				return "", err
+			}
+
+			return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+		}
+
+		cn, err := dial(client)
+		assert.NoError(err)
+		assert.Equal("server1", cn)
+
+		_, err = dial(nil)
+		assert.Error(err)
+
+		_, err = dial(otherClient)
+		assert.Error(err)
+
+		// certificate is replaced by Reload
+		newTestCert(t, "server2", x509.ExtKeyUsageServerAuth, ca).write(t, options.Cert, options.Key)
+		assert.NoError(Reload())
+
+		cn, err = dial(client)
+		assert.NoError(err)
+		assert.Equal("server2", cn)
+
+		// old certificate is kept if new one is broken
+		assert.NoError(ioutil.WriteFile(options.Key, []byte("broken"), 0600))
+		assert.Error(Reload())
+
+		cn, err = dial(client)
+		assert.NoError(err)
+		assert.Equal("server2", cn)
+	})
+}
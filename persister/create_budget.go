@@ -0,0 +1,170 @@
+package persister
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lomik/go-carbon/points"
+)
+
+// createBudget limits number of new whisper files per minute globally and per top-level prefix of metric name
+type createBudget struct {
+	sync.Mutex
+	max          int // 0 - unlimited
+	maxPerPrefix int // 0 - unlimited
+	window       time.Time
+	count        int
+	prefixCount  map[string]int
+	exceeded     bool                         // budget was exceeded in current window
+	parked       map[*points.Points]time.Time // points over budget with window of rejection, stored in next window
+	parkedFirst  time.Time                    // the oldest window of parked points
+	parkedPoints int                          // number of points in parked
+}
+
+func newCreateBudget(max, maxPerPrefix int) *createBudget {
+	if max <= 0 && maxPerPrefix <= 0 {
+		return nil
+	}
+	return &createBudget{
+		max:          max,
+		maxPerPrefix: maxPerPrefix,
+		prefixCount:  make(map[string]int),
+		parked:       make(map[*points.Points]time.Time),
+	}
+}
+
+// topPrefix returns first node of metric name
+func topPrefix(metric string) string {
+	if i := strings.IndexAny(metric, ".;"); i >= 0 {
+		return metric[:i]
+	}
+	return metric
+}
+
+// take reserves creation of one file. Returns false if budget of current minute is exhausted.
+// first is true for first rejection in current minute
+func (b *createBudget) take(metric string, now time.Time) (ok bool, first bool) {
+	if b == nil {
+		return true, false
+	}
+
+	prefix := topPrefix(metric)
+	window := now.Truncate(time.Minute)
+
+	b.Lock()
+	defer b.Unlock()
+
+	if !window.Equal(b.window) {
+		b.window = window
+		b.count = 0
+		b.prefixCount = make(map[string]int)
+		b.exceeded = false
+	}
+
+	if (b.max > 0 && b.count >= b.max) || (b.maxPerPrefix > 0 && b.prefixCount[prefix] >= b.maxPerPrefix) {
+		first = !b.exceeded
+		b.exceeded = true
+		return false, first
+	}
+
+	b.count++
+	if b.maxPerPrefix > 0 {
+		b.prefixCount[prefix]++
+	}
+
+	return true, false
+}
+
+// park holds points of metric over budget until next window. Parked points are not confirmed to cache,
+// so they are kept in cache (and wal) and remain visible to readers. Returns false if number of parked points
+// would exceed maxPoints
+func (b *createBudget) park(values *points.Points, now time.Time, maxPoints int) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.parkedPoints+len(values.Data) > maxPoints {
+		return false
+	}
+
+	window := now.Truncate(time.Minute)
+	if len(b.parked) == 0 {
+		b.parkedFirst = window
+	}
+	b.parked[values] = window
+	b.parkedPoints += len(values.Data)
+	return true
+}
+
+// isParked returns true if points were parked and not released yet
+func (b *createBudget) isParked(values *points.Points) bool {
+	if b == nil {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	_, ok := b.parked[values]
+	return ok
+}
+
+// release returns points parked in previous windows. Points over budget of new window are parked again by store
+func (b *createBudget) release(now time.Time) []*points.Points {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	window := now.Truncate(time.Minute)
+	if len(b.parked) == 0 || !b.parkedFirst.Before(window) {
+		return nil
+	}
+
+	var released []*points.Points
+	for values, parkedWindow := range b.parked {
+		if parkedWindow.Before(window) {
+			released = append(released, values)
+			delete(b.parked, values)
+			b.parkedPoints -= len(values.Data)
+		}
+	}
+	b.parkedFirst = window
+
+	return released
+}
+
+// releaseAll returns all parked points. Used to hand parked points over to new persister
+func (b *createBudget) releaseAll() []*points.Points {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	released := make([]*points.Points, 0, len(b.parked))
+	for values := range b.parked {
+		released = append(released, values)
+	}
+	b.parked = make(map[*points.Points]time.Time)
+	b.parkedPoints = 0
+
+	return released
+}
+
+// adopt parks points of previous persister. They are released on first call of release
+func (b *createBudget) adopt(values []*points.Points) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, v := range values {
+		b.parked[v] = time.Time{}
+		b.parkedPoints += len(v.Data)
+	}
+	if len(b.parked) > 0 {
+		b.parkedFirst = time.Time{}
+	}
+}
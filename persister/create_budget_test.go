@@ -0,0 +1,218 @@
+package persister
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/cache"
+	"github.com/lomik/go-carbon/helper/qa"
+	"github.com/lomik/go-carbon/points"
+)
+
+func TestCreateBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(newCreateBudget(0, 0))
+
+	var b *createBudget
+	ok, _ := b.take("a.b", time.Now())
+	assert.True(ok)
+
+	now := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	b = newCreateBudget(3, 2)
+	ok, _ = b.take("a.m1", now)
+	assert.True(ok)
+	ok, _ = b.take("a.m2", now)
+	assert.True(ok)
+
+	// prefix budget is exhausted
+	ok, first := b.take("a.m3", now)
+	assert.False(ok)
+	assert.True(first)
+
+	ok, _ = b.take("b;tag=value", now)
+	assert.True(ok)
+
+	// global budget is exhausted
+	ok, first = b.take("c.m1", now.Add(30*time.Second))
+	assert.False(ok)
+	assert.False(first)
+
+	// next minute
+	ok, _ = b.take("a.m3", now.Add(time.Minute))
+	assert.True(ok)
+}
+
+func TestCreateBudgetPark(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2018, 1, 1, 10, 0, 30, 0, time.UTC)
+	b := newCreateBudget(1, 0)
+
+	p1 := points.OnePoint("a.m1", 1, 1)
+	p2 := points.OnePoint("a.m2", 1, 1)
+
+	assert.True(b.park(p1, now, 1))
+	assert.True(b.isParked(p1))
+
+	// number of parked points is limited
+	assert.False(b.park(p2, now, 1))
+	assert.False(b.isParked(p2))
+
+	// points are parked until next minute
+	assert.Nil(b.release(now.Add(29 * time.Second)))
+
+	assert.True(b.park(p2, now.Add(time.Minute), 2))
+	assert.Equal([]*points.Points{p1}, b.release(now.Add(time.Minute)))
+	assert.False(b.isParked(p1))
+	assert.True(b.isParked(p2))
+
+	assert.Equal([]*points.Points{p2}, b.release(now.Add(2*time.Minute)))
+	assert.Nil(b.release(now.Add(3 * time.Minute)))
+
+	// parked points are handed over to budget of new persister and released at once
+	assert.True(b.park(p1, now.Add(3*time.Minute), 1))
+	parked := b.releaseAll()
+	assert.Equal([]*points.Points{p1}, parked)
+	assert.False(b.isParked(p1))
+	assert.True(b.park(p2, now.Add(3*time.Minute), 1))
+
+	b = newCreateBudget(1, 0)
+	b.adopt(parked)
+	assert.True(b.isParked(p1))
+	assert.Equal([]*points.Points{p1}, b.release(now))
+}
+
+func TestStoreCreateOverflow(t *testing.T) {
+	retentions, err := ParseRetentionDefs("1m:1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := WhisperSchemas{{
+		Name:       "default",
+		Pattern:    regexp.MustCompile(``),
+		Retentions: retentions,
+	}}
+
+	for _, keep := range []bool{false, true} {
+		qa.Root(t, func(root string) {
+			assert := assert.New(t)
+
+			exists := func(metric string) bool {
+				_, err := os.Stat(filepath.Join(root, metric+".wsp"))
+				return err == nil
+			}
+
+			p := NewWhisper(root, schemas, NewWhisperAggregation(), nil, nil)
+			p.SetMaxCreatesPerMinute(1, 0)
+			if keep {
+				p.SetCreateKeep(100)
+			}
+
+			m1 := points.NowPoint("m1", 1)
+			m2 := points.NowPoint("m2", 2)
+
+			store(p, m1)
+			store(p, m2)
+
+			assert.True(exists("m1"), "keep: %v", keep)
+			assert.False(exists("m2"), "keep: %v", keep)
+			assert.False(p.createBudget.isParked(m1), "keep: %v", keep)
+			assert.Equal(keep, p.createBudget.isParked(m2), "keep: %v", keep)
+
+			// parked points are not returned in same minute
+			assert.Nil(p.createBudget.release(time.Now()), "keep: %v", keep)
+
+			released := p.createBudget.release(time.Now().Add(time.Minute))
+			if !keep {
+				assert.Nil(released)
+				return
+			}
+			assert.Equal([]*points.Points{m2}, released)
+
+			// budget of current minute is still exhausted, points are parked again
+			store(p, m2)
+			assert.False(exists("m2"))
+			assert.True(p.createBudget.isParked(m2))
+			p.createBudget.release(time.Now().Add(time.Minute))
+
+			// next minute
+			p.createBudget.window = time.Time{}
+			store(p, m2)
+			assert.True(exists("m2"))
+			assert.False(p.createBudget.isParked(m2))
+		})
+	}
+}
+
+func TestCreateKeepConfirm(t *testing.T) {
+	retentions, err := ParseRetentionDefs("1m:1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := WhisperSchemas{{
+		Name:       "default",
+		Pattern:    regexp.MustCompile(``),
+		Retentions: retentions,
+	}}
+
+	qa.Root(t, func(root string) {
+		assert := assert.New(t)
+
+		c := cache.New()
+		confirmed := make(chan string, 2)
+		c.AddWithConfirm(points.NowPoint("m1", 1), func() { confirmed <- "m1" })
+		c.AddWithConfirm(points.NowPoint("m2", 2), func() { confirmed <- "m2" })
+
+		p := NewWhisper(root, schemas, NewWhisperAggregation(), c.WriteoutQueue().GetNotConfirmed, c.Confirm)
+		p.SetMaxCreatesPerMinute(1, 0)
+		p.SetCreateKeep(100)
+		p.Start()
+
+		var first string
+		select {
+		case first = <-confirmed:
+		case <-time.After(time.Second):
+			t.Fatal("points are not confirmed")
+		}
+
+		// points over budget are parked, callback is not called and points remain readable in cache
+		select {
+		case metric := <-confirmed:
+			t.Fatalf("parked points of %s confirmed", metric)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		parked := map[string]string{"m1": "m2", "m2": "m1"}[first]
+		assert.Len(c.Get(parked), 1)
+
+		// parked points are handed over to new persister (reload of config) and confirmed after store
+		p.Stop()
+		p2 := NewWhisper(root, schemas, NewWhisperAggregation(), c.WriteoutQueue().GetNotConfirmed, c.Confirm)
+		p2.Adopt(p.Parked())
+		p2.Start()
+		defer p2.Stop()
+
+		select {
+		case metric := <-confirmed:
+			assert.Equal(parked, metric)
+		case <-time.After(time.Second):
+			t.Fatal("parked points are not confirmed by new persister")
+		}
+		assert.Len(c.Get(parked), 0)
+	})
+}
+
+func TestTopPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("a", topPrefix("a.b.c"))
+	assert.Equal("cpu", topPrefix("cpu;host=a.b"))
+	assert.Equal("metric", topPrefix("metric"))
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	whisper "github.com/go-graphite/go-whisper"
 	"go.uber.org/zap"
@@ -35,6 +36,9 @@ type Whisper struct {
 	workersCount        int
 	rootPath            string
 	created             uint32 // counter
+	createBudget        *createBudget
+	createExceeded      uint32 // counter of metrics over create budget
+	createKeep          int    // max number of points parked over create budget until next minute, 0 - drop them
 	sparse              bool
 	flock               bool
 	maxUpdatesPerSecond int
@@ -111,6 +115,39 @@ func (p *Whisper) SetOnCreateTagged(fn func(string)) {
 	p.onCreateTagged = fn
 }
 
+// SetMaxCreatesPerMinute limits number of new files per minute globally and per top-level prefix of metric. 0 - unlimited
+func (p *Whisper) SetMaxCreatesPerMinute(max, maxPerPrefix int) {
+	p.createBudget = newCreateBudget(max, maxPerPrefix)
+}
+
+// SetCreateKeep enables parking of up to maxPoints points of metrics over create budget. Parked points are not
+// confirmed and are stored again in next minute. Points over maxPoints are dropped (and confirmed). 0 - disabled
+func (p *Whisper) SetCreateKeep(maxPoints int) {
+	p.createKeep = maxPoints
+}
+
+// Parked returns points parked over create budget. Should be called after Stop to hand points over to new persister
+// by Adopt, otherwise points are never confirmed
+func (p *Whisper) Parked() []*points.Points {
+	return p.createBudget.releaseAll()
+}
+
+// Adopt takes points parked by previous persister. They are stored before points from cache. Should be called
+// before Start
+func (p *Whisper) Adopt(parked []*points.Points) {
+	if len(parked) == 0 {
+		return
+	}
+	if p.createBudget == nil {
+		// no limits, budget only holds points
+		p.createBudget = &createBudget{
+			prefixCount: make(map[string]int),
+			parked:      make(map[*points.Points]time.Time),
+		}
+	}
+	p.createBudget.adopt(parked)
+}
+
 func fnv32(key string) uint32 {
 	hash := uint32(2166136261)
 	const prime32 = uint32(16777619)
@@ -159,6 +196,22 @@ func store(p *Whisper, values *points.Points) {
 			return
 		}
 
+		now := time.Now()
+		if ok, first := p.createBudget.take(values.Metric, now); !ok {
+			atomic.AddUint32(&p.createExceeded, 1)
+			// log only first metric over budget in each minute, others are logged with debug level
+			logFunc := p.createLogger.Debug
+			if first {
+				logFunc = p.createLogger.Warn
+			}
+			kept := p.createKeep > 0 && p.createBudget.park(values, now, p.createKeep)
+			logFunc("create budget exceeded",
+				zap.String("metric", values.Metric),
+				zap.Bool("kept", kept),
+			)
+			return
+		}
+
 		if err = os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm); err != nil {
 			p.logger.Error("mkdir failed",
 				zap.String("dir", filepath.Dir(path)),
@@ -232,6 +285,9 @@ func (p *Whisper) worker(recv func(chan bool) *points.Points, confirm func(*poin
 		storeFunc, doneCb = p.mockStore()
 	}
 
+	// points parked over create budget of previous minute are stored before new points from cache
+	var parked []*points.Points
+
 LOOP:
 	for {
 		// start := time.Now()
@@ -243,18 +299,28 @@ LOOP:
 			return
 		}
 
-		// start = time.Now()
-		points := recv(exit)
-		// atomic.AddUint64(&p.blockQueueGetNs, uint64(time.Since(start).Nanoseconds()))
-		if points == nil {
-			// exit closed
-			break LOOP
+		if len(parked) == 0 {
+			parked = p.createBudget.release(time.Now())
+		}
+
+		var points *points.Points
+		if len(parked) > 0 {
+			points, parked = parked[0], parked[1:]
+		} else {
+			// start = time.Now()
+			points = recv(exit)
+			// atomic.AddUint64(&p.blockQueueGetNs, uint64(time.Since(start).Nanoseconds()))
+			if points == nil {
+				// exit closed
+				break LOOP
+			}
 		}
 		storeFunc(p, points)
 		if doneCb != nil {
 			doneCb()
 		}
-		if confirm != nil {
+		// parked points are confirmed after store in next minute
+		if confirm != nil && !p.createBudget.isParked(points) {
 			confirm(points)
 		}
 	}
@@ -280,6 +346,10 @@ func (p *Whisper) Stat(send helper.StatCallback) {
 
 	send("created", float64(created))
 
+	createExceeded := atomic.LoadUint32(&p.createExceeded)
+	atomic.AddUint32(&p.createExceeded, -createExceeded)
+	send("createBudgetExceeded", float64(createExceeded))
+
 	send("maxUpdatesPerSecond", float64(p.maxUpdatesPerSecond))
 	send("workers", float64(p.workersCount))
 
@@ -290,6 +360,15 @@ func (p *Whisper) Stat(send helper.StatCallback) {
 
 }
 
+// StatType returns type of stat sent by Stat
+func (p *Whisper) StatType(metric string) helper.StatType {
+	switch metric {
+	case "pointsPerUpdate", "maxUpdatesPerSecond", "workers":
+		return helper.StatGauge
+	}
+	return helper.StatCounter
+}
+
 // Start worker
 func (p *Whisper) Start() error {
 	return p.StartFunc(func() error {
@@ -0,0 +1,286 @@
+package persister
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	whisper "github.com/go-graphite/go-whisper"
+	"go.uber.org/zap"
+
+	"github.com/lomik/zapwriter"
+)
+
+// WhisperResize rewrites existing whisper files which retentions, aggregation method or xFilesFactor
+// differ from current storage-schemas.conf and storage-aggregation.conf
+type WhisperResize struct {
+	rootPath          string
+	schemas           WhisperSchemas
+	aggregation       *WhisperAggregation
+	dryRun            bool
+	sparse            bool
+	flock             bool
+	maxFilesPerSecond int
+	logger            *zap.Logger
+
+	checked int
+	resized int
+	errors  int
+}
+
+// NewWhisperResize create instance of WhisperResize
+func NewWhisperResize(rootPath string, schemas WhisperSchemas, aggregation *WhisperAggregation) *WhisperResize {
+	return &WhisperResize{
+		rootPath:    rootPath,
+		schemas:     schemas,
+		aggregation: aggregation,
+		logger:      zapwriter.Logger("resize"),
+	}
+}
+
+// SetDryRun only logs files which should be resized
+func (r *WhisperResize) SetDryRun(dryRun bool) {
+	r.dryRun = dryRun
+}
+
+// SetSparse creates new files as sparse
+func (r *WhisperResize) SetSparse(sparse bool) {
+	r.sparse = sparse
+}
+
+// SetFLock locks old file while it is read. Persister with enabled flock doesn't update file while it is read. File
+// updated during resize is not replaced, but update between check and rename is still lost
+func (r *WhisperResize) SetFLock(flock bool) {
+	r.flock = flock
+}
+
+// SetMaxFilesPerSecond limits number of checked files per second. 0 - unlimited
+func (r *WhisperResize) SetMaxFilesPerSecond(maxFilesPerSecond int) {
+	r.maxFilesPerSecond = maxFilesPerSecond
+}
+
+// resizeMetricName restores metric name from path of whisper file relative to root
+func resizeMetricName(rel string) string {
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), ".wsp")
+	if strings.HasPrefix(rel, "_tagged/") {
+		return strings.Replace(rel[strings.LastIndex(rel, "/")+1:], "_DOT_", ".", -1)
+	}
+	return strings.Replace(rel, "/", ".", -1)
+}
+
+func retentionsString(retentions []whisper.Retention) string {
+	s := make([]string, len(retentions))
+	for i := 0; i < len(retentions); i++ {
+		s[i] = fmt.Sprintf("%d:%d", retentions[i].SecondsPerPoint(), retentions[i].NumberOfPoints())
+	}
+	return strings.Join(s, ",")
+}
+
+func retentionsEqual(a []whisper.Retention, b whisper.Retentions) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if a[i].SecondsPerPoint() != b[i].SecondsPerPoint() || a[i].NumberOfPoints() != b[i].NumberOfPoints() {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregationMethodEqual compares method name returned by whisper file with configured method
+func aggregationMethodEqual(name string, method whisper.AggregationMethod) bool {
+	switch strings.ToLower(name) {
+	case "average", "avg":
+		return method == whisper.Average
+	case "sum":
+		return method == whisper.Sum
+	case "last":
+		return method == whisper.Last
+	case "max":
+		return method == whisper.Max
+	case "min":
+		return method == whisper.Min
+	}
+	return false
+}
+
+// Run walks root path and resizes all outdated files
+func (r *WhisperResize) Run() error {
+	ticker := NewThrottleTicker(r.maxFilesPerSecond)
+	defer ticker.Stop()
+
+	startTime := time.Now()
+
+	err := filepath.Walk(r.rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			r.errors++
+			r.logger.Error("walk failed", zap.String("path", path), zap.Error(err))
+			return nil
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, ".wsp") {
+			return nil
+		}
+
+		<-ticker.C
+
+		rel, err := filepath.Rel(r.rootPath, path)
+		if err != nil {
+			return err
+		}
+
+		r.checked++
+		if err = r.check(path, resizeMetricName(rel)); err != nil {
+			r.errors++
+			r.logger.Error("resize failed", zap.String("path", path), zap.Error(err))
+		}
+		return nil
+	})
+
+	r.logger.Info("resize finished",
+		zap.Int("checked", r.checked),
+		zap.Int("resized", r.resized),
+		zap.Int("errors", r.errors),
+		zap.Bool("dryRun", r.dryRun),
+		zap.Duration("runtime", time.Since(startTime)),
+	)
+
+	return err
+}
+
+func (r *WhisperResize) check(path string, metric string) error {
+	schema, ok := r.schemas.Match(metric)
+	if !ok {
+		return fmt.Errorf("no storage schema defined for metric %#v", metric)
+	}
+
+	aggr := r.aggregation.match(metric)
+
+	// file updated after this point by running persister is not replaced, see checkUnchanged
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	w, err := whisper.OpenWithOptions(path, &whisper.Options{
+		FLock: r.flock,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	retentions := w.Retentions()
+
+	if retentionsEqual(retentions, schema.Retentions) &&
+		aggregationMethodEqual(w.AggregationMethod(), aggr.aggregationMethod) &&
+		w.XFilesFactor() == float32(aggr.xFilesFactor) {
+		return nil
+	}
+
+	newRetentions := make([]whisper.Retention, len(schema.Retentions))
+	for i := 0; i < len(schema.Retentions); i++ {
+		newRetentions[i] = *schema.Retentions[i]
+	}
+
+	r.logger.Info("resize",
+		zap.String("path", path),
+		zap.String("metric", metric),
+		zap.String("retention", retentionsString(retentions)),
+		zap.String("newRetention", retentionsString(newRetentions)),
+		zap.String("method", w.AggregationMethod()),
+		zap.String("newMethod", aggr.aggregationMethodStr),
+		zap.Float64("xFilesFactor", float64(w.XFilesFactor())),
+		zap.Float64("newXFilesFactor", aggr.xFilesFactor),
+		zap.String("schema", schema.Name),
+		zap.String("aggregation", aggr.name),
+	)
+
+	if r.dryRun {
+		r.resized++
+		return nil
+	}
+
+	// read archives starting from the lowest precision. Points of more precise archives
+	// are written later and overwrite aggregated values in new file
+	now := int(time.Now().Unix())
+	archives := make([][]*whisper.TimeSeriesPoint, 0, len(retentions))
+	for i := len(retentions) - 1; i >= 0; i-- {
+		series, err := w.Fetch(now-retentions[i].MaxRetention(), now)
+		if err != nil {
+			return err
+		}
+		if series == nil {
+			continue
+		}
+
+		data := series.Points()
+		points := make([]*whisper.TimeSeriesPoint, 0, len(data))
+		for j := 0; j < len(data); j++ {
+			if math.IsNaN(data[j].Value) {
+				continue
+			}
+			points = append(points, &whisper.TimeSeriesPoint{Time: data[j].Time, Value: data[j].Value})
+		}
+		archives = append(archives, points)
+	}
+
+	// release flock, so persister waiting for it writes to old file before its check
+	w.Close()
+
+	tmpPath := path + ".resize"
+	os.Remove(tmpPath)
+
+	nw, err := whisper.CreateWithOptions(tmpPath, schema.Retentions, aggr.aggregationMethod, float32(aggr.xFilesFactor), &whisper.Options{
+		Sparse: r.sparse,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, points := range archives {
+		if len(points) == 0 {
+			continue
+		}
+		if err = nw.UpdateMany(points); err != nil {
+			nw.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if err = nw.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// points written to old file during resize would be lost by rename
+	if err = checkUnchanged(path, info); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	r.resized++
+	return nil
+}
+
+// checkUnchanged returns error if file is modified since info was taken. Modified file is in use by running go-carbon
+func checkUnchanged(path string, info os.FileInfo) error {
+	current, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !current.ModTime().Equal(info.ModTime()) || current.Size() != info.Size() {
+		return fmt.Errorf("file is modified during resize, go-carbon should be stopped before resize")
+	}
+	return nil
+}
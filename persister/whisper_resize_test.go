@@ -0,0 +1,159 @@
+package persister
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	whisper "github.com/go-graphite/go-whisper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/helper/qa"
+)
+
+func TestResizeMetricName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("carbon.agents.host.cache.size", resizeMetricName("carbon/agents/host/cache/size.wsp"))
+	assert.Equal("cpu.usage;host=server01.example", resizeMetricName("_tagged/8e9/2ab/cpu_DOT_usage;host=server01_DOT_example.wsp"))
+}
+
+func TestResizeRetentionsEqual(t *testing.T) {
+	assert := assert.New(t)
+
+	current := []whisper.Retention{
+		whisper.NewRetention(60, 1440),
+		whisper.NewRetention(3600, 720),
+	}
+
+	// pairs of secondsPerPoint, numberOfPoints
+	schema := func(args ...int) whisper.Retentions {
+		r := make(whisper.Retentions, 0)
+		for i := 0; i+1 < len(args); i += 2 {
+			retention := whisper.NewRetention(args[i], args[i+1])
+			r = append(r, &retention)
+		}
+		return r
+	}
+
+	assert.True(retentionsEqual(current, schema(60, 1440, 3600, 720)))
+	assert.False(retentionsEqual(current, schema(60, 2880, 3600, 720)))
+	assert.False(retentionsEqual(current, schema(60, 1440)))
+	assert.False(retentionsEqual(current, schema(10, 8640, 3600, 720)))
+}
+
+func TestResizeAggregationMethodEqual(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(aggregationMethodEqual("Average", whisper.Average))
+	assert.True(aggregationMethodEqual("sum", whisper.Sum))
+	assert.False(aggregationMethodEqual("Max", whisper.Min))
+	assert.False(aggregationMethodEqual("unknown", whisper.Average))
+}
+
+func TestResizeRun(t *testing.T) {
+	qa.Root(t, func(root string) {
+		assert := assert.New(t)
+
+		path := filepath.Join(root, "test", "metric.wsp")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// 1m:3h,1h:1d with one hour of data, value is minute index
+		oldRetentions := whisper.Retentions{}
+		for _, r := range []whisper.Retention{whisper.NewRetention(60, 180), whisper.NewRetention(3600, 24)} {
+			retention := r
+			oldRetentions = append(oldRetentions, &retention)
+		}
+
+		w, err := whisper.Create(path, oldRetentions, whisper.Average, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := int(time.Now().Unix())
+		base := now - now%3600 - 3600
+		points := make([]*whisper.TimeSeriesPoint, 0, 60)
+		for i := 0; i < 60; i++ {
+			points = append(points, &whisper.TimeSeriesPoint{Time: base + 60*i, Value: float64(i)})
+		}
+		assert.NoError(w.UpdateMany(points))
+		assert.NoError(w.Close())
+
+		newRetentions, err := ParseRetentionDefs("5m:3h,1h:1d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemas := WhisperSchemas{{
+			Name:       "test",
+			Pattern:    regexp.MustCompile(`^test\.`),
+			Retentions: newRetentions,
+		}}
+
+		aggregation := NewWhisperAggregation()
+		aggregation.Default.aggregationMethodStr = "max"
+		aggregation.Default.aggregationMethod = whisper.Max
+		aggregation.Default.xFilesFactor = 0
+
+		r := NewWhisperResize(root, schemas, aggregation)
+		assert.NoError(r.Run())
+		assert.Equal(1, r.checked)
+		assert.Equal(1, r.resized)
+		assert.Equal(0, r.errors)
+
+		w, err = whisper.Open(path)
+		if !assert.NoError(err) {
+			return
+		}
+		defer w.Close()
+
+		assert.Equal([]whisper.Retention{whisper.NewRetention(300, 36), whisper.NewRetention(3600, 24)}, w.Retentions())
+		assert.True(aggregationMethodEqual(w.AggregationMethod(), whisper.Max))
+		assert.Equal(float32(0), w.XFilesFactor())
+
+		// each 5m point keeps last minute value of interval
+		series, err := w.Fetch(base-1, base+3599)
+		if assert.NoError(err) && assert.NotNil(series) {
+			assert.Equal(300, series.Step())
+			expected := make([]float64, 12)
+			for i := range expected {
+				expected[i] = float64(5*i + 4)
+			}
+			assert.Equal(expected, series.Values())
+		}
+
+		// file is up to date now
+		r = NewWhisperResize(root, schemas, aggregation)
+		assert.NoError(r.Run())
+		assert.Equal(1, r.checked)
+		assert.Equal(0, r.resized)
+	})
+}
+
+func TestResizeCheckUnchanged(t *testing.T) {
+	qa.Root(t, func(root string) {
+		assert := assert.New(t)
+
+		path := filepath.Join(root, "metric.wsp")
+		if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(checkUnchanged(path, info))
+
+		// file is updated by persister, size of whisper file is not changed
+		mtime := info.ModTime().Add(time.Second)
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(checkUnchanged(path, info))
+	})
+}
@@ -1,16 +1,27 @@
 package http
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 
 	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
 	"github.com/lomik/go-carbon/receiver/parse"
@@ -30,6 +41,8 @@ func init() {
 type Options struct {
 	Listen         string `toml:"listen"`
 	MaxMessageSize uint32 `toml:"max-message-size"`
+	TenantsFile    string `toml:"tenants-file"`
+	tlsconfig.Options
 }
 
 func NewOptions() *Options {
@@ -39,6 +52,19 @@ func NewOptions() *Options {
 	}
 }
 
+// influxPrecision maps "precision" param of InfluxDB write API to timestamp units
+var influxPrecision = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
 // HTTP receive metrics from HTTP requests
 type HTTP struct {
 	out             func(*points.Points)
@@ -46,10 +72,12 @@ type HTTP struct {
 	maxMessageSize  uint32
 	metricsReceived uint32
 	errors          uint32
+	rateLimited     uint32 // points dropped by rate limit
 	listener        *net.TCPListener
 	server          *http.Server
 	logger          *zap.Logger
 	closed          chan struct{}
+	tenants         *tenant.Tenants // if set requests without valid token are rejected
 }
 
 // Addr returns binded socket address. For bind port 0 in tests
@@ -67,6 +95,18 @@ func newHTTP(name string, options *Options, store func(*points.Points)) (*HTTP,
 		return nil, err
 	}
 
+	var tlsConfig *tls.Config
+	if tlsConfig, err = tlsconfig.New(&options.Options); err != nil {
+		return nil, err
+	}
+
+	var tenants *tenant.Tenants
+	if options.TenantsFile != "" {
+		if tenants, err = tenant.Load(options.TenantsFile); err != nil {
+			return nil, err
+		}
+	}
+
 	tcpListener, err := net.ListenTCP("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -79,6 +119,7 @@ func newHTTP(name string, options *Options, store func(*points.Points)) (*HTTP,
 		logger:         zapwriter.Logger(name),
 		listener:       tcpListener,
 		closed:         make(chan struct{}),
+		tenants:        tenants,
 	}
 
 	s := &http.Server{
@@ -92,7 +133,7 @@ func newHTTP(name string, options *Options, store func(*points.Points)) (*HTTP,
 	rcv.server = s
 
 	go func() {
-		s.Serve(tcpListener)
+		s.Serve(tlsconfig.Listener(tcpListener, tlsConfig))
 		close(rcv.closed)
 	}()
 
@@ -113,6 +154,57 @@ func (rcv *HTTP) Stat(send helper.StatCallback) {
 	errors := atomic.LoadUint32(&rcv.errors)
 	atomic.AddUint32(&rcv.errors, -errors)
 	send("errors", float64(errors))
+
+	rateLimited := atomic.LoadUint32(&rcv.rateLimited)
+	atomic.AddUint32(&rcv.rateLimited, -rateLimited)
+	send("rateLimited", float64(rateLimited))
+}
+
+var errUnknownEncoding = errors.New("unknown content encoding")
+
+// decode decompresses request body by Content-Encoding. Size of decompressed body is limited by max-message-size
+func (rcv *HTTP) decode(encoding string, body []byte) ([]byte, error) {
+	var reader io.Reader
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "snappy":
+		// block format, same as prometheus remote write
+		n, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, err
+		}
+		if n > int(rcv.maxMessageSize) {
+			return nil, fmt.Errorf("message too long. Max allowed message size is %#v", rcv.maxMessageSize)
+		}
+		return snappy.Decode(nil, body)
+	case "zstd":
+		dec, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		reader = dec
+	default:
+		return nil, errUnknownEncoding
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(rcv.maxMessageSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > int(rcv.maxMessageSize) {
+		return nil, fmt.Errorf("message too long. Max allowed message size is %#v", rcv.maxMessageSize)
+	}
+	return data, nil
 }
 
 func (rcv *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -122,6 +214,24 @@ func (rcv *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if receiver.Overloaded() {
+		// cache is full, client should retry later
+		atomic.AddUint32(&rcv.errors, 1)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Cache is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	var tenantName string
+	if rcv.tenants != nil {
+		var ok bool
+		if tenantName, ok = rcv.tenants.Lookup(tenant.RequestToken(r)); !ok {
+			atomic.AddUint32(&rcv.errors, 1)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	if r.ContentLength > int64(rcv.maxMessageSize) {
 		atomic.AddUint32(&rcv.errors, 1)
 		http.Error(w, fmt.Sprintf("Message too long. Max allowed message size is %#v", rcv.maxMessageSize), http.StatusBadRequest)
@@ -135,15 +245,39 @@ func (rcv *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	body, err = rcv.decode(r.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		atomic.AddUint32(&rcv.errors, 1)
+		if err == errUnknownEncoding {
+			http.Error(w, fmt.Sprintf("Content-Encoding %#v is not supported", r.Header.Get("Content-Encoding")), http.StatusUnsupportedMediaType)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Decompress request failed: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
 	var data []*points.Points
 
-	switch r.Header.Get("Content-Type") {
-	case "application/python-pickle":
-		data, err = parse.Pickle(body)
-	case "application/protobuf":
-		data, err = parse.Protobuf(body)
-	default:
-		data, err = parse.Plain(body)
+	// InfluxDB compatible write endpoints
+	isInflux := r.URL.Path == "/write" || r.URL.Path == "/api/v2/write"
+
+	if isInflux {
+		precision, ok := influxPrecision[r.URL.Query().Get("precision")]
+		if !ok {
+			atomic.AddUint32(&rcv.errors, 1)
+			http.Error(w, fmt.Sprintf("Unknown precision %#v", r.URL.Query().Get("precision")), http.StatusBadRequest)
+			return
+		}
+		data, err = parse.InfluxPrecision(body, precision)
+	} else {
+		switch r.Header.Get("Content-Type") {
+		case "application/python-pickle":
+			data, err = parse.Pickle(body)
+		case "application/protobuf":
+			data, err = parse.Protobuf(body)
+		default:
+			data, err = parse.Plain(body)
+		}
 	}
 
 	if err != nil {
@@ -152,11 +286,15 @@ func (rcv *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cnt := 0
-	for i := 0; i < len(data); i++ {
-		cnt += len(data[i].Data)
-		rcv.out(data[i])
+	cnt, limited, ok := receiver.StoreLimited(rcv.out, data, tenantName, ratelimit.HostIP(r.RemoteAddr))
+	atomic.AddUint32(&rcv.metricsReceived, uint32(cnt))
+	atomic.AddUint32(&rcv.rateLimited, uint32(limited))
+	if !ok {
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
 	}
 
-	atomic.AddUint32(&rcv.metricsReceived, uint32(cnt))
+	if isInflux {
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
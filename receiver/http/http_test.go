@@ -3,10 +3,20 @@ package http
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/lomik/go-carbon/helper/qa"
+	"github.com/lomik/go-carbon/helper/ratelimit"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
 	"github.com/stretchr/testify/assert"
@@ -90,3 +100,267 @@ func TestHttp(t *testing.T) {
 		}
 	}
 }
+
+func TestHttpInflux(t *testing.T) {
+	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make([]*points.Points, 0)
+
+	r, err := receiver.New("http", map[string]interface{}{
+		"protocol": "http",
+		"listen":   addr.String(),
+	},
+		func(p *points.Points) {
+			received = append(received, p)
+		},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Stop()
+
+	table := []struct {
+		Path     string
+		Body     string
+		Expected []*points.Points
+		Error    bool
+	}{
+		{
+			Path: "/write",
+			Body: "cpu,host=server01 usage_user=1.5,usage_system=2i 1422698155000000000\nmem free=42 1422698155000000000",
+			Expected: []*points.Points{
+				points.OnePoint("cpu.usage_user;host=server01", 1.5, 1422698155),
+				points.OnePoint("cpu.usage_system;host=server01", 2, 1422698155),
+				points.OnePoint("mem.free", 42, 1422698155),
+			},
+		},
+		{
+			Path: "/api/v2/write?precision=s",
+			Body: "mem free=42 1422698155\n",
+			Expected: []*points.Points{
+				points.OnePoint("mem.free", 42, 1422698155),
+			},
+		},
+		{
+			Path: "/write?precision=m",
+			Body: "mem free=42 23711636\n",
+			Expected: []*points.Points{
+				points.OnePoint("mem.free", 42, 1422698160),
+			},
+		},
+		{
+			Path: "/write?precision=h",
+			Body: "mem free=42 395194\n",
+			Expected: []*points.Points{
+				points.OnePoint("mem.free", 42, 1422698400),
+			},
+		},
+		{
+			Path:  "/write?precision=d",
+			Body:  "mem free=42 16466\n",
+			Error: true,
+		},
+		{
+			Path:  "/write",
+			Body:  "hello.world 42.15 1422698155\n",
+			Error: true,
+		},
+	}
+
+	for index, tc := range table {
+		received = make([]*points.Points, 0)
+		url := fmt.Sprintf("http://%s%s", r.(*HTTP).Addr(), tc.Path)
+		resp, err := http.Post(url, "text/plain; charset=utf-8", bytes.NewReader([]byte(tc.Body)))
+		if !tc.Error {
+			assert.Nil(t, err, fmt.Sprintf("test #%d", index))
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode, fmt.Sprintf("test #%d", index))
+			assert.Equal(t, tc.Expected, received, fmt.Sprintf("test #%d", index))
+		} else {
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, fmt.Sprintf("test #%d", index))
+			assert.Equal(t, 0, len(received), fmt.Sprintf("test #%d", index))
+		}
+	}
+}
+
+func TestHttpTenant(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		assert := assert.New(t)
+
+		filename := filepath.Join(dir, "tenants")
+		assert.NoError(ioutil.WriteFile(filename, []byte("secret team\n"), 0600))
+
+		received := make([]*points.Points, 0)
+
+		r, err := receiver.New("http", map[string]interface{}{
+			"protocol":     "http",
+			"listen":       "localhost:0",
+			"tenants-file": filename,
+		},
+			func(p *points.Points) {
+				received = append(received, p)
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		url := fmt.Sprintf("http://%s/", r.(*HTTP).Addr())
+
+		post := func(token string) int {
+			req, err := http.NewRequest("POST", url, bytes.NewBufferString("hello.world 42.15 1422698155\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		assert.Equal(http.StatusUnauthorized, post(""))
+		assert.Equal(http.StatusUnauthorized, post("wrong"))
+		assert.Equal(0, len(received))
+
+		assert.Equal(http.StatusOK, post("secret"))
+		if assert.Equal(1, len(received)) {
+			assert.True(received[0].Eq(points.OnePoint("team.hello.world", 42.15, 1422698155)))
+		}
+	})
+}
+
+func TestHttpContentEncoding(t *testing.T) {
+	received := make([]*points.Points, 0)
+
+	r, err := receiver.New("http", map[string]interface{}{
+		"protocol":         "http",
+		"listen":           "localhost:0",
+		"max-message-size": 1024,
+	},
+		func(p *points.Points) {
+			received = append(received, p)
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	body := "hello.world 42.15 1422698155\nmetric.name -72.11 1422698155\n"
+
+	compress := func(w io.WriteCloser, buf *bytes.Buffer) []byte {
+		w.Write([]byte(body))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	var gzipBuf, zstdBuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zstdBuf)
+
+	table := []struct {
+		Encoding string
+		Body     []byte
+		Status   int
+	}{
+		{Encoding: "gzip", Body: compress(gzip.NewWriter(&gzipBuf), &gzipBuf), Status: 200},
+		{Encoding: "snappy", Body: snappy.Encode(nil, []byte(body)), Status: 200},
+		{Encoding: "zstd", Body: compress(zw, &zstdBuf), Status: 200},
+		{Encoding: "identity", Body: []byte(body), Status: 200},
+		{Encoding: "gzip", Body: []byte(body), Status: http.StatusBadRequest},
+		{Encoding: "br", Body: []byte(body), Status: http.StatusUnsupportedMediaType},
+		// decompressed body is larger than max-message-size
+		{Encoding: "snappy", Body: snappy.Encode(nil, bytes.Repeat([]byte(body), 100)), Status: http.StatusBadRequest},
+	}
+
+	url := fmt.Sprintf("http://%s/", r.(*HTTP).Addr())
+
+	for index, tc := range table {
+		received = make([]*points.Points, 0)
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(tc.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Encoding", tc.Encoding)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err, fmt.Sprintf("test #%d", index))
+		resp.Body.Close()
+		assert.Equal(t, tc.Status, resp.StatusCode, fmt.Sprintf("test #%d", index))
+
+		if tc.Status == 200 {
+			assert.Equal(t, []*points.Points{
+				points.OnePoint("hello.world", 42.15, 1422698155),
+				points.OnePoint("metric.name", -72.11, 1422698155),
+			}, received, fmt.Sprintf("test #%d", index))
+		} else {
+			assert.Equal(t, 0, len(received), fmt.Sprintf("test #%d", index))
+		}
+	}
+}
+
+func TestHttpRateLimit(t *testing.T) {
+	assert := assert.New(t)
+	defer ratelimit.Configure(ratelimit.NewOptions())
+
+	table := []struct {
+		Action      string
+		Status      int
+		Received    []string
+		RateLimited uint32
+	}{
+		// over-limit points are dropped, request is accepted
+		{Action: ratelimit.ActionDrop, Status: http.StatusOK, Received: []string{"m1", "m2"}, RateLimited: 2},
+		// request is rejected on first over-limit point, points before it are stored
+		{Action: ratelimit.ActionReject, Status: http.StatusTooManyRequests, Received: []string{"m1", "m2"}, RateLimited: 1},
+	}
+
+	for _, tc := range table {
+		options := ratelimit.NewOptions()
+		options.Enabled = true
+		options.PerIP = 1
+		options.PerIPBurst = 2
+		options.Action = tc.Action
+		// buckets of unchanged limits are kept by Configure
+		ratelimit.Configure(ratelimit.NewOptions())
+		if err := ratelimit.Configure(options); err != nil {
+			t.Fatal(err)
+		}
+
+		var received []string
+
+		r, err := receiver.New("http", map[string]interface{}{
+			"protocol": "http",
+			"listen":   "localhost:0",
+		},
+			func(p *points.Points) {
+				received = append(received, p.Metric)
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		url := fmt.Sprintf("http://%s/", r.(*HTTP).Addr())
+
+		resp, err := http.Post(url, "", bytes.NewBufferString("m1 1 1422698155\nm2 2 1422698155\nm3 3 1422698155\nm4 4 1422698155\n"))
+		if assert.NoError(err, tc.Action) {
+			resp.Body.Close()
+			assert.Equal(tc.Status, resp.StatusCode, tc.Action)
+		}
+		assert.Equal(tc.Received, received, tc.Action)
+		assert.Equal(tc.RateLimited, atomic.LoadUint32(&r.(*HTTP).rateLimited), tc.Action)
+
+		r.Stop()
+	}
+}
@@ -0,0 +1,275 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/receiver"
+	"github.com/lomik/zapwriter"
+)
+
+// offsetTracker commits offset of message only after all points of this message and of all previous messages of
+// partition are confirmed
+type offsetTracker struct {
+	sync.Mutex
+	pending map[int64]int // offset -> number of not confirmed points
+	queue   []int64       // offsets in order of consume
+	mark    func(offset int64)
+}
+
+func newOffsetTracker(mark func(offset int64)) *offsetTracker {
+	return &offsetTracker{
+		pending: make(map[int64]int),
+		mark:    mark,
+	}
+}
+
+// add registers message with count points. Should be called before store of points
+func (t *offsetTracker) add(offset int64, count int) {
+	t.Lock()
+	t.queue = append(t.queue, offset)
+	t.pending[offset] = count
+	t.commit()
+	t.Unlock()
+}
+
+// done confirms one point of message
+func (t *offsetTracker) done(offset int64) {
+	t.Lock()
+	t.pending[offset]--
+	t.commit()
+	t.Unlock()
+}
+
+// commit marks last offset of confirmed head of queue
+func (t *offsetTracker) commit() {
+	n := 0
+	for n < len(t.queue) && t.pending[t.queue[n]] <= 0 {
+		delete(t.pending, t.queue[n])
+		n++
+	}
+	if n > 0 {
+		t.mark(t.queue[n-1])
+		t.queue = t.queue[n:]
+	}
+}
+
+// head returns offset of oldest not confirmed message
+func (t *offsetTracker) head() (int64, bool) {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.queue) == 0 {
+		return 0, false
+	}
+	return t.queue[0], true
+}
+
+type groupHandler struct {
+	rcv     *Kafka
+	parse   func([]byte) ([]*points.Points, error)
+	dropped int32 // set if session is finished because points are dropped
+}
+
+func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.rcv.logger.Info("consumer group session started",
+		zap.Int32("generation", session.GenerationID()),
+		zap.String("claims", fmt.Sprintf("%v", session.Claims())),
+	)
+	return nil
+}
+
+func (h *groupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	h.rcv.logger.Info("consumer group session finished",
+		zap.Int32("generation", session.GenerationID()),
+	)
+	return nil
+}
+
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	topic, partition := claim.Topic(), claim.Partition()
+
+	// committed offset is offset of next message to consume
+	tracker := newOffsetTracker(func(offset int64) {
+		session.MarkOffset(topic, partition, offset+1, "")
+	})
+
+	for msg := range claim.Messages() {
+		payload, err := h.parse(msg.Value)
+		if err != nil {
+			atomic.AddUint64(&h.rcv.errors, 1)
+			h.rcv.logger.Error("failed to parse message",
+				zap.String("protocol", h.rcv.protocol.ToString()),
+				zap.String("topic", topic),
+				zap.Int32("partition", partition),
+				zap.Int64("offset", msg.Offset),
+				zap.Error(err),
+			)
+			// broken message is skipped
+			payload = nil
+		}
+
+		offset := msg.Offset
+		confirm := func() { tracker.done(offset) }
+
+		metricsReceived := 0
+		tracker.add(offset, len(payload))
+		dropped := false
+		for _, p := range payload {
+			metricsReceived += len(p.Data)
+			if !h.rcv.out(p, confirm) {
+				dropped = true
+				break
+			}
+		}
+
+		atomic.AddUint64(&h.rcv.metricsReceived, uint64(metricsReceived))
+
+		if dropped {
+			// offset of message is never confirmed and commit is stalled. Session is finished, so consumer
+			// subscribes again and message is delivered from last committed offset
+			atomic.AddUint64(&h.rcv.errors, 1)
+			atomic.StoreInt32(&h.dropped, 1)
+			h.rcv.logger.Error("points are dropped because cache is full, consuming is restarted from last committed offset",
+				zap.String("topic", topic),
+				zap.Int32("partition", partition),
+				zap.Int64("offset", offset),
+			)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func newKafkaGroup(name string, options *Options, store func(*points.Points)) (*Kafka, error) {
+	logger := zapwriter.Logger(name)
+
+	ver, err := sarama.ParseKafkaVersion(options.KafkaVersion)
+	if err != nil {
+		logger.Error("invalid kafka version",
+			zap.String("kafkaVersion", options.KafkaVersion),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if !ver.IsAtLeast(sarama.V0_10_2_0) {
+		return nil, fmt.Errorf("consumer group mode requires kafka-version 0.10.2.0 or newer")
+	}
+
+	config := sarama.NewConfig()
+	config.Version = ver
+
+	switch options.InitialOffset {
+	case OffsetOldest:
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case OffsetNewest:
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, fmt.Errorf("initial-offset should be \"oldest\" or \"newest\" in consumer group mode")
+	}
+
+	topics := options.Topics
+	if len(topics) == 0 {
+		topics = []string{options.Topic}
+	}
+
+	rcv := &Kafka{
+		name:              name,
+		protocol:          options.Protocol,
+		logger:            logger,
+		closed:            make(chan struct{}),
+		reconnectInterval: options.ReconnectInterval.Duration,
+		version:           ver,
+		out:               receiver.ConfirmedStore(store),
+	}
+
+	rcv.waitGroup.Add(1)
+	go func() {
+		rcv.groupWorker(options.Brokers, options.ConsumerGroup, topics, config)
+		rcv.waitGroup.Done()
+	}()
+
+	return rcv, nil
+}
+
+// groupWorker consumes topics as member of consumer group until receiver is stopped
+func (rcv *Kafka) groupWorker(brokers []string, group string, topics []string, config *sarama.Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-rcv.closed
+		cancel()
+	}()
+
+	handler := &groupHandler{
+		rcv:   rcv,
+		parse: rcv.parser(),
+	}
+
+	var consumerGroup sarama.ConsumerGroup
+	var err error
+
+LOOP:
+	for {
+		if consumerGroup == nil {
+			rcv.logger.Info("connecting to kafka",
+				zap.String("group", group),
+				zap.Strings("topics", topics),
+			)
+			consumerGroup, err = sarama.NewConsumerGroup(brokers, group, config)
+		}
+
+		if err == nil {
+			// returns on rebalance or stop
+			err = consumerGroup.Consume(ctx, topics, handler)
+		}
+
+		if ctx.Err() != nil {
+			break LOOP
+		}
+
+		if err == nil && atomic.SwapInt32(&handler.dropped, 0) == 1 {
+			// give persister time to free space in cache
+			select {
+			case <-rcv.closed:
+				break LOOP
+			case <-time.After(rcv.reconnectInterval):
+			}
+		}
+
+		if err != nil {
+			atomic.AddUint64(&rcv.errors, 1)
+			rcv.logger.Error("failed to consume from kafka",
+				zap.Duration("reconnect_interval", rcv.reconnectInterval),
+				zap.Error(err),
+			)
+
+			if consumerGroup != nil {
+				consumerGroup.Close()
+				consumerGroup = nil
+			}
+
+			select {
+			case <-rcv.closed:
+				break LOOP
+			case <-time.After(rcv.reconnectInterval):
+			}
+			err = nil
+		}
+	}
+
+	if consumerGroup != nil {
+		if err := consumerGroup.Close(); err != nil {
+			rcv.logger.Error("failed to close consumer group",
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/receiver/parse"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	var marked []int64
+
+	tracker := newOffsetTracker(func(offset int64) {
+		marked = append(marked, offset)
+	})
+
+	tracker.add(10, 2)
+	tracker.add(11, 0) // broken or empty message
+	tracker.add(12, 1)
+
+	// 12 can't be committed before 10
+	tracker.done(12)
+	if len(marked) != 0 {
+		t.Fatalf("unexpected marks: %v", marked)
+	}
+
+	tracker.done(10)
+	if len(marked) != 0 {
+		t.Fatalf("unexpected marks: %v", marked)
+	}
+
+	tracker.done(10)
+	if !reflect.DeepEqual(marked, []int64{12}) {
+		t.Fatalf("unexpected marks: %v", marked)
+	}
+
+	// message without points is committed immediately
+	tracker.add(13, 0)
+	if !reflect.DeepEqual(marked, []int64{12, 13}) {
+		t.Fatalf("unexpected marks: %v", marked)
+	}
+
+	if len(tracker.queue) != 0 || len(tracker.pending) != 0 {
+		t.Fatalf("tracker is not empty: %v %v", tracker.queue, tracker.pending)
+	}
+}
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *testSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.marked = append(s.marked, offset)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Topic() string                            { return "metrics" }
+func (c *testClaim) Partition() int32                         { return 0 }
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestGroupHandlerDropped(t *testing.T) {
+	var stored []string
+
+	rcv := &Kafka{
+		logger: zap.NewNop(),
+		out: func(p *points.Points, confirm func()) bool {
+			stored = append(stored, p.Metric)
+			if p.Metric == "b" {
+				// cache is full
+				return false
+			}
+			confirm()
+			return true
+		},
+	}
+	handler := &groupHandler{rcv: rcv, parse: parse.Plain}
+
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 5, Value: []byte("a 1 10\n")}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 6, Value: []byte("b 1 10\n")}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 7, Value: []byte("c 1 10\n")}
+	close(claim.messages)
+
+	session := &testSession{}
+	if err := handler.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	// session is finished on dropped message, so it is consumed again from committed offset
+	if !reflect.DeepEqual(stored, []string{"a", "b"}) {
+		t.Fatalf("unexpected stored metrics: %v", stored)
+	}
+	if !reflect.DeepEqual(session.marked, []int64{6}) {
+		t.Fatalf("unexpected marks: %v", session.marked)
+	}
+	if atomic.LoadInt32(&handler.dropped) != 1 {
+		t.Fatal("dropped is not reported")
+	}
+	if rcv.errors != 1 {
+		t.Fatalf("unexpected errors: %d", rcv.errors)
+	}
+}
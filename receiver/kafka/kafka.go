@@ -158,6 +158,8 @@ type Options struct {
 	ReconnectInterval *Duration `toml:"reconnect-interval"`
 	FetchInterval     *Duration `toml:"fetch-interval"`
 	KafkaVersion      string    `toml:"kafka-version"`
+	ConsumerGroup     string    `toml:"consumer-group"`
+	Topics            []string  `toml:"topics"`
 }
 
 // NewOptions returns Options struct filled with default values.
@@ -192,8 +194,8 @@ type optionsKafka struct {
 // Kafka receive metrics in protobuf or graphite line format from Kafka partitions
 type Kafka struct {
 	sync.RWMutex
-	out             func(*points.Points)
-	name            string // name for store metrics
+	out             func(*points.Points, func()) bool // confirm is called after points are written to disk
+	name            string                            // name for store metrics
 	metricsReceived uint64
 	errors          uint64
 
@@ -241,6 +243,10 @@ func (s *state) LoadState() error {
 }
 
 func newKafka(name string, options *Options, store func(*points.Points)) (*Kafka, error) {
+	if options.ConsumerGroup != "" {
+		return newKafkaGroup(name, options, store)
+	}
+
 	logger := zapwriter.Logger(name)
 	state := &state{
 		Offset: 0,
@@ -280,7 +286,7 @@ func newKafka(name string, options *Options, store func(*points.Points)) (*Kafka
 	}
 
 	rcv := &Kafka{
-		out:               store,
+		out:               receiver.ConfirmedStore(store),
 		name:              name,
 		protocol:          options.Protocol,
 		consumer:          nil,
@@ -431,19 +437,62 @@ func (rcv *Kafka) saveState() {
 	}
 }
 
-func (rcv *Kafka) worker() {
-	saveTimer := time.NewTicker(rcv.stateSaveInterval)
-	fetchTimer := time.NewTicker(rcv.fetchInterval)
-	rcv.logger.Info("Worker started")
-	protocolParser := parse.Plain
+// markOffset stores offset to state. Trackers of previous connections can confirm older messages, offset is never
+// moved back
+func (rcv *Kafka) markOffset(offset int64) {
+	for {
+		current := atomic.LoadInt64(&rcv.kafkaState.Offset)
+		if current >= offset {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&rcv.kafkaState.Offset, current, offset) {
+			return
+		}
+	}
+}
+
+// rewind closes consumer after points of message at offset are dropped because cache is full. Offset of oldest not
+// confirmed message is saved to state, so consumer is connected again by reconnect timer and consumes it again.
+// Should be called with lock held
+func (rcv *Kafka) rewind(tracker *offsetTracker, offset int64) {
+	atomic.AddUint64(&rcv.errors, 1)
+	rcv.logger.Error("points are dropped because cache is full, consuming is restarted from last confirmed offset",
+		zap.Int64("offset", offset),
+		zap.Duration("reconnect_interval", rcv.reconnectInterval),
+	)
+
+	// consumer starts from saved offset, so it can point to not confirmed message
+	if head, ok := tracker.head(); ok {
+		rcv.markOffset(head)
+	}
+	rcv.saveState()
+
+	if err := rcv.consumer.Close(); err != nil {
+		rcv.logger.Error("failed to close consumer",
+			zap.Error(err),
+		)
+	}
+	rcv.consumer = nil
+}
+
+// parser returns parse func of configured protocol
+func (rcv *Kafka) parser() func([]byte) ([]*points.Points, error) {
 	switch rcv.protocol {
 	case ProtocolProtobuf:
-		protocolParser = parse.Protobuf
-	case ProtocolPlain:
-		protocolParser = parse.Plain
+		return parse.Protobuf
 	case ProtocolPickle:
-		protocolParser = parse.Pickle
+		return parse.Pickle
 	}
+	return parse.Plain
+}
+
+func (rcv *Kafka) worker() {
+	saveTimer := time.NewTicker(rcv.stateSaveInterval)
+	fetchTimer := time.NewTicker(rcv.fetchInterval)
+	rcv.logger.Info("Worker started")
+	protocolParser := rcv.parser()
+	// state is saved with offset of last message which points are written to disk
+	tracker := newOffsetTracker(rcv.markOffset)
 	for {
 		select {
 		case <-rcv.closed:
@@ -475,17 +524,33 @@ func (rcv *Kafka) worker() {
 							zap.String("protocol", rcv.protocol.ToString()),
 							zap.Error(err),
 						)
-						continue
+						// broken message is skipped
+						payload = nil
 					}
 
+					offset := msg.Offset
+					confirm := func() { tracker.done(offset) }
+
 					metricsReceived := 0
+					tracker.add(offset, len(payload))
+					dropped := false
 					for _, p := range payload {
 						metricsReceived += len(p.Data)
-						rcv.out(p)
+						if !rcv.out(p, confirm) {
+							dropped = true
+							break
+						}
 					}
 
-					atomic.StoreInt64(&rcv.kafkaState.Offset, msg.Offset)
 					atomic.AddUint64(&rcv.metricsReceived, uint64(metricsReceived))
+
+					if dropped {
+						rcv.rewind(tracker, offset)
+						rcv.Unlock()
+						saveTimer.Stop()
+						fetchTimer.Stop()
+						return
+					}
 				default:
 					messageReceived = false
 				}
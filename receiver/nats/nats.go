@@ -0,0 +1,247 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/receiver"
+	"github.com/lomik/go-carbon/receiver/parse"
+	"github.com/lomik/zapwriter"
+)
+
+func init() {
+	receiver.Register(
+		"nats",
+		func() interface{} { return NewOptions() },
+		func(name string, options interface{}, store func(*points.Points)) (receiver.Receiver, error) {
+			return newNats(name, options.(*Options), store)
+		},
+	)
+}
+
+// Duration wrapper time.Duration for TOML
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText from TOML
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// MarshalText encode text with TOML format
+func (d *Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Options contains all receiver's options that can be changed by user
+type Options struct {
+	URL               string    `toml:"url"`
+	Subject           string    `toml:"subject"`
+	Queue             string    `toml:"queue"`
+	JetStream         bool      `toml:"jetstream"`
+	Durable           string    `toml:"durable"`
+	AckWait           *Duration `toml:"ack-wait"`
+	MaxAckPending     int       `toml:"max-ack-pending"`
+	ReconnectInterval *Duration `toml:"reconnect-interval"`
+}
+
+// NewOptions returns Options struct filled with default values. JetStream messages are acknowledged after points
+// are written by persister, so ack wait and number of not acknowledged messages cover full write of cache
+func NewOptions() *Options {
+	return &Options{
+		URL:               nats.DefaultURL,
+		Subject:           "graphite",
+		Queue:             "",
+		JetStream:         false,
+		Durable:           "",
+		AckWait:           &Duration{Duration: 10 * time.Minute},
+		MaxAckPending:     100000,
+		ReconnectInterval: &Duration{Duration: 2 * time.Second},
+	}
+}
+
+// Nats receive metrics from NATS subject or JetStream consumer
+type Nats struct {
+	out              func(*points.Points, func()) bool
+	name             string
+	conn             *nats.Conn
+	subscription     *nats.Subscription
+	messagesReceived uint32
+	metricsReceived  uint32
+	errors           uint32
+	logger           *zap.Logger
+	closed           chan struct{}
+}
+
+func newNats(name string, options *Options, store func(*points.Points)) (*Nats, error) {
+	logger := zapwriter.Logger(name)
+	logger.Info("starting nats receiver",
+		zap.String("url", options.URL),
+		zap.String("subject", options.Subject),
+		zap.String("queue", options.Queue),
+		zap.Bool("jetstream", options.JetStream),
+		zap.Duration("ackWait", options.AckWait.Duration),
+		zap.Int("maxAckPending", options.MaxAckPending),
+	)
+
+	if options.Subject == "" {
+		return nil, fmt.Errorf("'subject' must be specified")
+	}
+
+	if options.JetStream && (options.AckWait.Duration <= 0 || options.MaxAckPending <= 0) {
+		return nil, fmt.Errorf("'ack-wait' and 'max-ack-pending' should be positive")
+	}
+
+	rcv := &Nats{
+		out:    receiver.ConfirmedStore(store),
+		name:   name,
+		logger: logger,
+		closed: make(chan struct{}),
+	}
+
+	conn, err := nats.Connect(options.URL,
+		nats.Name("go-carbon "+name),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(options.ReconnectInterval.Duration),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Error("disconnected from nats", zap.Error(err))
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info("reconnected to nats", zap.String("url", c.ConnectedUrl()))
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			atomic.AddUint32(&rcv.errors, 1)
+			logger.Error("nats error", zap.Error(err))
+		}),
+		nats.ClosedHandler(func(_ *nats.Conn) {
+			close(rcv.closed)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	rcv.conn = conn
+
+	handler := func(m *nats.Msg) {
+		if options.JetStream {
+			// message is redelivered by server if go-carbon is stopped before points are written to disk
+			rcv.handleMessage(m, func() { m.Ack() })
+		} else {
+			rcv.handleMessage(m, func() {})
+		}
+	}
+
+	if options.JetStream {
+		var js nats.JetStreamContext
+		js, err = conn.JetStream()
+		if err == nil {
+			opts := []nats.SubOpt{
+				nats.ManualAck(),
+				nats.AckWait(options.AckWait.Duration),
+				nats.MaxAckPending(options.MaxAckPending),
+			}
+			if options.Durable != "" {
+				opts = append(opts, nats.Durable(options.Durable))
+			}
+			if options.Queue != "" {
+				rcv.subscription, err = js.QueueSubscribe(options.Subject, options.Queue, handler, opts...)
+			} else {
+				rcv.subscription, err = js.Subscribe(options.Subject, handler, opts...)
+			}
+		}
+	} else if options.Queue != "" {
+		rcv.subscription, err = conn.QueueSubscribe(options.Subject, options.Queue, handler)
+	} else {
+		rcv.subscription, err = conn.Subscribe(options.Subject, handler)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return rcv, nil
+}
+
+// header returns value of message header. Header names are compared case-insensitive
+func header(m *nats.Msg, key string) string {
+	if m.Header == nil {
+		return ""
+	}
+	if v, ok := m.Header[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+	for k, v := range m.Header {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// handleMessage stores points of message. ack is called after all points are written to disk or if message is broken
+func (rcv *Nats) handleMessage(m *nats.Msg, ack func()) {
+	atomic.AddUint32(&rcv.messagesReceived, 1)
+
+	points, err := parse.Message(m.Data, header(m, "codec"), header(m, "content-type"))
+	if err != nil {
+		atomic.AddUint32(&rcv.errors, 1)
+		rcv.logger.Error(err.Error())
+	}
+	if len(points) == 0 {
+		ack()
+		return
+	}
+
+	// message is acknowledged when last of its points is confirmed
+	pending := int32(len(points))
+	confirm := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			ack()
+		}
+	}
+
+	cnt := 0
+	for i := 0; i < len(points); i++ {
+		cnt += len(points[i].Data)
+		rcv.out(points[i], confirm)
+	}
+	atomic.AddUint32(&rcv.metricsReceived, uint32(cnt))
+}
+
+// Stop unsubscribes, waits until all received messages are processed and closes connection
+func (rcv *Nats) Stop() {
+	if err := rcv.conn.Drain(); err != nil {
+		rcv.logger.Error("failed to drain nats connection", zap.Error(err))
+		rcv.conn.Close()
+	}
+	<-rcv.closed
+}
+
+// Stat sends nats receiver's internal stats to specified callback
+func (rcv *Nats) Stat(send helper.StatCallback) {
+	messagesReceived := atomic.LoadUint32(&rcv.messagesReceived)
+	send("messagesReceived", float64(messagesReceived))
+
+	metricsReceived := atomic.LoadUint32(&rcv.metricsReceived)
+	send("metricsReceived", float64(metricsReceived))
+
+	errors := atomic.LoadUint32(&rcv.errors)
+	send("errors", float64(errors))
+
+	atomic.AddUint32(&rcv.messagesReceived, -messagesReceived)
+	atomic.AddUint32(&rcv.metricsReceived, -metricsReceived)
+	atomic.AddUint32(&rcv.errors, -errors)
+}
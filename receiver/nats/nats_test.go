@@ -0,0 +1,278 @@
+package nats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/zapwriter"
+)
+
+func runServer(t *testing.T, jetstream bool) (*server.Server, func()) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = jetstream
+
+	var storeDir string
+	if jetstream {
+		var err error
+		storeDir, err = ioutil.TempDir("", "go-carbon-nats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.StoreDir = storeDir
+	}
+
+	s := natsserver.RunServer(&opts)
+	return s, func() {
+		s.Shutdown()
+		if storeDir != "" {
+			os.RemoveAll(storeDir)
+		}
+	}
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_handleMessage(t *testing.T) {
+	received := make([]*points.Points, 0)
+	rcv := &Nats{
+		out: func(p *points.Points, confirm func()) {
+			received = append(received, p)
+			confirm()
+		},
+		logger: zapwriter.Logger("nats"),
+	}
+
+	tests := []struct {
+		Desc     string
+		Data     []byte
+		Headers  map[string]string
+		Expected []*points.Points
+		Error    bool
+	}{
+		{
+			Desc: "linemode, valid body, multiple points",
+			Data: []byte("hello.world 42.15 1422698155\nmetric.name -72.11 1422698155\n"),
+			Expected: []*points.Points{
+				points.OnePoint("hello.world", 42.15, 1422698155),
+				points.OnePoint("metric.name", -72.11, 1422698155),
+			},
+		},
+		{
+			Desc:  "linemode, invalid body",
+			Data:  []byte("hello.world 42.15 1422698155\nmetric.nam"),
+			Error: true,
+			// points before broken line are stored
+			Expected: []*points.Points{
+				points.OnePoint("hello.world", 42.15, 1422698155),
+			},
+		},
+		{
+			Desc: "linemode, gzip",
+			Data: gzipped(t, "hello.world 42.15 1422698155\n"),
+			Headers: map[string]string{
+				"codec": "gzip",
+			},
+			Expected: []*points.Points{
+				points.OnePoint("hello.world", 42.15, 1422698155),
+			},
+		},
+		{
+			Desc: "gzip, invalid body",
+			Data: []byte("hello.world 42.15 1422698155\n"),
+			Headers: map[string]string{
+				"codec": "gzip",
+			},
+			Error:    true,
+			Expected: []*points.Points{},
+		},
+		{
+			Desc: "pickle, valid body, multiple points",
+			Data: []byte("(lp0\n(S'param1'\np1\n(I1423931224\nF60.2\ntp2\n(I1423931284\nI42\ntp3\ntp4\na(S'param2'\np5\n(I1423931224\nI-15\ntp6\ntp7\na."),
+			Headers: map[string]string{
+				"Content-Type": "application/python-pickle",
+			},
+			Expected: []*points.Points{
+				points.OnePoint("param1", 60.2, 1423931224).Add(42, 1423931284),
+				points.OnePoint("param2", -15, 1423931224),
+			},
+		},
+		{
+			Desc: "protobuf, valid body, multiple points",
+			Data: []byte("\n*\n\x06param1\x12\x0f\x08\xd8\xee\xfd\xa6\x05\x11\x9a\x99\x99\x99\x99\x19N@\x12\x0f\x08\x94\xef\xfd\xa6\x05\x11\x00\x00\x00\x00\x00\x00E@\n\x19\n\x06param2\x12\x0f\x08\xd8\xee\xfd\xa6\x05\x11\x00\x00\x00\x00\x00\x00.\xc0"),
+			Headers: map[string]string{
+				"content-type": "application/protobuf",
+			},
+			Expected: []*points.Points{
+				points.OnePoint("param1", 60.2, 1423931224).Add(42, 1423931284),
+				points.OnePoint("param2", -15, 1423931224),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		received = make([]*points.Points, 0)
+		rcv.errors = 0
+		acked := 0
+
+		m := nats.NewMsg("graphite")
+		m.Data = tc.Data
+		for k, v := range tc.Headers {
+			m.Header[k] = []string{v}
+		}
+
+		rcv.handleMessage(m, func() { acked++ })
+
+		assert.Equal(t, 1, acked, fmt.Sprintf("test: %s", tc.Desc))
+		assert.Equal(t, tc.Expected, received, fmt.Sprintf("test: %s", tc.Desc))
+		if !tc.Error {
+			assert.Equal(t, uint32(0), rcv.errors, fmt.Sprintf("test: %s", tc.Desc))
+		} else {
+			assert.Equal(t, uint32(1), rcv.errors, fmt.Sprintf("test: %s", tc.Desc))
+		}
+	}
+}
+
+func receive(t *testing.T, ch chan *points.Points, count int) []*points.Points {
+	var res []*points.Points
+	for len(res) < count {
+		select {
+		case p := <-ch:
+			res = append(res, p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout, received %d of %d points", len(res), count)
+		}
+	}
+	return res
+}
+
+func TestNats(t *testing.T) {
+	s, shutdown := runServer(t, false)
+	defer shutdown()
+
+	ch := make(chan *points.Points, 16)
+
+	options := NewOptions()
+	options.URL = s.ClientURL()
+	options.Queue = "go-carbon"
+
+	rcv, err := newNats("nats", options, func(p *points.Points) { ch <- p })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rcv.Stop()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	if err := nc.Publish("graphite", []byte("hello.world 42 1422698155\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := nats.NewMsg("graphite")
+	m.Header.Set("codec", "gzip")
+	m.Data = gzipped(t, "metric.name -72 1422698155\n")
+	if err := nc.PublishMsg(m); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []*points.Points{
+		points.OnePoint("hello.world", 42, 1422698155),
+		points.OnePoint("metric.name", -72, 1422698155),
+	}, receive(t, ch, 2))
+}
+
+func TestNatsJetStream(t *testing.T) {
+	s, shutdown := runServer(t, true)
+	defer shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = js.AddStream(&nats.StreamConfig{Name: "GRAPHITE", Subjects: []string{"graphite"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// published before start of receiver
+	if _, err = js.Publish("graphite", []byte("hello.world 42 1422698155\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *points.Points, 16)
+
+	options := NewOptions()
+	options.URL = s.ClientURL()
+	options.JetStream = true
+	options.Durable = "go-carbon"
+	options.MaxAckPending = 0
+
+	_, err = newNats("nats", options, func(p *points.Points) { ch <- p })
+	assert.Error(t, err)
+
+	options.AckWait = &Duration{Duration: time.Hour}
+	options.MaxAckPending = 5000
+
+	rcv, err := newNats("nats", options, func(p *points.Points) { ch <- p })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rcv.Stop()
+
+	assert.Equal(t, []*points.Points{
+		points.OnePoint("hello.world", 42, 1422698155),
+	}, receive(t, ch, 1))
+
+	info, err := js.ConsumerInfo("GRAPHITE", "go-carbon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, time.Hour, info.Config.AckWait)
+	assert.Equal(t, 5000, info.Config.MaxAckPending)
+
+	// message is acknowledged after store
+	for i := 0; ; i++ {
+		info, err := js.ConsumerInfo("GRAPHITE", "go-carbon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.NumAckPending == 0 {
+			break
+		}
+		if i > 50 {
+			t.Fatalf("message is not acknowledged: %#v", info)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
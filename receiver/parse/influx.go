@@ -0,0 +1,240 @@
+package parse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lomik/go-carbon/points"
+)
+
+// influxScan returns position of first unescaped byte from stop starting at offset
+func influxScan(p []byte, offset int, stop string) int {
+	for i := offset; i < len(p); i++ {
+		if p[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(stop, p[i]) >= 0 {
+			return i
+		}
+	}
+	return len(p)
+}
+
+func influxUnescape(p []byte) string {
+	if bytes.IndexByte(p, '\\') < 0 {
+		return string(p)
+	}
+
+	b := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '\\' && i+1 < len(p) {
+			switch p[i+1] {
+			case ',', '=', ' ', '"', '\\':
+				i++
+			}
+		}
+		b = append(b, p[i])
+	}
+	return string(b)
+}
+
+// influxValue parses field value. ok is false for string fields, they can't be stored in whisper
+func influxValue(p []byte) (value float64, ok bool, err error) {
+	if len(p) == 0 {
+		return 0, false, errors.New("empty field value")
+	}
+
+	if p[0] == '"' {
+		return 0, false, nil
+	}
+
+	s := unsafeString(p)
+
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	switch p[len(p)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		return float64(v), err == nil, err
+	case 'u':
+		v, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, fmt.Errorf("bad field value %#v", s)
+	}
+	return value, true, nil
+}
+
+// InfluxLine parses single line of InfluxDB line protocol.
+// Every numeric or boolean field is converted to separate metric "measurement.field;tag=value".
+// Timestamp is expected in precision units, now is used for lines without timestamp
+func InfluxLine(p []byte, precision time.Duration, now int64) ([]*points.Points, error) {
+	i3 := len(p)
+	if i3 > 0 && p[i3-1] == '\n' {
+		i3--
+	}
+	if i3 > 0 && p[i3-1] == '\r' {
+		i3--
+	}
+	p = p[:i3]
+
+	badMessage := func() ([]*points.Points, error) {
+		return nil, fmt.Errorf("bad message: %#v", string(p))
+	}
+
+	// measurement
+	offset := influxScan(p, 0, ", ")
+	if offset == 0 || offset == len(p) {
+		return badMessage()
+	}
+	measurement := influxUnescape(p[:offset])
+
+	// tag set
+	var tags []string
+	for offset < len(p) && p[offset] == ',' {
+		eq := influxScan(p, offset+1, "=")
+		if eq == offset+1 || eq >= len(p) {
+			return badMessage()
+		}
+		end := influxScan(p, eq+1, ", ")
+		if end == eq+1 {
+			return badMessage()
+		}
+		tags = append(tags,
+			influxUnescape(p[offset+1:eq])+"="+strings.Replace(influxUnescape(p[eq+1:end]), ";", "_", -1),
+		)
+		offset = end
+	}
+
+	suffix := ""
+	if len(tags) > 0 {
+		sort.Strings(tags)
+		suffix = ";" + strings.Join(tags, ";")
+	}
+
+	// field set
+	type field struct {
+		name  string
+		value float64
+	}
+	var fields []field
+
+	for offset < len(p) && p[offset] == ' ' {
+		offset++
+	}
+
+	for {
+		eq := influxScan(p, offset, "=")
+		if eq == offset || eq >= len(p) {
+			return badMessage()
+		}
+
+		var end int
+		if eq+1 < len(p) && p[eq+1] == '"' {
+			end = influxScan(p, eq+2, "\"")
+			if end >= len(p) {
+				return badMessage()
+			}
+			end++
+		} else {
+			end = influxScan(p, eq+1, ", ")
+		}
+
+		value, ok, err := influxValue(p[eq+1 : end])
+		if err != nil {
+			return badMessage()
+		}
+		if ok {
+			fields = append(fields, field{name: influxUnescape(p[offset:eq]), value: value})
+		}
+
+		offset = end
+		if offset < len(p) && p[offset] == ',' {
+			offset++
+			continue
+		}
+		break
+	}
+
+	// timestamp
+	for offset < len(p) && p[offset] == ' ' {
+		offset++
+	}
+
+	timestamp := now
+	if offset < len(p) {
+		ts, err := strconv.ParseInt(unsafeString(p[offset:]), 10, 64)
+		if err != nil {
+			return badMessage()
+		}
+		if precision >= time.Second {
+			timestamp = ts * int64(precision/time.Second)
+		} else {
+			timestamp = ts / int64(time.Second/precision)
+		}
+	}
+
+	result := make([]*points.Points, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		result = append(result, points.OnePoint(measurement+"."+fields[i].name+suffix, fields[i].value, timestamp))
+	}
+
+	return result, nil
+}
+
+// InfluxPrecision parses InfluxDB line protocol with timestamps in precision units
+func InfluxPrecision(body []byte, precision time.Duration) ([]*points.Points, error) {
+	size := len(body)
+	offset := 0
+	now := time.Now().Unix()
+
+	result := make([]*points.Points, 0, 4)
+
+	for offset < size {
+		lineEnd := bytes.IndexByte(body[offset:size], '\n')
+		if lineEnd < 0 {
+			// trailing newline is optional in line protocol
+			lineEnd = size - offset - 1
+		}
+
+		line := bytes.TrimSpace(body[offset : offset+lineEnd+1])
+		offset += lineEnd + 1
+
+		// skip empty lines and comments
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		msgs, err := InfluxLine(line, precision, now)
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, msgs...)
+	}
+
+	return result, nil
+}
+
+// Influx parses InfluxDB line protocol with nanosecond timestamps
+func Influx(body []byte) ([]*points.Points, error) {
+	return InfluxPrecision(body, time.Nanosecond)
+}
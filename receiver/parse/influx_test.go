@@ -0,0 +1,84 @@
+package parse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lomik/go-carbon/points"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInflux(t *testing.T) {
+	run(t, []testcase{
+		{"simple",
+			[]byte("cpu value=42.15 1422698155000000000\n"),
+			[]*points.Points{points.OnePoint("cpu.value", 42.15, 1422698155)},
+			false,
+		},
+		{"without trailing newline",
+			[]byte("cpu value=42.15 1422698155000000000"),
+			[]*points.Points{points.OnePoint("cpu.value", 42.15, 1422698155)},
+			false,
+		},
+		{"tags and fields",
+			[]byte("cpu,host=server01,cpu=cpu0 usage_user=1.5,usage_system=2i,up=true,idle=F 1422698155000000000\n"),
+			[]*points.Points{
+				points.OnePoint("cpu.usage_user;cpu=cpu0;host=server01", 1.5, 1422698155),
+				points.OnePoint("cpu.usage_system;cpu=cpu0;host=server01", 2, 1422698155),
+				points.OnePoint("cpu.up;cpu=cpu0;host=server01", 1, 1422698155),
+				points.OnePoint("cpu.idle;cpu=cpu0;host=server01", 0, 1422698155),
+			},
+			false,
+		},
+		{"string fields are skipped",
+			[]byte("disk,path=/var\\ lib free=12u,label=\"root, \\\"main\\\" disk\",used=-3e2 1422698155000000000\n"),
+			[]*points.Points{
+				points.OnePoint("disk.free;path=/var lib", 12, 1422698155),
+				points.OnePoint("disk.used;path=/var lib", -300, 1422698155),
+			},
+			false,
+		},
+		{"escaped measurement and tags",
+			[]byte("my\\ cpu\\,1,tag=a\\,b;c value=1 1422698155000000000\n"),
+			[]*points.Points{points.OnePoint("my cpu,1.value;tag=a,b_c", 1, 1422698155)},
+			false,
+		},
+		{"comments and empty lines",
+			[]byte("# comment\n\ncpu value=1 1422698155000000000\r\n\n"),
+			[]*points.Points{points.OnePoint("cpu.value", 1, 1422698155)},
+			false,
+		},
+		{"no fields", []byte("cpu 1422698155000000000\n"), nil, true},
+		{"no value", []byte("cpu value= 1422698155000000000\n"), nil, true},
+		{"bad value", []byte("cpu value=42a 1422698155000000000\n"), nil, true},
+		{"NaN value", []byte("cpu value=NaN 1422698155000000000\n"), nil, true},
+		{"bad timestamp", []byte("cpu value=1 14226981550a\n"), nil, true},
+		{"empty tag value", []byte("cpu,host= value=1 1422698155000000000\n"), nil, true},
+		{"unterminated string", []byte("cpu value=\"abc 1422698155000000000\n"), nil, true},
+	}, Influx)
+}
+
+func TestInfluxPrecision(t *testing.T) {
+	table := []struct {
+		line      string
+		precision time.Duration
+	}{
+		{"cpu value=1 1422698155000000000", time.Nanosecond},
+		{"cpu value=1 1422698155000000", time.Microsecond},
+		{"cpu value=1 1422698155000", time.Millisecond},
+		{"cpu value=1 1422698155", time.Second},
+	}
+
+	for _, tc := range table {
+		output, err := InfluxPrecision([]byte(tc.line), tc.precision)
+		assert.NoError(t, err)
+		assert.Equal(t, []*points.Points{points.OnePoint("cpu.value", 1, 1422698155)}, output, tc.line)
+	}
+
+	now := time.Now().Unix()
+	output, err := Influx([]byte("cpu value=1\n"))
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(output)) {
+		assert.InDelta(t, now, output[0].Data[0].Timestamp, 1)
+	}
+}
@@ -0,0 +1,62 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/lomik/go-carbon/points"
+)
+
+// gzipPool provides a sync.Pool of initialized gzip.Readers's to avoid
+// the allocation overhead of repeatedly calling gzip.NewReader
+var gzipPool sync.Pool
+
+// Message parses message of pubsub or nats receiver. codec is "gzip" or "none" (default), contentType is
+// "application/python-pickle", "application/protobuf" or plain text (default)
+func Message(data []byte, codec string, contentType string) ([]*points.Points, error) {
+	if codec == "gzip" {
+		gzr, err := acquireGzipReader(bytes.NewBuffer(data))
+		if err != nil {
+			return nil, err
+		}
+		defer releaseGzipReader(gzr)
+
+		data, err = ioutil.ReadAll(gzr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch contentType {
+	case "application/python-pickle":
+		return Pickle(data)
+	case "application/protobuf":
+		return Protobuf(data)
+	default:
+		return Plain(data)
+	}
+}
+
+// acquireGzipReader retrieves a (possibly) pre-initialized gzip.Reader from
+// the package gzipPool (sync.Pool). This reduces memory allocation overhead by re-using
+// gzip.Readers
+func acquireGzipReader(r io.Reader) (*gzip.Reader, error) {
+	v := gzipPool.Get()
+	if v == nil {
+		return gzip.NewReader(r)
+	}
+	zr := v.(*gzip.Reader)
+	if err := zr.Reset(r); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// releaseGzipReader returns a gzip.Reader to the package gzipPool
+func releaseGzipReader(zr *gzip.Reader) {
+	zr.Close()
+	gzipPool.Put(zr)
+}
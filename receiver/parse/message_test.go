@@ -0,0 +1,62 @@
+package parse
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/lomik/go-carbon/points"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipped(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	plain := []byte("hello.world 42.15 1422698155\nmetric.name -72.11 1422698155\n")
+	protobuf := []byte("\n\x19\n\x06param1\x12\x0f\x08\xd8\xee\xfd\xa6\x05\x11\x9a\x99\x99\x99\x99\x19N@")
+
+	table := []struct {
+		data        []byte
+		codec       string
+		contentType string
+		expected    []*points.Points
+		err         bool
+	}{
+		{data: plain, expected: []*points.Points{
+			points.OnePoint("hello.world", 42.15, 1422698155),
+			points.OnePoint("metric.name", -72.11, 1422698155),
+		}},
+		// gzip reader from pool is reused
+		{data: gzipped(plain), codec: "gzip", expected: []*points.Points{
+			points.OnePoint("hello.world", 42.15, 1422698155),
+			points.OnePoint("metric.name", -72.11, 1422698155),
+		}},
+		{data: gzipped(protobuf), codec: "gzip", contentType: "application/protobuf", expected: []*points.Points{
+			points.OnePoint("param1", 60.2, 1423931224),
+		}},
+		{data: protobuf, codec: "none", contentType: "application/protobuf", expected: []*points.Points{
+			points.OnePoint("param1", 60.2, 1423931224),
+		}},
+		{data: plain, codec: "gzip", err: true},
+		{data: plain, contentType: "application/protobuf", err: true},
+	}
+
+	for i, tc := range table {
+		result, err := Message(tc.data, tc.codec, tc.contentType)
+		if tc.err {
+			assert.Error(err, "test #%d", i)
+			continue
+		}
+		if assert.NoError(err, "test #%d", i) {
+			assert.Equal(tc.expected, result, "test #%d", i)
+		}
+	}
+}
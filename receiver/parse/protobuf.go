@@ -17,6 +17,11 @@ func Protobuf(body []byte) ([]*points.Points, error) {
 		return []*points.Points{}, err
 	}
 
+	return ProtobufPayload(payload)
+}
+
+// ProtobufPayload converts decoded payload to points. Used by gRPC api
+func ProtobufPayload(payload *carbonpb.Payload) ([]*points.Points, error) {
 	if payload.Metrics == nil {
 		return []*points.Points{}, errors.New("empty message")
 	}
@@ -50,5 +55,5 @@ func Protobuf(body []byte) ([]*points.Points, error) {
 		result[i] = r
 	}
 
-	return result, err
+	return result, nil
 }
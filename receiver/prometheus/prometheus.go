@@ -0,0 +1,284 @@
+package prometheus
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/helper/prompb"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/receiver"
+	"github.com/lomik/zapwriter"
+)
+
+func init() {
+	receiver.Register(
+		"prometheus",
+		func() interface{} { return NewOptions() },
+		func(name string, options interface{}, store func(*points.Points)) (receiver.Receiver, error) {
+			return newPrometheus(name, options.(*Options), store)
+		},
+	)
+}
+
+type Options struct {
+	Listen         string `toml:"listen"`
+	MaxMessageSize uint32 `toml:"max-message-size"`
+	TenantsFile    string `toml:"tenants-file"`
+	tlsconfig.Options
+}
+
+func NewOptions() *Options {
+	return &Options{
+		Listen:         ":2008",
+		MaxMessageSize: 67108864, // 64 Mb
+	}
+}
+
+// Prometheus receive metrics from Prometheus remote_write requests
+type Prometheus struct {
+	out             func(*points.Points)
+	name            string // name for store metrics
+	maxMessageSize  uint32
+	metricsReceived uint32
+	errors          uint32
+	rateLimited     uint32 // points dropped by rate limit
+	listener        *net.TCPListener
+	server          *http.Server
+	logger          *zap.Logger
+	closed          chan struct{}
+	tenants         *tenant.Tenants // if set requests without valid token are rejected
+}
+
+// Addr returns binded socket address. For bind port 0 in tests
+func (rcv *Prometheus) Addr() net.Addr {
+	if rcv.listener == nil {
+		return nil
+	}
+	return rcv.listener.Addr()
+}
+
+func newPrometheus(name string, options *Options, store func(*points.Points)) (*Prometheus, error) {
+
+	addr, err := net.ResolveTCPAddr("tcp", options.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if tlsConfig, err = tlsconfig.New(&options.Options); err != nil {
+		return nil, err
+	}
+
+	var tenants *tenant.Tenants
+	if options.TenantsFile != "" {
+		if tenants, err = tenant.Load(options.TenantsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	tcpListener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	rcv := &Prometheus{
+		out:            store,
+		name:           name,
+		maxMessageSize: options.MaxMessageSize,
+		logger:         zapwriter.Logger(name),
+		listener:       tcpListener,
+		closed:         make(chan struct{}),
+		tenants:        tenants,
+	}
+
+	s := &http.Server{
+		Addr:           options.Listen,
+		Handler:        rcv,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+
+	rcv.server = s
+
+	go func() {
+		s.Serve(tlsconfig.Listener(tcpListener, tlsConfig))
+		close(rcv.closed)
+	}()
+
+	return rcv, err
+}
+
+func (rcv *Prometheus) Stop() {
+	rcv.listener.Close()
+	rcv.server.Close()
+	<-rcv.closed
+}
+
+func (rcv *Prometheus) Stat(send helper.StatCallback) {
+	metricsReceived := atomic.LoadUint32(&rcv.metricsReceived)
+	atomic.AddUint32(&rcv.metricsReceived, -metricsReceived)
+	send("metricsReceived", float64(metricsReceived))
+
+	errors := atomic.LoadUint32(&rcv.errors)
+	atomic.AddUint32(&rcv.errors, -errors)
+	send("errors", float64(errors))
+
+	rateLimited := atomic.LoadUint32(&rcv.rateLimited)
+	atomic.AddUint32(&rcv.rateLimited, -rateLimited)
+	send("rateLimited", float64(rateLimited))
+}
+
+func (rcv *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		atomic.AddUint32(&rcv.errors, 1)
+		http.Error(w, fmt.Sprintf("Method %#v is not supported", r.Method), http.StatusBadRequest)
+		return
+	}
+
+	if receiver.Overloaded() {
+		// cache is full, client should retry later
+		atomic.AddUint32(&rcv.errors, 1)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Cache is full", http.StatusServiceUnavailable)
+		return
+	}
+
+	var tenantName string
+	if rcv.tenants != nil {
+		var ok bool
+		if tenantName, ok = rcv.tenants.Lookup(tenant.RequestToken(r)); !ok {
+			atomic.AddUint32(&rcv.errors, 1)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if r.ContentLength > int64(rcv.maxMessageSize) {
+		atomic.AddUint32(&rcv.errors, 1)
+		http.Error(w, fmt.Sprintf("Message too long. Max allowed message size is %#v", rcv.maxMessageSize), http.StatusBadRequest)
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		atomic.AddUint32(&rcv.errors, 1)
+		http.Error(w, fmt.Sprintf("Read request failed: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	n, err := snappy.DecodedLen(compressed)
+	if err == nil && n > int(rcv.maxMessageSize) {
+		atomic.AddUint32(&rcv.errors, 1)
+		http.Error(w, fmt.Sprintf("Message too long. Max allowed message size is %#v", rcv.maxMessageSize), http.StatusBadRequest)
+		return
+	}
+
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		atomic.AddUint32(&rcv.errors, 1)
+		http.Error(w, "Snappy decode failed", http.StatusBadRequest)
+		return
+	}
+
+	var req prompb.WriteRequest
+	if err = req.Unmarshal(body); err != nil {
+		atomic.AddUint32(&rcv.errors, 1)
+		http.Error(w, "Parse failed", http.StatusBadRequest)
+		return
+	}
+
+	data := Points(&req)
+
+	cnt, limited, ok := receiver.StoreLimited(rcv.out, data, tenantName, ratelimit.HostIP(r.RemoteAddr))
+	atomic.AddUint32(&rcv.metricsReceived, uint32(cnt))
+	atomic.AddUint32(&rcv.rateLimited, uint32(limited))
+	if !ok {
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MetricName converts prometheus labels to graphite tagged metric name:
+// value of "__name__" label followed by other labels sorted by name.
+// Labels with empty values are omitted
+func MetricName(labels []prompb.Label) string {
+	var name string
+	tags := make([]string, 0, len(labels))
+
+	for i := 0; i < len(labels); i++ {
+		if labels[i].Name == "__name__" {
+			name = labels[i].Value
+			continue
+		}
+		if labels[i].Value == "" {
+			continue
+		}
+		tags = append(tags, labels[i].Name+"="+strings.Replace(labels[i].Value, ";", "_", -1))
+	}
+
+	if name == "" {
+		return ""
+	}
+
+	if len(tags) == 0 {
+		return name
+	}
+
+	sort.Strings(tags)
+
+	return name + ";" + strings.Join(tags, ";")
+}
+
+// Points converts prometheus write request to points.
+// Series without metric name and stale markers (NaN values) are skipped
+func Points(req *prompb.WriteRequest) []*points.Points {
+	result := make([]*points.Points, 0, len(req.Timeseries))
+
+	for i := 0; i < len(req.Timeseries); i++ {
+		ts := &req.Timeseries[i]
+
+		name := MetricName(ts.Labels)
+		if name == "" {
+			continue
+		}
+
+		p := &points.Points{
+			Metric: name,
+			Data:   make([]points.Point, 0, len(ts.Samples)),
+		}
+
+		for j := 0; j < len(ts.Samples); j++ {
+			if math.IsNaN(ts.Samples[j].Value) {
+				continue
+			}
+			p.Data = append(p.Data, points.Point{
+				Value:     ts.Samples[j].Value,
+				Timestamp: ts.Samples[j].Timestamp / 1000,
+			})
+		}
+
+		if len(p.Data) > 0 {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,203 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/lomik/go-carbon/helper/prompb"
+	"github.com/lomik/go-carbon/helper/qa"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/go-carbon/receiver"
+	"github.com/stretchr/testify/assert"
+)
+
+func series(samples []prompb.Sample, labels ...string) prompb.TimeSeries {
+	ts := prompb.TimeSeries{Samples: samples}
+	for i := 0; i+1 < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, prompb.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return ts
+}
+
+func TestMetricName(t *testing.T) {
+	table := []struct {
+		Labels   []string
+		Expected string
+	}{
+		{[]string{"__name__", "up"}, "up"},
+		{[]string{"job", "node", "__name__", "up", "instance", "localhost:9100"}, "up;instance=localhost:9100;job=node"},
+		{[]string{"__name__", "up", "empty", ""}, "up"},
+		{[]string{"__name__", "up", "path", "a;b"}, "up;path=a_b"},
+		{[]string{"job", "node"}, ""},
+	}
+
+	for _, tc := range table {
+		assert.Equal(t, tc.Expected, MetricName(series(nil, tc.Labels...).Labels), fmt.Sprintf("%#v", tc.Labels))
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make([]*points.Points, 0)
+
+	r, err := receiver.New("prometheus", map[string]interface{}{
+		"protocol": "prometheus",
+		"listen":   addr.String(),
+	},
+		func(p *points.Points) {
+			received = append(received, p)
+		},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Stop()
+
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			series(
+				[]prompb.Sample{{Value: 42.15, Timestamp: 1422698155000}, {Value: 43, Timestamp: 1422698215123}},
+				"__name__", "node_load1", "job", "node", "instance", "host1",
+			),
+			series(
+				[]prompb.Sample{{Value: math.NaN(), Timestamp: 1422698155000}, {Value: -72.11, Timestamp: 1422698215000}},
+				"__name__", "up",
+			),
+			series(
+				[]prompb.Sample{{Value: math.NaN(), Timestamp: 1422698155000}},
+				"__name__", "stale",
+			),
+		},
+	}
+
+	body, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		Body     []byte
+		Expected []*points.Points
+		Error    bool
+	}{
+		{
+			Body: snappy.Encode(nil, body),
+			Expected: []*points.Points{
+				points.OnePoint("node_load1;instance=host1;job=node", 42.15, 1422698155).Add(43, 1422698215),
+				points.OnePoint("up", -72.11, 1422698215),
+			},
+		},
+		{
+			Body:  body,
+			Error: true,
+		},
+		{
+			Body:  snappy.Encode(nil, []byte("hello.world 42.15 1422698155\n")),
+			Error: true,
+		},
+	}
+
+	url := fmt.Sprintf("http://%s/write", r.(*Prometheus).Addr())
+
+	for index, tc := range table {
+		received = make([]*points.Points, 0)
+		resp, err := http.Post(url, "application/x-protobuf", bytes.NewReader(tc.Body))
+		if !tc.Error {
+			assert.Nil(t, err, fmt.Sprintf("test #%d", index))
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode, fmt.Sprintf("test #%d", index))
+			assert.Equal(t, tc.Expected, received, fmt.Sprintf("test #%d", index))
+		} else {
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, fmt.Sprintf("test #%d", index))
+			assert.Equal(t, 0, len(received), fmt.Sprintf("test #%d", index))
+		}
+	}
+}
+
+func TestPrometheusTenantRateLimit(t *testing.T) {
+	defer ratelimit.Configure(ratelimit.NewOptions())
+
+	qa.Root(t, func(dir string) {
+		assert := assert.New(t)
+
+		filename := filepath.Join(dir, "tenants")
+		assert.NoError(ioutil.WriteFile(filename, []byte("secret team\n"), 0600))
+
+		options := ratelimit.NewOptions()
+		options.Enabled = true
+		options.PerIP = 1
+		options.PerIPBurst = 2
+		options.Action = ratelimit.ActionReject
+		if err := ratelimit.Configure(options); err != nil {
+			t.Fatal(err)
+		}
+
+		received := make([]*points.Points, 0)
+
+		r, err := receiver.New("prometheus", map[string]interface{}{
+			"protocol":     "prometheus",
+			"listen":       "localhost:0",
+			"tenants-file": filename,
+		},
+			func(p *points.Points) {
+				received = append(received, p)
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		req := &prompb.WriteRequest{
+			Timeseries: []prompb.TimeSeries{
+				series([]prompb.Sample{{Value: 1, Timestamp: 1422698155000}, {Value: 2, Timestamp: 1422698215000}}, "__name__", "m1"),
+				series([]prompb.Sample{{Value: 3, Timestamp: 1422698155000}}, "__name__", "m2"),
+			},
+		}
+		body, err := req.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		url := fmt.Sprintf("http://%s/write", r.(*Prometheus).Addr())
+
+		post := func(token string) int {
+			req, err := http.NewRequest("POST", url, bytes.NewReader(snappy.Encode(nil, body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		assert.Equal(http.StatusUnauthorized, post(""))
+		assert.Equal(http.StatusUnauthorized, post("wrong"))
+		assert.Equal(0, len(received))
+
+		// points of series before over-limit one are stored
+		assert.Equal(http.StatusTooManyRequests, post("secret"))
+		assert.Equal([]*points.Points{
+			points.OnePoint("team.m1", 1, 1422698155).Add(2, 1422698215),
+		}, received)
+	})
+}
@@ -1,13 +1,8 @@
 package pubsub
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -21,10 +16,6 @@ import (
 	"github.com/lomik/zapwriter"
 )
 
-// gzipPool provides a sync.Pool of initialized gzip.Readers's to avoid
-// the allocation overhead of repeatedly calling gzip.NewReader
-var gzipPool sync.Pool
-
 func init() {
 	receiver.Register(
 		"pubsub",
@@ -35,29 +26,48 @@ func init() {
 	)
 }
 
+// Duration wrapper time.Duration for TOML
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText from TOML
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// MarshalText encode text with TOML format
+func (d *Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
 // Options contains all receiver's options that can be changed by user
 type Options struct {
-	Project             string `toml:"project"`
-	Subscription        string `toml:"subscription"`
-	ReceiverGoRoutines  int    `toml:"receiver_go_routines"`
-	ReceiverMaxMessages int    `toml:"receiver_max_messages"`
-	ReceiverMaxBytes    int    `toml:"receiver_max_bytes"`
+	Project              string    `toml:"project"`
+	Subscription         string    `toml:"subscription"`
+	ReceiverGoRoutines   int       `toml:"receiver_go_routines"`
+	ReceiverMaxMessages  int       `toml:"receiver_max_messages"`
+	ReceiverMaxBytes     int       `toml:"receiver_max_bytes"`
+	ReceiverMaxExtension *Duration `toml:"receiver_max_extension"`
 }
 
 // NewOptions returns Options struct filled with default values.
 func NewOptions() *Options {
 	return &Options{
-		Project:             "",
-		Subscription:        "",
-		ReceiverGoRoutines:  4,
-		ReceiverMaxMessages: 1000,
-		ReceiverMaxBytes:    100e6, // 100MB
+		Project:              "",
+		Subscription:         "",
+		ReceiverGoRoutines:   4,
+		ReceiverMaxMessages:  100000,
+		ReceiverMaxBytes:     500e6, // 500MB
+		ReceiverMaxExtension: &Duration{Duration: 10 * time.Minute},
 	}
 }
 
 // PubSub receive metrics from a google pubsub subscription
 type PubSub struct {
-	out              func(*points.Points)
+	out              func(*points.Points, func()) bool
 	name             string
 	client           *pubsub.Client
 	subscription     *pubsub.Subscription
@@ -112,12 +122,16 @@ func newPubSub(client *pubsub.Client, name string, options *Options, store func(
 	if options.ReceiverMaxMessages != 0 {
 		sub.ReceiveSettings.MaxOutstandingMessages = options.ReceiverMaxMessages
 	}
+	if options.ReceiverMaxExtension != nil && options.ReceiverMaxExtension.Duration != 0 {
+		// messages are acknowledged only after persist, ack deadline is extended while they wait in cache
+		sub.ReceiveSettings.MaxExtension = options.ReceiverMaxExtension.Duration
+	}
 
 	// cancel() will be called to signal the subscription Receive() goroutines to finish and shutdown
 	cctx, cancel := context.WithCancel(ctx)
 
 	rcv := &PubSub{
-		out:          store,
+		out:          receiver.ConfirmedStore(store),
 		name:         name,
 		client:       client,
 		cancel:       cancel,
@@ -131,8 +145,7 @@ func newPubSub(client *pubsub.Client, name string, options *Options, store func(
 	go func() {
 		for {
 			err := rcv.subscription.Receive(cctx, func(ctx context.Context, m *pubsub.Message) {
-				rcv.handleMessage(m)
-				m.Ack()
+				rcv.handleMessage(m, m.Ack)
 			})
 			if err == context.Canceled {
 				close(rcv.closed)
@@ -149,54 +162,32 @@ func newPubSub(client *pubsub.Client, name string, options *Options, store func(
 	return rcv, nil
 }
 
-func (rcv *PubSub) handleMessage(m *pubsub.Message) {
+// handleMessage stores points of message. ack is called after all points are written to disk or if message is broken
+func (rcv *PubSub) handleMessage(m *pubsub.Message, ack func()) {
 	atomic.AddUint32(&rcv.messagesReceived, 1)
 
-	var data []byte
-	var err error
-	var points []*points.Points
-
-	switch m.Attributes["codec"] {
-	case "gzip":
-		gzr, err := acquireGzipReader(bytes.NewBuffer(m.Data))
-		if err != nil {
-			rcv.logger.Error(err.Error())
-			atomic.AddUint32(&rcv.errors, 1)
-			return
-		}
-		defer releaseGzipReader(gzr)
-
-		data, err = ioutil.ReadAll(gzr)
-		if err != nil {
-			rcv.logger.Error(err.Error())
-			atomic.AddUint32(&rcv.errors, 1)
-			return
-		}
-	default:
-		// "none", no compression
-		data = m.Data
-	}
-
-	switch m.Attributes["content-type"] {
-	case "application/python-pickle":
-		points, err = parse.Pickle(data)
-	case "application/protobuf":
-		points, err = parse.Protobuf(data)
-	default:
-		points, err = parse.Plain(data)
-	}
+	points, err := parse.Message(m.Data, m.Attributes["codec"], m.Attributes["content-type"])
 	if err != nil {
 		atomic.AddUint32(&rcv.errors, 1)
 		rcv.logger.Error(err.Error())
 	}
 	if len(points) == 0 {
+		ack()
 		return
 	}
 
+	// message is acknowledged when last of its points is confirmed
+	pending := int32(len(points))
+	confirm := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			ack()
+		}
+	}
+
 	cnt := 0
 	for i := 0; i < len(points); i++ {
 		cnt += len(points[i].Data)
-		rcv.out(points[i])
+		rcv.out(points[i], confirm)
 	}
 	atomic.AddUint32(&rcv.metricsReceived, uint32(cnt))
 }
@@ -225,24 +216,3 @@ func (rcv *PubSub) Stat(send helper.StatCallback) {
 		atomic.AddUint32(&rcv.errors, -errors)
 	}
 }
-
-// acquireGzipReader retrieves a (possibly) pre-initialized gzip.Reader from
-// the package gzipPool (sync.Pool). This reduces memory allocation overhead by re-using
-// gzip.Readers
-func acquireGzipReader(r io.Reader) (*gzip.Reader, error) {
-	v := gzipPool.Get()
-	if v == nil {
-		return gzip.NewReader(r)
-	}
-	zr := v.(*gzip.Reader)
-	if err := zr.Reset(r); err != nil {
-		return nil, err
-	}
-	return zr, nil
-}
-
-// releaseGzipReader returns a gzip.Reader to the package gzipPool
-func releaseGzipReader(zr *gzip.Reader) {
-	zr.Close()
-	gzipPool.Put(zr)
-}
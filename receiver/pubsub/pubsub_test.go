@@ -8,7 +8,9 @@ import (
 
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/pubsub/pstest"
+	"github.com/lomik/go-carbon/cache"
 	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/zapwriter"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -121,11 +123,13 @@ func Test_handleMessage(t *testing.T) {
 		received = make([]*points.Points, 0)
 		r.metricsReceived = 0
 		r.errors = 0
+		acked := 0
 		r.handleMessage(&pubsub.Message{
 			ID:         tc.Desc,
 			Data:       []byte(tc.Data),
 			Attributes: tc.Attrs,
-		})
+		}, func() { acked++ })
+		assert.Equal(t, 1, acked, fmt.Sprintf("test: %s", tc.Desc))
 		if !tc.Error {
 			assert.Equal(t, uint32(0), r.errors, fmt.Sprintf("test: %s", tc.Desc))
 			assert.Equal(t, tc.Expected, received, fmt.Sprintf("test: %s", tc.Desc))
@@ -135,3 +139,38 @@ func Test_handleMessage(t *testing.T) {
 		}
 	}
 }
+
+func Test_handleMessageAckAfterConfirm(t *testing.T) {
+	assert := assert.New(t)
+
+	c := cache.New()
+	r := &PubSub{
+		out:    c.AddWithConfirm,
+		logger: zapwriter.Logger("pubsub"),
+	}
+
+	acked := 0
+	r.handleMessage(&pubsub.Message{
+		Data: []byte("hello.world 42.15 1422698155\nmetric.name -72.11 1422698155\n"),
+	}, func() { acked++ })
+
+	// points are in cache, message is not acknowledged before persister writes all of them
+	assert.Equal(0, acked)
+
+	p1 := c.WriteoutQueue().GetNotConfirmed(nil)
+	c.Confirm(p1)
+	assert.Equal(0, acked)
+
+	p2 := c.WriteoutQueue().GetNotConfirmed(nil)
+	c.Confirm(p2)
+	assert.Equal(1, acked)
+
+	// message with points dropped by full cache is not acknowledged
+	c.SetMaxSize(1)
+	c.Add(points.OnePoint("hello.world", 42, 1422698155))
+	c.Add(points.OnePoint("hello.world", 43, 1422698156))
+	r.handleMessage(&pubsub.Message{
+		Data: []byte("hello.world 44 1422698157\n"),
+	}, func() { acked++ })
+	assert.Equal(1, acked)
+}
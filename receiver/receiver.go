@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 
 	"github.com/BurntSushi/toml"
 	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/tenant"
 	"github.com/lomik/go-carbon/points"
 )
 
@@ -24,6 +27,64 @@ type protocolRecord struct {
 var protocolMap = map[string]*protocolRecord{}
 var protocolMapMutex sync.Mutex
 
+var overloaded atomic.Value // func() bool
+
+// SetOverloaded sets func which reports that storage can't accept points now. Most receivers are paused by blocked
+// store func, receivers which can't pause clients (http) reject requests while it returns true
+func SetOverloaded(fn func() bool) {
+	overloaded.Store(fn)
+}
+
+// Overloaded returns true if storage can't accept points now
+func Overloaded() bool {
+	fn, _ := overloaded.Load().(func() bool)
+	return fn != nil && fn()
+}
+
+var confirmedStore atomic.Value // func(*points.Points, func()) bool
+
+// SetConfirmedStore sets func which stores points and calls confirm after points are written to disk. Used by
+// receivers which acknowledge messages to upstream queue only after persist (kafka). fn returns false if points are
+// dropped (cache is full) and confirm will never be called
+func SetConfirmedStore(fn func(p *points.Points, confirm func()) bool) {
+	confirmedStore.Store(fn)
+}
+
+// ConfirmedStore returns func set by SetConfirmedStore. If it isn't set points are stored by store and confirmed
+// immediately
+func ConfirmedStore(store func(*points.Points)) func(p *points.Points, confirm func()) bool {
+	fn, _ := confirmedStore.Load().(func(*points.Points, func()) bool)
+	if fn != nil {
+		return fn
+	}
+	return func(p *points.Points, confirm func()) bool {
+		store(p)
+		confirm()
+		return true
+	}
+}
+
+// StoreLimited stores points of request from peer through rate limiter. Metrics are prefixed by tenant if it is
+// not empty. Returns number of received and rate limited points. ok is false if request should be rejected, points
+// before rejected ones are already stored then. Used by receivers of http requests
+func StoreLimited(store func(*points.Points), data []*points.Points, tenantName string, peer string) (received int, limited int, ok bool) {
+	for i := 0; i < len(data); i++ {
+		received += len(data[i].Data)
+		if tenantName != "" {
+			data[i].Metric = tenant.Prefix(tenantName, data[i].Metric)
+		}
+		if !ratelimit.Allow(peer, data[i].Metric, len(data[i].Data)) {
+			limited += len(data[i].Data)
+			if ratelimit.Reject() {
+				return received, limited, false
+			}
+			continue
+		}
+		store(data[i])
+	}
+	return received, limited, true
+}
+
 func Register(protocol string,
 	newOptions func() interface{},
 	newReceiver func(name string, options interface{}, store func(*points.Points)) (Receiver, error)) {
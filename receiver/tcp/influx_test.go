@@ -0,0 +1,32 @@
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lomik/go-carbon/points"
+)
+
+func TestInflux(t *testing.T) {
+	test := newTCPTestCase(t, "influx")
+	defer test.Finish()
+
+	test.Send("# comment\ncpu,host=server01 usage_user=1.5,usage_system=2i 1422698155000000000\n\nmem free=42 1422698155000000000\n")
+
+	time.Sleep(10 * time.Millisecond)
+
+	expected := []*points.Points{
+		points.OnePoint("cpu.usage_user;host=server01", 1.5, 1422698155),
+		points.OnePoint("cpu.usage_system;host=server01", 2, 1422698155),
+		points.OnePoint("mem.free", 42, 1422698155),
+	}
+
+	for i := 0; i < len(expected); i++ {
+		select {
+		case msg := <-test.rcvChan:
+			test.Eq(msg, expected[i])
+		default:
+			t.Fatalf("Message #%d not received", i)
+		}
+	}
+}
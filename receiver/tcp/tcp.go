@@ -2,6 +2,8 @@ package tcp
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -14,12 +16,18 @@ import (
 
 	"github.com/klauspost/compress/gzip"
 	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
 	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/socket"
+	"github.com/lomik/go-carbon/helper/tenant"
+	"github.com/lomik/go-carbon/helper/tlsconfig"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
 	"github.com/lomik/go-carbon/receiver/parse"
 	"github.com/lomik/graphite-pickle/framing"
 	"github.com/lomik/zapwriter"
+	"github.com/pierrec/lz4"
 )
 
 func init() {
@@ -27,7 +35,15 @@ func init() {
 		"tcp",
 		func() interface{} { return NewOptions() },
 		func(name string, options interface{}, store func(*points.Points)) (receiver.Receiver, error) {
-			return newTCP(name, options.(*Options), store)
+			return newTCP("plain", name, options.(*Options), store)
+		},
+	)
+
+	receiver.Register(
+		"influx",
+		func() interface{} { return NewInfluxOptions() },
+		func(name string, options interface{}, store func(*points.Points)) (receiver.Receiver, error) {
+			return newTCP("influx", name, options.(*Options), store)
 		},
 	)
 
@@ -53,6 +69,9 @@ type Options struct {
 	Enabled     bool   `toml:"enabled"`
 	BufferSize  int    `toml:"buffer-size"`
 	Compression string `toml:"compression"`
+	TenantsFile string `toml:"tenants-file"`
+	tlsconfig.Options
+	socket.Permissions
 }
 
 func NewOptions() *Options {
@@ -63,11 +82,22 @@ func NewOptions() *Options {
 	}
 }
 
+func NewInfluxOptions() *Options {
+	return &Options{
+		Listen:     ":8094",
+		Enabled:    true,
+		BufferSize: 0,
+	}
+}
+
 type FramingOptions struct {
 	Listen         string `toml:"listen"`
 	MaxMessageSize uint32 `toml:"max-message-size"`
 	Enabled        bool   `toml:"enabled"`
 	BufferSize     int    `toml:"buffer-size"`
+	Compression    string `toml:"compression"`
+	tlsconfig.Options
+	socket.Permissions
 }
 
 func NewFramingOptions() *FramingOptions {
@@ -87,13 +117,17 @@ type TCP struct {
 	maxMessageSize  uint32
 	metricsReceived uint32
 	errors          uint32
-	active          int32 // counter
-	listener        *net.TCPListener
+	rateLimited     uint32 // points dropped by rate limit
+	active          int32  // counter
+	listener        net.Listener
+	tlsConfig       *tls.Config
 	isFraming       bool
 	frameParser     func(body []byte) ([]*points.Points, error)
+	lineParser      func(line []byte) ([]*points.Points, error)
 	buffer          chan *points.Points
 	logger          *zap.Logger
 	decompressor    decompressor
+	tenants         *tenant.Tenants // if set first line of connection should be "auth <token>"
 }
 
 // Addr returns binded socket address. For bind port 0 in tests
@@ -104,15 +138,12 @@ func (rcv *TCP) Addr() net.Addr {
 	return rcv.listener.Addr()
 }
 
-func newTCP(name string, options *Options, store func(*points.Points)) (*TCP, error) {
+func newTCP(parser string, name string, options *Options, store func(*points.Points)) (*TCP, error) {
 	if !options.Enabled {
 		return nil, nil
 	}
 
-	addr, err := net.ResolveTCPAddr("tcp", options.Listen)
-	if err != nil {
-		return nil, err
-	}
+	var err error
 
 	r := &TCP{
 		out:    store,
@@ -120,13 +151,36 @@ func newTCP(name string, options *Options, store func(*points.Points)) (*TCP, er
 		logger: zapwriter.Logger(name),
 	}
 
+	switch parser {
+	case "plain":
+		// parse.PlainLine is called directly in HandleConnection
+	case "influx":
+		r.lineParser = influxLine
+	default:
+		return nil, fmt.Errorf("unknown line parser %#v", parser)
+	}
+
 	if options.BufferSize > 0 {
 		r.buffer = make(chan *points.Points, options.BufferSize)
 	}
 
-	r.decompressor = newDecompressor(options.Compression)
+	if r.decompressor, err = newDecompressor(options.Compression); err != nil {
+		return nil, err
+	}
 
-	err = r.Listen(addr)
+	if r.tlsConfig, err = tlsconfig.New(&options.Options); err != nil {
+		return nil, err
+	}
+
+	if options.TenantsFile != "" {
+		if r.tenants, err = tenant.Load(options.TenantsFile); err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.listen(func() (net.Listener, error) {
+		return socket.Listen(options.Listen, &options.Permissions)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -139,10 +193,7 @@ func newFraming(parser string, name string, options *FramingOptions, store func(
 		return nil, nil
 	}
 
-	addr, err := net.ResolveTCPAddr("tcp", options.Listen)
-	if err != nil {
-		return nil, err
-	}
+	var err error
 
 	r := &TCP{
 		out:            store,
@@ -165,7 +216,17 @@ func newFraming(parser string, name string, options *FramingOptions, store func(
 		r.buffer = make(chan *points.Points, options.BufferSize)
 	}
 
-	err = r.Listen(addr)
+	if r.decompressor, err = newDecompressor(options.Compression); err != nil {
+		return nil, err
+	}
+
+	if r.tlsConfig, err = tlsconfig.New(&options.Options); err != nil {
+		return nil, err
+	}
+
+	err = r.listen(func() (net.Listener, error) {
+		return socket.Listen(options.Listen, &options.Permissions)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -184,6 +245,9 @@ func (rcv *TCP) HandleConnection(conn net.Conn) {
 		rcv.logger.Error("failed init decompressor", zap.Error(err))
 		return
 	}
+	if closer, ok := bconn.(io.Closer); ok {
+		defer closer.Close()
+	}
 	reader := bufio.NewReader(bconn)
 
 	finished := make(chan bool)
@@ -203,6 +267,18 @@ func (rcv *TCP) HandleConnection(conn net.Conn) {
 	readTimeout := 2 * time.Minute
 	conn.SetReadDeadline(lastDeadline.Add(readTimeout))
 
+	var tenantName string
+	if rcv.tenants != nil {
+		var ok bool
+		if tenantName, ok = rcv.auth(reader); !ok {
+			atomic.AddUint32(&rcv.errors, 1)
+			rcv.logger.Warn("auth failed", zap.String("peer", conn.RemoteAddr().String()))
+			return
+		}
+	}
+
+	peer := ratelimit.HostIP(conn.RemoteAddr().String())
+
 	for {
 		now := time.Now()
 		if now.Sub(lastDeadline) > (readTimeout / 4) {
@@ -223,7 +299,23 @@ func (rcv *TCP) HandleConnection(conn net.Conn) {
 			}
 			break
 		}
-		if len(line) > 0 { // skip empty lines
+		if len(line) > 0 && rcv.lineParser != nil {
+			msgs, err := rcv.lineParser(line)
+			if err != nil {
+				atomic.AddUint32(&rcv.errors, 1)
+				rcv.logger.Info("parse failed",
+					zap.Error(err),
+					zap.String("peer", conn.RemoteAddr().String()),
+				)
+			} else {
+				for _, msg := range msgs {
+					atomic.AddUint32(&rcv.metricsReceived, uint32(len(msg.Data)))
+					if !rcv.store(msg, tenantName, peer) {
+						return
+					}
+				}
+			}
+		} else if len(line) > 0 { // skip empty lines
 			name, value, timestamp, err := parse.PlainLine(line)
 			if err != nil {
 				atomic.AddUint32(&rcv.errors, 1)
@@ -233,14 +325,59 @@ func (rcv *TCP) HandleConnection(conn net.Conn) {
 				)
 			} else {
 				atomic.AddUint32(&rcv.metricsReceived, 1)
-				rcv.out(points.OnePoint(string(name), value, timestamp))
+				if !rcv.store(points.OnePoint(string(name), value, timestamp), tenantName, peer) {
+					return
+				}
 			}
 		}
 	}
 }
 
+// store adds tenant prefix to metric and sends points to out if peer is not over rate limit.
+// Returns false if connection should be closed
+func (rcv *TCP) store(p *points.Points, tenantName string, peer string) bool {
+	if tenantName != "" {
+		p.Metric = tenant.Prefix(tenantName, p.Metric)
+	}
+
+	if ratelimit.Allow(peer, p.Metric, len(p.Data)) {
+		rcv.out(p)
+		return true
+	}
+
+	atomic.AddUint32(&rcv.rateLimited, uint32(len(p.Data)))
+	if ratelimit.Reject() {
+		rcv.logger.Warn("rate limit exceeded, connection closed", zap.String("peer", peer))
+		return false
+	}
+	return true
+}
+
+// auth reads first line "auth <token>" of connection and returns tenant of token
+func (rcv *TCP) auth(reader *bufio.Reader) (string, bool) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return "", false
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) != 2 || fields[0] != "auth" {
+		return "", false
+	}
+
+	return rcv.tenants.Lookup(fields[1])
+}
+
+// influxLine parses InfluxDB line protocol with nanosecond timestamps. Empty lines and comments are skipped
+func influxLine(line []byte) ([]*points.Points, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] == '#' {
+		return nil, nil
+	}
+	return parse.InfluxLine(line, time.Nanosecond, time.Now().Unix())
+}
+
 func (rcv *TCP) handleFraming(conn net.Conn) {
-	framedConn, _ := framing.NewConn(conn, byte(4), binary.BigEndian)
 	defer func() {
 		if r := recover(); r != nil {
 			rcv.logger.Error("panic recovered", zap.String("traceback", fmt.Sprint(r)))
@@ -252,6 +389,17 @@ func (rcv *TCP) handleFraming(conn net.Conn) {
 
 	defer conn.Close()
 
+	bconn, err := rcv.decompressor(conn)
+	if err != nil {
+		rcv.logger.Error("failed init decompressor", zap.Error(err))
+		return
+	}
+	if closer, ok := bconn.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	framedConn, _ := framing.NewConn(&decompressedConn{Conn: conn, reader: bconn}, byte(4), binary.BigEndian)
+
 	finished := make(chan bool)
 	defer close(finished)
 
@@ -267,6 +415,8 @@ func (rcv *TCP) handleFraming(conn net.Conn) {
 
 	framedConn.MaxFrameSize = uint(rcv.maxMessageSize)
 
+	peer := ratelimit.HostIP(conn.RemoteAddr().String())
+
 	for {
 		conn.SetReadDeadline(time.Now().Add(2 * time.Minute))
 		data, err := framedConn.ReadFrame()
@@ -295,7 +445,9 @@ func (rcv *TCP) handleFraming(conn net.Conn) {
 
 		for _, msg := range msgs {
 			atomic.AddUint32(&rcv.metricsReceived, uint32(len(msg.Data)))
-			rcv.out(msg)
+			if !rcv.store(msg, "", peer) {
+				return
+			}
 		}
 	}
 }
@@ -312,17 +464,37 @@ func (rcv *TCP) Stat(send helper.StatCallback) {
 	atomic.AddUint32(&rcv.errors, -errors)
 	send("errors", float64(errors))
 
+	rateLimited := atomic.LoadUint32(&rcv.rateLimited)
+	atomic.AddUint32(&rcv.rateLimited, -rateLimited)
+	send("rateLimited", float64(rateLimited))
+
 	if rcv.buffer != nil {
 		send("bufferLen", float64(len(rcv.buffer)))
 		send("bufferCap", float64(cap(rcv.buffer)))
 	}
 }
 
+// StatType returns type of stat sent by Stat
+func (rcv *TCP) StatType(metric string) helper.StatType {
+	switch metric {
+	case "active", "bufferLen", "bufferCap":
+		return helper.StatGauge
+	}
+	return helper.StatCounter
+}
+
 // Listen bind port. Receive messages and send to out channel
 func (rcv *TCP) Listen(addr *net.TCPAddr) error {
+	return rcv.listen(func() (net.Listener, error) {
+		return net.ListenTCP("tcp", addr)
+	})
+}
+
+// listen opens tcp or unix socket listener by open and serves connections
+func (rcv *TCP) listen(open func() (net.Listener, error)) error {
 	return rcv.StartFunc(func() error {
 
-		tcpListener, err := net.ListenTCP("tcp", addr)
+		tcpListener, err := open()
 		if err != nil {
 			return err
 		}
@@ -356,12 +528,14 @@ func (rcv *TCP) Listen(addr *net.TCPAddr) error {
 			}
 		}
 
+		listener := tlsconfig.Listener(tcpListener, rcv.tlsConfig)
+
 		rcv.Go(func(exit chan bool) {
 			defer tcpListener.Close()
 
 			for {
 
-				conn, err := tcpListener.Accept()
+				conn, err := listener.Accept()
 				if err != nil {
 					if strings.Contains(err.Error(), "use of closed network connection") {
 						break
@@ -385,21 +559,48 @@ func (rcv *TCP) Listen(addr *net.TCPAddr) error {
 	})
 }
 
+// decompressor wraps connection with streaming decompression. Returned reader should be closed if it is io.Closer
 type decompressor func(net.Conn) (io.Reader, error)
 
-func newDecompressor(typ string) decompressor {
+var compressions = []string{"", "none", "snappy", "gzip", "zstd", "lz4"}
+
+func newDecompressor(typ string) (decompressor, error) {
 	switch typ {
+	case "", "none":
+		return func(c net.Conn) (io.Reader, error) {
+			return c, nil
+		}, nil
 	case "snappy":
 		return func(c net.Conn) (io.Reader, error) {
 			return snappy.NewReader(c), nil
-		}
+		}, nil
 	case "gzip":
 		return func(c net.Conn) (io.Reader, error) {
 			return gzip.NewReader(c)
-		}
-	default:
+		}, nil
+	case "zstd":
 		return func(c net.Conn) (io.Reader, error) {
-			return c, nil
-		}
+			// one decoder goroutine per connection
+			d, err := zstd.NewReader(c, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		}, nil
+	case "lz4":
+		return func(c net.Conn) (io.Reader, error) {
+			return lz4.NewReader(c), nil
+		}, nil
 	}
+	return nil, fmt.Errorf("unknown compression %#v, supported: %v", typ, compressions[1:])
+}
+
+// decompressedConn is connection with decompressed Read. Used by framing parser which accepts only net.Conn
+type decompressedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *decompressedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
 }
@@ -1,10 +1,21 @@
 package tcp
 
 import (
+	"io"
+	"io/ioutil"
 	"net"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+
+	"github.com/lomik/go-carbon/helper/qa"
+	"github.com/lomik/go-carbon/helper/ratelimit"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
 )
@@ -135,3 +146,216 @@ func TestTCPIssue176(t *testing.T) {
 		t.Fatalf("Message #1 not received")
 	}
 }
+
+func TestTCPTenant(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		filename := filepath.Join(dir, "tenants")
+		if err := ioutil.WriteFile(filename, []byte("secret team\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		rcvChan := make(chan *points.Points, 128)
+
+		r, err := receiver.New("tcp", map[string]interface{}{
+			"protocol":     "tcp",
+			"listen":       "localhost:0",
+			"tenants-file": filename,
+		},
+			func(p *points.Points) {
+				rcvChan <- p
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		send := func(text string) {
+			conn, err := net.Dial("tcp", r.(*TCP).Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Write([]byte(text))
+			conn.Close()
+		}
+
+		send("hello.world 42.15 1422698155\n")
+		send("auth wrong\nhello.world 42.15 1422698155\n")
+		send("auth secret\nhello.world 42.15 1422698155\n")
+
+		select {
+		case msg := <-rcvChan:
+			if !msg.Eq(points.OnePoint("team.hello.world", 42.15, 1422698155)) {
+				t.Fatalf("%#v != team.hello.world", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Message not received")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		if len(rcvChan) != 0 {
+			t.Fatalf("Not authenticated messages received")
+		}
+	})
+}
+
+func TestTCPUnixSocket(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		path := filepath.Join(dir, "carbon.sock")
+
+		rcvChan := make(chan *points.Points, 128)
+
+		r, err := receiver.New("tcp", map[string]interface{}{
+			"protocol":    "tcp",
+			"listen":      "unix://" + path,
+			"socket-mode": "0600",
+		},
+			func(p *points.Points) {
+				rcvChan <- p
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("hello.world 42.15 1422698155\n"))
+		conn.Close()
+
+		select {
+		case msg := <-rcvChan:
+			if !msg.Eq(points.OnePoint("hello.world", 42.15, 1422698155)) {
+				t.Fatalf("%#v != hello.world", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Message not received")
+		}
+	})
+}
+
+func TestTCPCompression(t *testing.T) {
+	compressors := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":   func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"snappy": func(w io.Writer) io.WriteCloser { return snappy.NewBufferedWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			z, _ := zstd.NewWriter(w)
+			return z
+		},
+		"lz4": func(w io.Writer) io.WriteCloser { return lz4.NewWriter(w) },
+	}
+
+	for compression, newWriter := range compressors {
+		rcvChan := make(chan *points.Points, 128)
+
+		r, err := receiver.New("tcp", map[string]interface{}{
+			"protocol":    "tcp",
+			"listen":      "localhost:0",
+			"compression": compression,
+		},
+			func(p *points.Points) {
+				rcvChan <- p
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := net.Dial("tcp", r.(*TCP).Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := newWriter(conn)
+		w.Write([]byte("hello.world 42.15 1422698155\nmetric.name -72.11 1422698155\n"))
+		w.Close()
+		conn.Close()
+
+		for _, expected := range []*points.Points{
+			points.OnePoint("hello.world", 42.15, 1422698155),
+			points.OnePoint("metric.name", -72.11, 1422698155),
+		} {
+			select {
+			case msg := <-rcvChan:
+				if !msg.Eq(expected) {
+					t.Fatalf("%s: %#v != %#v", compression, msg, expected)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s: message not received", compression)
+			}
+		}
+
+		r.Stop()
+	}
+}
+
+func TestTCPUnknownCompression(t *testing.T) {
+	_, err := receiver.New("tcp", map[string]interface{}{
+		"protocol":    "tcp",
+		"listen":      "localhost:0",
+		"compression": "bzip2",
+	},
+		func(p *points.Points) {},
+	)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestTCPRateLimit(t *testing.T) {
+	defer ratelimit.Configure(ratelimit.NewOptions())
+
+	for _, action := range []string{ratelimit.ActionDrop, ratelimit.ActionReject} {
+		options := ratelimit.NewOptions()
+		options.Enabled = true
+		options.PerIP = 1
+		options.PerIPBurst = 2
+		options.Action = action
+		// buckets of unchanged limits are kept by Configure
+		ratelimit.Configure(ratelimit.NewOptions())
+		if err := ratelimit.Configure(options); err != nil {
+			t.Fatal(err)
+		}
+
+		test := newTCPTestCase(t, "tcp")
+
+		test.Send("m1 1 1422698155\nm2 2 1422698155\nm3 3 1422698155\nm4 4 1422698155\n")
+
+		// read returns EOF after connection is closed by receiver
+		test.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err := test.conn.Read(make([]byte, 1))
+		if action == ratelimit.ActionReject && err != io.EOF {
+			t.Fatalf("%s: connection not closed: %v", action, err)
+		}
+		if action == ratelimit.ActionDrop && err == io.EOF {
+			t.Fatalf("%s: connection closed", action)
+		}
+
+		for _, expected := range []*points.Points{
+			points.OnePoint("m1", 1, 1422698155),
+			points.OnePoint("m2", 2, 1422698155),
+		} {
+			select {
+			case msg := <-test.rcvChan:
+				test.Eq(msg, expected)
+			default:
+				t.Fatalf("%s: message %s not received", action, expected.Metric)
+			}
+		}
+
+		if len(test.rcvChan) != 0 {
+			t.Fatalf("%s: over-limit messages received", action)
+		}
+
+		// rejected connection is closed on first over-limit point, following lines are not read
+		rateLimited := map[string]uint32{ratelimit.ActionDrop: 2, ratelimit.ActionReject: 1}[action]
+		if v := atomic.LoadUint32(&test.receiver.rateLimited); v != rateLimited {
+			t.Fatalf("%s: rateLimited %d != %d", action, v, rateLimited)
+		}
+
+		test.Finish()
+	}
+}
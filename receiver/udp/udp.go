@@ -11,6 +11,8 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/helper/ratelimit"
+	"github.com/lomik/go-carbon/helper/socket"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
 	"github.com/lomik/go-carbon/receiver/parse"
@@ -32,6 +34,7 @@ type Options struct {
 	Enabled       bool   `toml:"enabled"`
 	LogIncomplete bool   `toml:"log-incomplete"`
 	BufferSize    int    `toml:"buffer-size"`
+	socket.Permissions
 }
 
 // UDP receive metrics from UDP socket
@@ -42,8 +45,9 @@ type UDP struct {
 	metricsReceived    uint32
 	incompleteReceived uint32
 	errors             uint32
+	rateLimited        uint32 // points dropped by rate limit
 	logIncomplete      bool
-	conn               *net.UDPConn
+	conn               net.PacketConn
 	buffer             chan *points.Points
 	logger             *zap.Logger
 }
@@ -70,11 +74,6 @@ func newUDP(name string, options *Options, store func(*points.Points)) (*UDP, er
 		return nil, nil
 	}
 
-	addr, err := net.ResolveUDPAddr("udp", options.Listen)
-	if err != nil {
-		return nil, err
-	}
-
 	r := &UDP{
 		out:           store,
 		name:          name,
@@ -86,7 +85,9 @@ func newUDP(name string, options *Options, store func(*points.Points)) (*UDP, er
 		r.buffer = make(chan *points.Points, options.BufferSize)
 	}
 
-	err = r.Listen(addr)
+	err := r.listen(func() (net.PacketConn, error) {
+		return socket.ListenPacket(options.Listen, &options.Permissions)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +95,7 @@ func newUDP(name string, options *Options, store func(*points.Points)) (*UDP, er
 	return r, err
 }
 
-func logIncomplete(logger *zap.Logger, peer *net.UDPAddr, message []byte, lastLine []byte) {
+func logIncomplete(logger *zap.Logger, peer string, message []byte, lastLine []byte) {
 	p1 := bytes.IndexByte(message, 0xa) // find first "\n"
 
 	var m string
@@ -109,7 +110,7 @@ func logIncomplete(logger *zap.Logger, peer *net.UDPAddr, message []byte, lastLi
 	}
 
 	logger.Warn("incomplete message",
-		zap.String("peer", peer.String()),
+		zap.String("peer", peer),
 		zap.String("message", m),
 	)
 }
@@ -127,12 +128,25 @@ func (rcv *UDP) Stat(send helper.StatCallback) {
 	atomic.AddUint32(&rcv.errors, -errors)
 	send("errors", float64(errors))
 
+	rateLimited := atomic.LoadUint32(&rcv.rateLimited)
+	atomic.AddUint32(&rcv.rateLimited, -rateLimited)
+	send("rateLimited", float64(rateLimited))
+
 	if rcv.buffer != nil {
 		send("bufferLen", float64(len(rcv.buffer)))
 		send("bufferCap", float64(cap(rcv.buffer)))
 	}
 }
 
+// StatType returns type of stat sent by Stat
+func (rcv *UDP) StatType(metric string) helper.StatType {
+	switch metric {
+	case "bufferLen", "bufferCap":
+		return helper.StatGauge
+	}
+	return helper.StatCounter
+}
+
 func (rcv *UDP) receiveWorker(exit chan bool) {
 	defer rcv.conn.Close()
 
@@ -143,7 +157,7 @@ func (rcv *UDP) receiveWorker(exit chan bool) {
 	lines := newIncompleteStorage()
 
 	for {
-		rlen, peer, err := rcv.conn.ReadFromUDP(buf[:])
+		rlen, addr, err := rcv.conn.ReadFrom(buf[:])
 		if err != nil {
 			if strings.Contains(err.Error(), "use of closed network connection") {
 				break
@@ -153,7 +167,20 @@ func (rcv *UDP) receiveWorker(exit chan bool) {
 			continue
 		}
 
-		prev := lines.pop(peer.String())
+		// clients of unix datagram socket share one rate limit bucket
+		var peer, peerIP string
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			peer, peerIP = udpAddr.String(), udpAddr.IP.String()
+		} else if addr != nil {
+			peer, peerIP = addr.String(), addr.String()
+		}
+
+		// unbound clients of unix datagram socket have no address and can't be told apart,
+		// so their lines are not stitched across messages
+		var prev []byte
+		if peer != "" {
+			prev = lines.pop(peer)
+		}
 
 		if prev != nil {
 			data = bytes.NewBuffer(prev)
@@ -173,7 +200,9 @@ func (rcv *UDP) receiveWorker(exit chan bool) {
 							logIncomplete(rcv.logger, peer, buf[:rlen], line)
 						}
 
-						lines.store(peer.String(), line)
+						if peer != "" {
+							lines.store(peer, line)
+						}
 						atomic.AddUint32(&rcv.incompleteReceived, 1)
 					}
 				} else {
@@ -188,11 +217,16 @@ func (rcv *UDP) receiveWorker(exit chan bool) {
 					atomic.AddUint32(&rcv.errors, 1)
 					rcv.logger.Info("parse failed",
 						zap.Error(err),
-						zap.String("peer", peer.String()),
+						zap.String("peer", peer),
 					)
 				} else {
 					atomic.AddUint32(&rcv.metricsReceived, 1)
-					rcv.out(points.OnePoint(string(name), value, timestamp))
+					if ratelimit.Allow(peerIP, string(name), 1) {
+						rcv.out(points.OnePoint(string(name), value, timestamp))
+					} else {
+						// udp clients can't be rejected, over-limit points are dropped
+						atomic.AddUint32(&rcv.rateLimited, 1)
+					}
 				}
 			}
 		}
@@ -201,9 +235,16 @@ func (rcv *UDP) receiveWorker(exit chan bool) {
 
 // Listen bind port. Receive messages and send to out channel
 func (rcv *UDP) Listen(addr *net.UDPAddr) error {
+	return rcv.listen(func() (net.PacketConn, error) {
+		return net.ListenUDP("udp", addr)
+	})
+}
+
+// listen opens udp or unix datagram socket by open and receives messages
+func (rcv *UDP) listen(open func() (net.PacketConn, error)) error {
 	return rcv.StartFunc(func() error {
 		var err error
-		rcv.conn, err = net.ListenUDP("udp", addr)
+		rcv.conn, err = open()
 		if err != nil {
 			return err
 		}
@@ -2,11 +2,15 @@ package udp
 
 import (
 	"net"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/lomik/go-carbon/helper/qa"
+	"github.com/lomik/go-carbon/helper/ratelimit"
 	"github.com/lomik/go-carbon/points"
 	"github.com/lomik/go-carbon/receiver"
 	"github.com/lomik/zapwriter"
@@ -188,3 +192,96 @@ func TestLogIncompleteMessage(t *testing.T) {
 		assert.Contains(zapwriter.TestString(), "metric1 42 1422698155")
 	}()
 }
+
+func TestUDPRateLimit(t *testing.T) {
+	defer ratelimit.Configure(ratelimit.NewOptions())
+
+	// udp clients can't be rejected, over-limit points are dropped with both actions
+	for _, action := range []string{ratelimit.ActionDrop, ratelimit.ActionReject} {
+		options := ratelimit.NewOptions()
+		options.Enabled = true
+		options.PerIP = 1
+		options.PerIPBurst = 2
+		options.Action = action
+		// buckets of unchanged limits are kept by Configure
+		ratelimit.Configure(ratelimit.NewOptions())
+		if err := ratelimit.Configure(options); err != nil {
+			t.Fatal(err)
+		}
+
+		test := newUDPTestCase(t)
+
+		test.Send("m1 1 1422698155\nm2 2 1422698155\nm3 3 1422698155\n")
+		test.Send("m4 4 1422698155\n")
+
+		for _, expected := range []*points.Points{
+			points.OnePoint("m1", 1, 1422698155),
+			points.OnePoint("m2", 2, 1422698155),
+		} {
+			select {
+			case msg := <-test.rcvChan:
+				test.Eq(msg, expected)
+			default:
+				t.Fatalf("%s: message %s not received", action, expected.Metric)
+			}
+		}
+
+		if len(test.rcvChan) != 0 {
+			t.Fatalf("%s: over-limit messages received", action)
+		}
+
+		if v := atomic.LoadUint32(&test.receiver.rateLimited); v != 2 {
+			t.Fatalf("%s: rateLimited %d != 2", action, v)
+		}
+
+		test.Finish()
+	}
+}
+
+func TestChunkedUnixgram(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		rcvChan := make(chan *points.Points, 128)
+		path := filepath.Join(dir, "udp.sock")
+
+		r, err := receiver.New("udp", map[string]interface{}{
+			"protocol": "udp",
+			"listen":   "unix://" + path,
+		},
+			func(p *points.Points) {
+				rcvChan <- p
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		// unbound clients have no address, so lines are not stitched across messages
+		test := &udpTestCase{T: t, receiver: r.(*UDP), rcvChan: rcvChan}
+		for i := 0; i < 2; i++ {
+			if test.conn, err = net.Dial("unixgram", path); err != nil {
+				t.Fatal(err)
+			}
+			test.Send("hello.world 42.15 1422698155\nmetri")
+			test.conn.Close()
+		}
+		test.conn = nil
+
+		for i := 0; i < 2; i++ {
+			select {
+			case msg := <-rcvChan:
+				test.Eq(msg, points.OnePoint("hello.world", 42.15, 1422698155))
+			default:
+				t.Fatalf("Message #%d not received", i)
+			}
+		}
+
+		if len(rcvChan) != 0 {
+			t.Fatalf("stitched lines received")
+		}
+
+		if v := atomic.LoadUint32(&test.receiver.incompleteReceived); v != 2 {
+			t.Fatalf("incompleteReceived %d != 2", v)
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/helper"
+	"github.com/lomik/go-carbon/points"
+	"github.com/lomik/zapwriter"
+)
+
+const (
+	ActionReject   = "reject"   // drop matched metric, count and log it
+	ActionDrop     = "drop"     // silently drop matched metric
+	ActionRename   = "rename"   // replace matched part of name, $1 in replace is expanded to capture group
+	ActionSanitize = "sanitize" // replace illegal characters and collapse repeated dots
+)
+
+// illegal characters of metric name by default: whitespace, control characters and path separators
+var defaultIllegal = regexp.MustCompile(`[\s\x00-\x1f\x7f/\\]`)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+
+// Rule is config of one rule
+type Rule struct {
+	Name    string `toml:"name"`
+	Action  string `toml:"action"`
+	Pattern string `toml:"pattern"`
+	Replace string `toml:"replace"`
+}
+
+type rule struct {
+	name    string
+	action  string
+	re      *regexp.Regexp
+	replace string
+	count   uint32 // metrics matched since last Stat call
+	warned  int64  // minute (unix time / 60) of last rejection logged with warn level
+}
+
+// firstInMinute returns true for first rejection of rule in each minute
+func (rl *rule) firstInMinute(now time.Time) bool {
+	minute := now.Unix() / 60
+	return atomic.SwapInt64(&rl.warned, minute) != minute
+}
+
+// Rules validates and rewrites metric names before they are stored in cache
+type Rules struct {
+	rules  atomic.Value // []*rule
+	logger *zap.Logger
+}
+
+// New compiles rules. Rules are applied in order of config
+func New(config []Rule) (*Rules, error) {
+	r := &Rules{
+		logger: zapwriter.Logger("rules"),
+	}
+
+	if err := r.Update(config); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Update replaces rules on the fly. Old rules are kept on error
+func (r *Rules) Update(config []Rule) error {
+	rules, err := compile(config)
+	if err != nil {
+		return err
+	}
+	r.rules.Store(rules)
+	return nil
+}
+
+func compile(config []Rule) ([]*rule, error) {
+	rules := make([]*rule, 0, len(config))
+	names := make(map[string]bool)
+
+	for _, c := range config {
+		if !validName.MatchString(c.Name) {
+			return nil, fmt.Errorf("invalid rule name %#v", c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate rule name %#v", c.Name)
+		}
+		names[c.Name] = true
+
+		rl := &rule{
+			name:    c.Name,
+			action:  c.Action,
+			replace: c.Replace,
+		}
+
+		switch c.Action {
+		case ActionReject, ActionDrop, ActionRename:
+			if c.Pattern == "" {
+				return nil, fmt.Errorf("rule %#v: pattern not specified", c.Name)
+			}
+		case ActionSanitize:
+			if rl.replace == "" {
+				rl.replace = "_"
+			}
+			if c.Pattern == "" {
+				rl.re = defaultIllegal
+			}
+		default:
+			return nil, fmt.Errorf("rule %#v: unknown action %#v", c.Name, c.Action)
+		}
+
+		if rl.re == nil {
+			var err error
+			if rl.re, err = regexp.Compile(c.Pattern); err != nil {
+				return nil, fmt.Errorf("rule %#v: %s", c.Name, err.Error())
+			}
+		}
+
+		rules = append(rules, rl)
+	}
+
+	return rules, nil
+}
+
+// sanitize replaces illegal characters, collapses repeated dots and trims leading and trailing dots
+func sanitize(re *regexp.Regexp, replace string, metric string) string {
+	metric = re.ReplaceAllLiteralString(metric, replace)
+
+	for strings.Contains(metric, "..") {
+		metric = strings.Replace(metric, "..", ".", -1)
+	}
+
+	return strings.Trim(metric, ".")
+}
+
+// Apply applies rules to metric name. Returns false if metric should be dropped
+func (r *Rules) Apply(p *points.Points) bool {
+	for _, rl := range r.rules.Load().([]*rule) {
+		switch rl.action {
+		case ActionReject, ActionDrop:
+			if !rl.re.MatchString(p.Metric) {
+				continue
+			}
+			atomic.AddUint32(&rl.count, 1)
+			if rl.action == ActionReject {
+				// log only first rejected metric in each minute, others are logged with debug level
+				logFunc := r.logger.Debug
+				if rl.firstInMinute(time.Now()) {
+					logFunc = r.logger.Warn
+				}
+				logFunc("metric rejected",
+					zap.String("rule", rl.name),
+					zap.String("metric", p.Metric),
+				)
+			}
+			return false
+		case ActionRename:
+			if !rl.re.MatchString(p.Metric) {
+				continue
+			}
+			atomic.AddUint32(&rl.count, 1)
+			p.Metric = rl.re.ReplaceAllString(p.Metric, rl.replace)
+		case ActionSanitize:
+			metric := sanitize(rl.re, rl.replace, p.Metric)
+			if metric == p.Metric {
+				continue
+			}
+			atomic.AddUint32(&rl.count, 1)
+			p.Metric = metric
+		}
+
+		if p.Metric == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Store returns store func which applies rules before call of store
+func (r *Rules) Store(store func(*points.Points)) func(*points.Points) {
+	return func(p *points.Points) {
+		if r.Apply(p) {
+			store(p)
+		}
+	}
+}
+
+// Admit is Store for stores which report if points are stored. Metrics rejected or dropped by rules are reported as
+// not stored
+func (r *Rules) Admit(admit func(*points.Points) bool) func(*points.Points) bool {
+	return func(p *points.Points) bool {
+		return r.Apply(p) && admit(p)
+	}
+}
+
+// StoreWithConfirm is Store for stores with confirm callback. Dropped metrics are confirmed immediately. Result of
+// store is returned, false means that points are not accepted and will never be confirmed
+func (r *Rules) StoreWithConfirm(store func(*points.Points, func()) bool) func(*points.Points, func()) bool {
+	return func(p *points.Points, confirm func()) bool {
+		if r.Apply(p) {
+			return store(p, confirm)
+		}
+		confirm()
+		return true
+	}
+}
+
+// Stat sends number of metrics matched by each rule: "<name>.rejected", "<name>.dropped", "<name>.renamed" or "<name>.sanitized"
+func (r *Rules) Stat(send helper.StatCallback) {
+	for _, rl := range r.rules.Load().([]*rule) {
+		count := atomic.LoadUint32(&rl.count)
+		atomic.AddUint32(&rl.count, -count)
+		send(fmt.Sprintf("%s.%s", rl.name, statSuffix[rl.action]), float64(count))
+	}
+}
+
+var statSuffix = map[string]string{
+	ActionReject:   "rejected",
+	ActionDrop:     "dropped",
+	ActionRename:   "renamed",
+	ActionSanitize: "sanitized",
+}
@@ -0,0 +1,117 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/points"
+)
+
+func TestRules(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := New([]Rule{
+		{Name: "sanitize", Action: ActionSanitize},
+		{Name: "rename", Action: ActionRename, Pattern: `^servers\.([^.]+)\.`, Replace: "hosts.$1."},
+		{Name: "drop", Action: ActionDrop, Pattern: `^tmp\.`},
+		{Name: "reject", Action: ActionReject, Pattern: `^bad\.`},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	table := []struct {
+		metric   string
+		expected string // empty if dropped
+	}{
+		{"foo.bar", "foo.bar"},
+		{"foo..bar", "foo.bar"},
+		{".foo...bar.", "foo.bar"},
+		{"foo bar/baz", "foo_bar_baz"},
+		{"servers.web01.cpu", "hosts.web01.cpu"},
+		{"tmp.test", ""},
+		{"tmp..test", ""},
+		{"bad.metric", ""},
+		{"...", ""},
+	}
+
+	for _, tc := range table {
+		p := points.OnePoint(tc.metric, 1, 1)
+		ok := r.Apply(p)
+		if tc.expected == "" {
+			assert.False(ok, tc.metric)
+		} else {
+			assert.True(ok, tc.metric)
+			assert.Equal(tc.expected, p.Metric, tc.metric)
+		}
+	}
+
+	stat := make(map[string]float64)
+	r.Stat(func(metric string, value float64) {
+		stat[metric] = value
+	})
+	assert.Equal(map[string]float64{
+		"sanitize.sanitized": 5,
+		"rename.renamed":     1,
+		"drop.dropped":       2,
+		"reject.rejected":    1,
+	}, stat)
+
+	// counters are reset by Stat
+	r.Stat(func(metric string, value float64) {
+		assert.Equal(float64(0), value, metric)
+	})
+
+	var stored []string
+	store := r.Store(func(p *points.Points) {
+		stored = append(stored, p.Metric)
+	})
+	store(points.OnePoint("a..b", 1, 1))
+	store(points.OnePoint("tmp.c", 1, 1))
+	assert.Equal([]string{"a.b"}, stored)
+
+	admit := r.Admit(func(p *points.Points) bool {
+		return p.Metric != "full"
+	})
+	assert.True(admit(points.OnePoint("a..c", 1, 1)))
+	assert.False(admit(points.OnePoint("tmp.c", 1, 1)))
+	assert.False(admit(points.OnePoint("full", 1, 1)))
+
+	// old rules are kept if new are invalid
+	assert.Error(r.Update([]Rule{{Name: "x", Action: ActionDrop}}))
+	assert.False(r.Apply(points.OnePoint("tmp.d", 1, 1)))
+
+	assert.NoError(r.Update(nil))
+	assert.True(r.Apply(points.OnePoint("tmp.d", 1, 1)))
+}
+
+func TestRuleFirstInMinute(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := &rule{}
+	now := time.Unix(1422698160, 0)
+
+	assert.True(rl.firstInMinute(now))
+	assert.False(rl.firstInMinute(now.Add(time.Second)))
+	assert.False(rl.firstInMinute(now.Add(59 * time.Second)))
+	assert.True(rl.firstInMinute(now.Add(time.Minute)))
+	assert.False(rl.firstInMinute(now.Add(time.Minute + time.Second)))
+}
+
+func TestRulesConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, config := range [][]Rule{
+		{{Name: "", Action: ActionSanitize}},
+		{{Name: "a.b", Action: ActionSanitize}},
+		{{Name: "a", Action: ActionSanitize}, {Name: "a", Action: ActionSanitize}},
+		{{Name: "a", Action: "unknown"}},
+		{{Name: "a", Action: ActionReject}},
+		{{Name: "a", Action: ActionRename, Pattern: "("}},
+	} {
+		_, err := New(config)
+		assert.Error(err)
+	}
+}
@@ -0,0 +1,277 @@
+package tags
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"go.uber.org/zap"
+
+	"github.com/lomik/zapwriter"
+)
+
+// Keys of local tag database: "s" + series for known series and
+// "t" + tag + "\x00" + value + "\x00" + series for index by tag value. Name of series is tag "name"
+const (
+	dbSeriesPrefix = "s"
+	dbTagPrefix    = "t"
+	dbSep          = "\x00"
+)
+
+// DB is embedded tag database based on leveldb. It replaces external TagDB (graphite-web) on single node installations
+type DB struct {
+	db     *leveldb.DB
+	logger *zap.Logger
+
+	stat struct {
+		addCount  uint32
+		addErrors uint32
+	}
+}
+
+// TagValue is one value of tag with count of series
+type TagValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func NewDB(rootPath string) (*DB, error) {
+	logger := zapwriter.Logger("tags").With(zap.String("path", filepath.Join(rootPath, "db")))
+
+	db, err := openLevelDB(rootPath, "db", logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+func (db *DB) Close() {
+	db.db.Close()
+}
+
+func dbTagKey(tag, value, series string) []byte {
+	return []byte(dbTagPrefix + tag + dbSep + value + dbSep + series)
+}
+
+// Add stores series to database. Series are normalized, not tagged series are skipped
+func (db *DB) Add(paths []string) error {
+	batch := new(leveldb.Batch)
+
+	for _, p := range paths {
+		if strings.IndexByte(p, ';') < 0 {
+			continue
+		}
+
+		series, err := Normalize(p)
+		if err != nil {
+			atomic.AddUint32(&db.stat.addErrors, 1)
+			db.logger.Error("bad series", zap.String("series", p), zap.Error(err))
+			continue
+		}
+
+		batch.Put([]byte(dbSeriesPrefix+series), []byte{})
+		for tag, value := range ParseSeries(series) {
+			batch.Put(dbTagKey(tag, value, series), []byte{})
+		}
+		atomic.AddUint32(&db.stat.addCount, 1)
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	err := db.db.Write(batch, nil)
+	if err != nil {
+		atomic.AddUint32(&db.stat.addErrors, 1)
+		db.logger.Error("write to tag database failed", zap.Error(err))
+	}
+	return err
+}
+
+// splitTagKey parses key of tag index to tag, value and series
+func splitTagKey(key []byte) (string, string, string, bool) {
+	parts := strings.SplitN(string(key[len(dbTagPrefix):]), dbSep, 3)
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// FindSeries returns sorted list of series matched all expressions
+func (db *DB) FindSeries(exprs []*Expr) ([]string, error) {
+	first, err := PositiveExpr(exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+
+	iter := db.db.NewIterator(util.BytesPrefix([]byte(dbTagPrefix+first.Tag+dbSep)), nil)
+	for iter.Next() {
+		_, value, series, ok := splitTagKey(iter.Key())
+		if !ok || !first.Match(value) {
+			continue
+		}
+		if MatchAll(exprs, ParseSeries(series)) {
+			result = append(result, series)
+		}
+	}
+	iter.Release()
+
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// TagList returns sorted list of all tags. filter is optional
+func (db *DB) TagList(filter *regexp.Regexp, limit int) ([]string, error) {
+	result := make([]string, 0)
+
+	iter := db.db.NewIterator(util.BytesPrefix([]byte(dbTagPrefix)), nil)
+	ok := iter.First()
+	for ok {
+		tag, _, _, valid := splitTagKey(iter.Key())
+		if !valid {
+			ok = iter.Next()
+			continue
+		}
+
+		if filter == nil || filter.MatchString(tag) {
+			result = append(result, tag)
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+
+		// skip all values of tag
+		ok = iter.Seek([]byte(dbTagPrefix + tag + "\x01"))
+	}
+	iter.Release()
+
+	return result, iter.Error()
+}
+
+// TagValues returns sorted list of values of tag with count of series. filter is optional
+func (db *DB) TagValues(tag string, filter *regexp.Regexp, limit int) ([]TagValue, error) {
+	result := make([]TagValue, 0)
+
+	iter := db.db.NewIterator(util.BytesPrefix([]byte(dbTagPrefix+tag+dbSep)), nil)
+	for iter.Next() {
+		_, value, _, ok := splitTagKey(iter.Key())
+		if !ok {
+			continue
+		}
+
+		if len(result) > 0 && result[len(result)-1].Value == value {
+			result[len(result)-1].Count++
+			continue
+		}
+
+		if filter != nil && !filter.MatchString(value) {
+			continue
+		}
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		result = append(result, TagValue{Value: value, Count: 1})
+	}
+	iter.Release()
+
+	return result, iter.Error()
+}
+
+// AutoCompleteTags returns sorted list of tags with prefix. If exprs is not empty only tags of matched series are returned
+func (db *DB) AutoCompleteTags(exprs []*Expr, prefix string, limit int) ([]string, error) {
+	if len(exprs) == 0 {
+		var filter *regexp.Regexp
+		if prefix != "" {
+			filter = regexp.MustCompile("^" + regexp.QuoteMeta(prefix))
+		}
+		return db.TagList(filter, limit)
+	}
+
+	series, err := db.FindSeries(exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, e := range exprs {
+		used[e.Tag] = true
+	}
+
+	uniq := make(map[string]bool)
+	for _, s := range series {
+		for tag := range ParseSeries(s) {
+			if !used[tag] && strings.HasPrefix(tag, prefix) {
+				uniq[tag] = true
+			}
+		}
+	}
+
+	return sortedLimit(uniq, limit), nil
+}
+
+// AutoCompleteValues returns sorted list of values of tag with prefix. If exprs is not empty only values of matched series are returned
+func (db *DB) AutoCompleteValues(exprs []*Expr, tag string, prefix string, limit int) ([]string, error) {
+	uniq := make(map[string]bool)
+
+	if len(exprs) == 0 {
+		iter := db.db.NewIterator(util.BytesPrefix([]byte(dbTagPrefix+tag+dbSep+prefix)), nil)
+		for iter.Next() {
+			_, value, _, ok := splitTagKey(iter.Key())
+			if !ok {
+				continue
+			}
+			if !uniq[value] && limit > 0 && len(uniq) >= limit {
+				break
+			}
+			uniq[value] = true
+		}
+		iter.Release()
+
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+
+		return sortedLimit(uniq, limit), nil
+	}
+
+	series, err := db.FindSeries(exprs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range series {
+		value, ok := ParseSeries(s)[tag]
+		if ok && strings.HasPrefix(value, prefix) {
+			uniq[value] = true
+		}
+	}
+
+	return sortedLimit(uniq, limit), nil
+}
+
+func sortedLimit(uniq map[string]bool, limit int) []string {
+	result := make([]string, 0, len(uniq))
+	for k := range uniq {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
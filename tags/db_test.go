@@ -0,0 +1,180 @@
+package tags
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lomik/go-carbon/helper/qa"
+)
+
+func TestDB(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		assert := assert.New(t)
+
+		db, err := NewDB(dir)
+		if !assert.NoError(err) {
+			return
+		}
+		defer db.Close()
+
+		assert.NoError(db.Add([]string{
+			"cpu;host=web01;dc=am",
+			"cpu;host=web02;dc=ny",
+			"cpu;host=db01",
+			"mem;host=web01;dc=am",
+			"not.tagged",
+		}))
+		// duplicates are ignored
+		assert.NoError(db.Add([]string{"cpu;dc=am;host=web01"}))
+
+		exprs, err := ParseExprs([]string{"name=cpu", "host=~web"})
+		assert.NoError(err)
+		series, err := db.FindSeries(exprs)
+		assert.NoError(err)
+		assert.Equal([]string{"cpu;dc=am;host=web01", "cpu;dc=ny;host=web02"}, series)
+
+		exprs, err = ParseExprs([]string{"dc!=am"})
+		assert.NoError(err)
+		_, err = db.FindSeries(exprs)
+		assert.Equal(ErrNoPositiveExpr, err)
+
+		list, err := db.TagList(nil, 0)
+		assert.NoError(err)
+		assert.Equal([]string{"dc", "host", "name"}, list)
+
+		list, err = db.TagList(regexp.MustCompile("^(?:h|n)"), 1)
+		assert.NoError(err)
+		assert.Equal([]string{"host"}, list)
+
+		values, err := db.TagValues("host", nil, 0)
+		assert.NoError(err)
+		assert.Equal([]TagValue{{"db01", 1}, {"web01", 2}, {"web02", 1}}, values)
+
+		values, err = db.TagValues("host", regexp.MustCompile("^(?:web)"), 1)
+		assert.NoError(err)
+		assert.Equal([]TagValue{{"web01", 2}}, values)
+
+		list, err = db.AutoCompleteTags(nil, "h", 100)
+		assert.NoError(err)
+		assert.Equal([]string{"host"}, list)
+
+		exprs, err = ParseExprs([]string{"host=db01"})
+		assert.NoError(err)
+		list, err = db.AutoCompleteTags(exprs, "", 100)
+		assert.NoError(err)
+		assert.Equal([]string{"name"}, list)
+
+		list, err = db.AutoCompleteValues(nil, "host", "web", 100)
+		assert.NoError(err)
+		assert.Equal([]string{"web01", "web02"}, list)
+
+		exprs, err = ParseExprs([]string{"name=mem"})
+		assert.NoError(err)
+		list, err = db.AutoCompleteValues(exprs, "host", "", 100)
+		assert.NoError(err)
+		assert.Equal([]string{"web01"}, list)
+	})
+}
+
+func TestDBHandler(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		assert := assert.New(t)
+
+		db, err := NewDB(dir)
+		if !assert.NoError(err) {
+			return
+		}
+		defer db.Close()
+
+		h := db.Handler("secret")
+		token := "secret"
+
+		do := func(method, uri string, form url.Values) *httptest.ResponseRecorder {
+			var req *http.Request
+			if form != nil {
+				req = httptest.NewRequest(method, uri, strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(method, uri, nil)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := do("POST", "/tags/tagMultiSeries", url.Values{"path": {"cpu;host=web01;dc=am", "cpu;host=db01"}})
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`["cpu;dc=am;host=web01","cpu;host=db01"]`, rr.Body.String())
+
+		rr = do("POST", "/tags/tagSeries", url.Values{"path": {"mem;host=web01"}})
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`"mem;host=web01"`, rr.Body.String())
+
+		assert.Equal(http.StatusMethodNotAllowed, do("GET", "/tags/tagSeries?path=a;b=c", nil).Code)
+
+		rr = do("GET", "/tags", nil)
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`[{"tag":"dc"},{"tag":"host"},{"tag":"name"}]`, rr.Body.String())
+
+		rr = do("GET", "/tags/host", nil)
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`{"tag":"host","values":[{"value":"db01","count":1},{"value":"web01","count":2}]}`, rr.Body.String())
+
+		rr = do("GET", "/tags/findSeries?expr=name=cpu&expr=host=~web", nil)
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`["cpu;dc=am;host=web01"]`, rr.Body.String())
+
+		assert.Equal(http.StatusBadRequest, do("GET", "/tags/findSeries?expr=host!=web01", nil).Code)
+		assert.Equal(http.StatusBadRequest, do("GET", "/tags/findSeries", nil).Code)
+
+		rr = do("GET", "/tags/autoComplete/tags?tagPrefix=d", nil)
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`["dc"]`, rr.Body.String())
+
+		rr = do("GET", "/tags/autoComplete/values?tag=name&expr=host=web01", nil)
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.JSONEq(`["cpu","mem"]`, rr.Body.String())
+
+		assert.Equal(http.StatusBadRequest, do("GET", "/tags/autoComplete/values", nil).Code)
+
+		// write endpoints require token, read endpoints don't
+		token = "wrong"
+		assert.Equal(http.StatusUnauthorized, do("POST", "/tags/tagSeries", url.Values{"path": {"disk;host=web01"}}).Code)
+		token = ""
+		assert.Equal(http.StatusUnauthorized, do("POST", "/tags/tagMultiSeries", url.Values{"path": {"disk;host=web01"}}).Code)
+		assert.Equal(http.StatusOK, do("GET", "/tags/findSeries?expr=name=disk", nil).Code)
+		assert.JSONEq(`[]`, do("GET", "/tags/findSeries?expr=name=disk", nil).Body.String())
+
+		// write endpoints are disabled without token
+		h = db.Handler("")
+		assert.Equal(http.StatusNotFound, do("POST", "/tags/tagSeries", url.Values{"path": {"disk;host=web01"}}).Code)
+	})
+}
+
+func TestNewListenError(t *testing.T) {
+	qa.Root(t, func(dir string) {
+		busy, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer busy.Close()
+
+		_, err = New(&Options{
+			LocalPath:      dir,
+			TagDBType:      TagDBTypeLocal,
+			TagDBChunkSize: 32,
+			TagDBListen:    busy.Addr().String(),
+		})
+		assert.Error(t, err)
+	})
+}
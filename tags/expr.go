@@ -0,0 +1,170 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type ExprOp int
+
+const (
+	OpEq       ExprOp = iota // tag=value
+	OpNotEq                  // tag!=value
+	OpMatch                  // tag=~regexp
+	OpNotMatch               // tag!=~regexp
+)
+
+var ErrNoPositiveExpr = fmt.Errorf("at least one tag expression should match non empty value")
+
+// Expr is one tag expression of seriesByTag
+type Expr struct {
+	Tag   string
+	Op    ExprOp
+	Value string
+	re    *regexp.Regexp
+}
+
+func ParseExpr(s string) (*Expr, error) {
+	i := strings.IndexAny(s, "!=")
+	if i <= 0 {
+		return nil, fmt.Errorf("bad tag expression %#v", s)
+	}
+
+	e := &Expr{Tag: strings.TrimSpace(s[:i])}
+	rest := s[i:]
+
+	switch {
+	case strings.HasPrefix(rest, "!=~"):
+		e.Op, e.Value = OpNotMatch, rest[3:]
+	case strings.HasPrefix(rest, "!="):
+		e.Op, e.Value = OpNotEq, rest[2:]
+	case strings.HasPrefix(rest, "=~"):
+		e.Op, e.Value = OpMatch, rest[2:]
+	case strings.HasPrefix(rest, "="):
+		e.Op, e.Value = OpEq, rest[1:]
+	default:
+		return nil, fmt.Errorf("bad tag expression %#v", s)
+	}
+
+	if e.Op == OpMatch || e.Op == OpNotMatch {
+		var err error
+		// graphite matches regexp from the beginning of value
+		if e.re, err = regexp.Compile("^(?:" + e.Value + ")"); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Match checks value of tag. Value of missing tag is empty string
+func (e *Expr) Match(value string) bool {
+	switch e.Op {
+	case OpEq:
+		return value == e.Value
+	case OpNotEq:
+		return value != e.Value
+	case OpMatch:
+		return e.re.MatchString(value)
+	case OpNotMatch:
+		return !e.re.MatchString(value)
+	}
+	return false
+}
+
+func ParseExprs(list []string) ([]*Expr, error) {
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no tag expressions")
+	}
+
+	exprs := make([]*Expr, 0, len(list))
+	for _, s := range list {
+		e, err := ParseExpr(s)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+	return exprs, nil
+}
+
+// PositiveExpr returns first expression which can't match empty value. Candidate series are taken by it
+func PositiveExpr(exprs []*Expr) (*Expr, error) {
+	for _, e := range exprs {
+		if (e.Op == OpEq || e.Op == OpMatch) && !e.Match("") {
+			return e, nil
+		}
+	}
+	return nil, ErrNoPositiveExpr
+}
+
+// MatchAll checks tags of series against all expressions
+func MatchAll(exprs []*Expr, tags map[string]string) bool {
+	for _, e := range exprs {
+		if !e.Match(tags[e.Tag]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSeriesByTag checks if render target is seriesByTag(...) call
+func IsSeriesByTag(target string) bool {
+	return strings.HasPrefix(strings.TrimSpace(target), "seriesByTag(")
+}
+
+// ParseSeriesByTag parses target like seriesByTag('name=cpu','host=~web.*')
+func ParseSeriesByTag(target string) ([]*Expr, error) {
+	target = strings.TrimSpace(target)
+	if !IsSeriesByTag(target) || !strings.HasSuffix(target, ")") {
+		return nil, fmt.Errorf("bad seriesByTag call %#v", target)
+	}
+
+	args := target[len("seriesByTag(") : len(target)-1]
+	var list []string
+
+	for {
+		args = strings.TrimSpace(args)
+		if args == "" {
+			break
+		}
+
+		quote := args[0]
+		if quote != '\'' && quote != '"' {
+			return nil, fmt.Errorf("bad seriesByTag call %#v: arguments should be quoted", target)
+		}
+
+		end := strings.IndexByte(args[1:], quote)
+		if end < 0 {
+			return nil, fmt.Errorf("bad seriesByTag call %#v: unclosed quote", target)
+		}
+
+		list = append(list, args[1:end+1])
+
+		args = strings.TrimSpace(args[end+2:])
+		if args != "" {
+			if args[0] != ',' {
+				return nil, fmt.Errorf("bad seriesByTag call %#v", target)
+			}
+			args = args[1:]
+		}
+	}
+
+	return ParseExprs(list)
+}
+
+// ParseSeries splits normalized series name "name;tag1=value1;tag2=value2" to tags map
+func ParseSeries(series string) map[string]string {
+	parts := strings.Split(series, ";")
+	tags := make(map[string]string, len(parts))
+	tags["name"] = parts[0]
+	for _, p := range parts[1:] {
+		i := strings.IndexByte(p, '=')
+		if i <= 0 {
+			continue
+		}
+		tags[p[:i]] = p[i+1:]
+	}
+	return tags
+}
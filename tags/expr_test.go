@@ -0,0 +1,39 @@
+package tags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSeriesByTag(t *testing.T) {
+	assert := assert.New(t)
+
+	exprs, err := ParseSeriesByTag(`seriesByTag('name=cpu', "host=~web.*",'dc!=am','env!=~test')`)
+	if assert.NoError(err) && assert.Equal(4, len(exprs)) {
+		assert.Equal("name", exprs[0].Tag)
+		assert.Equal(OpEq, exprs[0].Op)
+		assert.Equal("cpu", exprs[0].Value)
+
+		assert.Equal("host", exprs[1].Tag)
+		assert.Equal(OpMatch, exprs[1].Op)
+		assert.True(exprs[1].Match("web01"))
+		assert.False(exprs[1].Match("db-web01"))
+
+		assert.Equal(OpNotEq, exprs[2].Op)
+		assert.Equal(OpNotMatch, exprs[3].Op)
+	}
+
+	for _, target := range []string{
+		`seriesByTag()`,
+		`seriesByTag(name=cpu)`,
+		`seriesByTag('name=cpu`,
+		`seriesByTag('name=cpu' 'host=a')`,
+		`seriesByTag('cpu')`,
+		`seriesByTag('host=~[')`,
+		`sumSeries(a.b)`,
+	} {
+		_, err := ParseSeriesByTag(target)
+		assert.Error(err, target)
+	}
+}
@@ -0,0 +1,355 @@
+package tags
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/lomik/go-carbon/helper/tenant"
+)
+
+// autoComplete limit as in graphite-web
+const autoCompleteLimit = 100
+
+// Handler returns http handler which implements graphite tags API: /tags, /tags/<tag>, /tags/findSeries,
+// /tags/autoComplete/tags, /tags/autoComplete/values, /tags/tagSeries and /tags/tagMultiSeries.
+// Write endpoints /tags/tagSeries and /tags/tagMultiSeries require "Authorization: Bearer <writeToken>" header
+// and are disabled if writeToken is empty
+func (db *DB) Handler(writeToken string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tags", db.tagListHandler)
+	mux.HandleFunc("/tags/", db.tagValuesHandler)
+	mux.HandleFunc("/tags/findSeries", db.findSeriesHandler)
+	mux.HandleFunc("/tags/autoComplete/tags", db.autoCompleteTagsHandler)
+	mux.HandleFunc("/tags/autoComplete/values", db.autoCompleteValuesHandler)
+	if writeToken != "" {
+		mux.HandleFunc("/tags/tagSeries", db.writeAuth(writeToken, db.tagSeriesHandler))
+		mux.HandleFunc("/tags/tagMultiSeries", db.writeAuth(writeToken, db.tagMultiSeriesHandler))
+	} else {
+		// not handled as /tags/<tag>
+		mux.Handle("/tags/tagSeries", http.NotFoundHandler())
+		mux.Handle("/tags/tagMultiSeries", http.NotFoundHandler())
+	}
+	return mux
+}
+
+// writeAuth rejects requests without valid "Authorization: Bearer <token>" header
+func (db *DB) writeAuth(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := tenant.AuthorizationToken(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+			db.writeError(w, r, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (db *DB) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func (db *DB) writeError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	db.logger.Error("request failed",
+		zap.String("url", r.URL.RequestURI()),
+		zap.String("peer", r.RemoteAddr),
+		zap.Int("http_code", code),
+		zap.Error(err),
+	)
+	http.Error(w, err.Error(), code)
+}
+
+func formLimit(r *http.Request, defaultLimit int) (int, error) {
+	s := r.FormValue("limit")
+	if s == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad limit %#v", s)
+	}
+	return limit, nil
+}
+
+func formFilter(r *http.Request) (*regexp.Regexp, error) {
+	s := r.FormValue("filter")
+	if s == "" {
+		return nil, nil
+	}
+	// graphite matches filter from the beginning of string
+	return regexp.Compile("^(?:" + s + ")")
+}
+
+func (db *DB) tagListHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: /tags?filter=regexp&limit=N
+	r.ParseForm()
+
+	filter, err := formFilter(r)
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := formLimit(r, 0)
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	list, err := db.TagList(filter, limit)
+	if err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	type tagInfo struct {
+		Tag string `json:"tag"`
+	}
+
+	result := make([]tagInfo, len(list))
+	for i, tag := range list {
+		result[i].Tag = tag
+	}
+
+	db.writeJSON(w, r, result)
+}
+
+func (db *DB) tagValuesHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: /tags/<tag>?filter=regexp&limit=N
+	tag := strings.TrimPrefix(r.URL.Path, "/tags/")
+	if tag == "" {
+		db.tagListHandler(w, r)
+		return
+	}
+	if strings.IndexByte(tag, '/') >= 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	r.ParseForm()
+
+	filter, err := formFilter(r)
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	limit, err := formLimit(r, 0)
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	values, err := db.TagValues(tag, filter, limit)
+	if err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	db.writeJSON(w, r, struct {
+		Tag    string     `json:"tag"`
+		Values []TagValue `json:"values"`
+	}{tag, values})
+}
+
+func (db *DB) findSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: /tags/findSeries?expr=name=cpu&expr=host=~web.*
+	r.ParseForm()
+
+	exprs, err := ParseExprs(r.Form["expr"])
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	series, err := db.FindSeries(exprs)
+	if err == ErrNoPositiveExpr {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	db.writeJSON(w, r, series)
+}
+
+func (db *DB) autoCompleteTagsHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: /tags/autoComplete/tags?tagPrefix=ho&expr=name=cpu&limit=N
+	r.ParseForm()
+
+	var exprs []*Expr
+	var err error
+
+	if len(r.Form["expr"]) > 0 {
+		if exprs, err = ParseExprs(r.Form["expr"]); err != nil {
+			db.writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	limit, err := formLimit(r, autoCompleteLimit)
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.AutoCompleteTags(exprs, r.FormValue("tagPrefix"), limit)
+	if err == ErrNoPositiveExpr {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	db.writeJSON(w, r, result)
+}
+
+func (db *DB) autoCompleteValuesHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: /tags/autoComplete/values?tag=host&valuePrefix=web&expr=name=cpu&limit=N
+	r.ParseForm()
+
+	tag := r.FormValue("tag")
+	if tag == "" {
+		db.writeError(w, r, http.StatusBadRequest, fmt.Errorf("tag not specified"))
+		return
+	}
+
+	var exprs []*Expr
+	var err error
+
+	if len(r.Form["expr"]) > 0 {
+		if exprs, err = ParseExprs(r.Form["expr"]); err != nil {
+			db.writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	limit, err := formLimit(r, autoCompleteLimit)
+	if err != nil {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := db.AutoCompleteValues(exprs, tag, r.FormValue("valuePrefix"), limit)
+	if err == ErrNoPositiveExpr {
+		db.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	db.writeJSON(w, r, result)
+}
+
+// tagPaths normalizes and stores paths from POST form
+func (db *DB) tagPaths(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	r.ParseForm()
+	paths := r.Form["path"]
+	if len(paths) == 0 {
+		db.writeError(w, r, http.StatusBadRequest, fmt.Errorf("no path specified"))
+		return nil, false
+	}
+
+	result := make([]string, len(paths))
+	for i, p := range paths {
+		series, err := Normalize(p)
+		if err != nil {
+			db.writeError(w, r, http.StatusBadRequest, err)
+			return nil, false
+		}
+		result[i] = series
+	}
+
+	if err := db.Add(result); err != nil {
+		db.writeError(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return result, true
+}
+
+func (db *DB) tagSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: POST /tags/tagSeries path=series
+	result, ok := db.tagPaths(w, r)
+	if ok {
+		db.writeJSON(w, r, result[0])
+	}
+}
+
+func (db *DB) tagMultiSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	// URL: POST /tags/tagMultiSeries path=series1&path=series2
+	result, ok := db.tagPaths(w, r)
+	if ok {
+		db.writeJSON(w, r, result)
+	}
+}
+
+// Listen starts HTTP server with graphite tags API
+func (t *Tags) Listen(listen string) error {
+	if t.db == nil {
+		return fmt.Errorf("local tag database not initialized")
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", listen)
+	if err != nil {
+		return err
+	}
+
+	tcpListener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s := &http.Server{
+		Handler:      t.db.Handler(t.writeToken),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	closed := make(chan struct{})
+
+	t.listener = tcpListener
+	t.server = s
+	t.closed = closed
+
+	go func() {
+		s.Serve(tcpListener)
+		close(closed)
+	}()
+
+	return nil
+}
+
+// Addr returns binded socket address. For bind port 0 in tests
+func (t *Tags) Addr() net.Addr {
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
@@ -47,49 +47,61 @@ func exists(path string) bool {
 	return true
 }
 
-func NewQueue(rootPath string, send func([]string) error, sendChunk int) (*Queue, error) {
-	if send == nil {
-		return nil, fmt.Errorf("send callback not set")
+// openLevelDB opens leveldb database in rootPath/name. Corrupted database is moved to rootPath/name_corrupted_<ts> and new one is created
+func openLevelDB(rootPath string, name string, logger *zap.Logger) (*leveldb.DB, error) {
+	o := &opt.Options{}
+
+	dir := filepath.Join(rootPath, name)
+
+	db, err := leveldb.OpenFile(dir, o)
+	if err == nil {
+		return db, nil
 	}
 
-	o := &opt.Options{}
+	logger.Error("can't open database",
+		zap.Error(err),
+	)
 
-	queueDir := filepath.Join(rootPath, "queue")
+	if !exists(dir) {
+		return nil, err
+	}
 
-	db, err := leveldb.OpenFile(queueDir, o)
+	// try to recover
+	logger.Info("database directory exists, try to recover")
+	moveTo := filepath.Join(rootPath, fmt.Sprintf("%s_corrupted_%d", name, time.Now().UnixNano()))
+	err = os.Rename(dir, moveTo)
+	if err != nil {
+		logger.Error("move corrupted database failed",
+			zap.String("dst", moveTo),
+			zap.Error(err),
+		)
 
-	logger := zapwriter.Logger("tags").With(zap.String("path", queueDir))
+		return nil, err
+	}
 
+	// corrupted database moved, open new
+	db, err = leveldb.OpenFile(dir, o)
 	if err != nil {
-		logger.Error("can't open queue database",
+		logger.Error("can't create new database",
 			zap.Error(err),
 		)
+		return nil, err
+	}
 
-		if !exists(queueDir) {
-			return nil, err
-		}
+	return db, nil
+}
 
-		// try to recover
-		logger.Info("queue directory exists, try to recover")
-		moveTo := filepath.Join(rootPath, fmt.Sprintf("queue_corrupted_%d", time.Now().UnixNano()))
-		err = os.Rename(queueDir, moveTo)
-		if err != nil {
-			logger.Error("move corrupted queue failed",
-				zap.String("dst", moveTo),
-				zap.Error(err),
-			)
+func NewQueue(rootPath string, send func([]string) error, sendChunk int) (*Queue, error) {
+	if send == nil {
+		return nil, fmt.Errorf("send callback not set")
+	}
 
-			return nil, err
-		}
+	queueDir := filepath.Join(rootPath, "queue")
+	logger := zapwriter.Logger("tags").With(zap.String("path", queueDir))
 
-		// corrupted database moved, open new
-		db, err = leveldb.OpenFile(queueDir, o)
-		if err != nil {
-			logger.Error("can't create new queue database",
-				zap.Error(err),
-			)
-			return nil, err
-		}
+	db, err := openLevelDB(rootPath, "queue", logger)
+	if err != nil {
+		return nil, err
 	}
 
 	if sendChunk < 1 {
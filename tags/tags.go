@@ -3,6 +3,7 @@ package tags
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
@@ -13,28 +14,62 @@ import (
 	"github.com/lomik/zapwriter"
 )
 
+const (
+	TagDBTypeHTTP  = "http"  // send series to external TagDB by /tags/tagMultiSeries
+	TagDBTypeLocal = "local" // store series in embedded leveldb database
+)
+
 type Options struct {
-	LocalPath      string
-	TagDB          string
-	TagDBTimeout   time.Duration
-	TagDBChunkSize int
+	LocalPath       string
+	TagDBType       string
+	TagDB           string
+	TagDBTimeout    time.Duration
+	TagDBChunkSize  int
+	TagDBListen     string // listen address of graphite tags API for local TagDB
+	TagDBWriteToken string // token of write endpoints of graphite tags API, empty value disables them
 }
 
 type Tags struct {
 	q      *Queue
 	qErr   error // queue initialization error
+	db     *DB
+	dbErr  error // local tag database initialization error
 	logger *zap.Logger
+
+	listener   *net.TCPListener
+	server     *http.Server
+	closed     chan struct{}
+	writeToken string
 }
 
-func New(options *Options) *Tags {
+func New(options *Options) (*Tags, error) {
 	var send func([]string) error
 
 	t := &Tags{
-		logger: zapwriter.Logger("tags"),
+		logger:     zapwriter.Logger("tags"),
+		writeToken: options.TagDBWriteToken,
 	}
 
 	u, urlErr := url.Parse(options.TagDB)
-	if urlErr != nil {
+	if options.TagDBType == TagDBTypeLocal {
+		t.db, t.dbErr = NewDB(options.LocalPath)
+
+		send = func(paths []string) error {
+			if t.db == nil {
+				time.Sleep(time.Second)
+				t.logger.Error("local tag database not initialized", zap.Error(t.dbErr))
+				return t.dbErr
+			}
+			return t.db.Add(paths)
+		}
+
+		if t.db != nil && options.TagDBListen != "" {
+			if err := t.Listen(options.TagDBListen); err != nil {
+				t.db.Close()
+				return nil, err
+			}
+		}
+	} else if urlErr != nil {
 		send = func([]string) error {
 			time.Sleep(time.Second)
 			t.logger.Error("bad tag url", zap.String("url", options.TagDB), zap.Error(urlErr))
@@ -62,11 +97,22 @@ func New(options *Options) *Tags {
 
 	t.q, t.qErr = NewQueue(options.LocalPath, send, options.TagDBChunkSize)
 
-	return t
+	return t, nil
 }
 
 func (t *Tags) Stop() {
+	if t.server != nil {
+		t.server.Close()
+		<-t.closed
+		t.server = nil
+		t.listener = nil
+	}
+
 	t.q.Stop()
+
+	if t.db != nil {
+		t.db.Close()
+	}
 }
 
 func (t *Tags) Add(value string) {
@@ -87,4 +133,17 @@ func (t *Tags) Stat(send helper.StatCallback) {
 	helper.SendAndSubstractUint32("tagdbSendSuccess", &t.q.stat.sendSuccess, send)
 
 	send("queueLag", t.q.Lag().Seconds())
+
+	if t.db != nil {
+		helper.SendAndSubstractUint32("localdbAddCount", &t.db.stat.addCount, send)
+		helper.SendAndSubstractUint32("localdbAddErrors", &t.db.stat.addErrors, send)
+	}
+}
+
+// StatType returns type of stat sent by Stat
+func (t *Tags) StatType(metric string) helper.StatType {
+	if metric == "queueLag" {
+		return helper.StatGauge
+	}
+	return helper.StatCounter
 }